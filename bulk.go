@@ -0,0 +1,262 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Row is a row written by PutMany, it is routed by ShardKey like the shardKey of Put
+type Row struct {
+	ShardKey interface{}
+	Values   Columns
+}
+
+// BulkOptions limit the statements of PutMany, rows of a shard are written by multi-row INSERT statements
+type BulkOptions struct {
+	// MaxRows is the maximum number of rows of a statement
+	MaxRows int
+	// MaxPacketSize is the estimated maximum size of a statement in bytes, it should be below
+	// max_allowed_packet of MySQL
+	MaxPacketSize int
+}
+
+var DefaultBulkOptions = BulkOptions{
+	MaxRows:       1000,
+	MaxPacketSize: 4 << 20,
+}
+
+// maxBulkArgs is the limit of placeholders of a statement, PostgreSQL allows 65535
+const maxBulkArgs = 65535
+
+// RowError is the error of a row that was not written
+type RowError struct {
+	// Index of the row in the rows passed to PutMany
+	Index int
+	Err   error
+}
+
+// BulkResult reports the rows written by PutMany
+type BulkResult struct {
+	Written int
+	Failed  []RowError
+}
+
+// Err returns an error if some rows were not written, the rows are listed in Failed
+func (res *BulkResult) Err() error {
+	if len(res.Failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("eplidr: %d of %d rows are not written, row %d: %w",
+		len(res.Failed), len(res.Failed)+res.Written, res.Failed[0].Index, res.Failed[0].Err)
+}
+
+// PutMany inserts rows in batches, the batches of different shards are written concurrently.
+// If a batch fails its rows are inserted one by one to find the failed ones. The error is BulkResult.Err.
+func (table *Table) PutMany(rows []Row, options ...BulkOptions) (*BulkResult, error) {
+	return table.PutManyContext(context.Background(), rows, options...)
+}
+func (table *Table) PutManyContext(ctx context.Context, rows []Row, options ...BulkOptions) (*BulkResult, error) {
+	return table.putMany(ctx, rows, false, options)
+}
+
+// PutOrUpdateMany is PutMany that updates rows with existing primary keys
+func (table *Table) PutOrUpdateMany(rows []Row, options ...BulkOptions) (*BulkResult, error) {
+	return table.PutOrUpdateManyContext(context.Background(), rows, options...)
+}
+func (table *Table) PutOrUpdateManyContext(ctx context.Context, rows []Row, options ...BulkOptions) (*BulkResult, error) {
+	return table.putMany(ctx, rows, true, options)
+}
+
+// bulkRow is a row of a batch with its index in the rows of PutMany
+type bulkRow struct {
+	index  int
+	values Columns
+}
+
+func (table *Table) putMany(ctx context.Context, rows []Row, update bool, options []BulkOptions) (*BulkResult, error) {
+	option := DefaultBulkOptions
+	if len(options) != 0 {
+		option = options[0]
+	}
+	result := &BulkResult{}
+	table.mx.RLock()
+	shards, router, shardsCount, reshard := table.Shards, table.router, table.shardsCount, table.reshard
+	table.mx.RUnlock()
+	if reshard != nil && !reshard.leased() {
+		return nil, ErrReshardFenced
+	}
+	// rows of a shard are grouped by their columns, a statement has one column list
+	groups := make([]map[string][]bulkRow, len(shards))
+	for i, row := range rows {
+		err := table.validate(validateInsert, row.Values)
+		if err != nil {
+			result.Failed = append(result.Failed, RowError{Index: i, Err: err})
+			continue
+		}
+		num := router.Route(row.ShardKey, shardsCount)
+		if groups[num] == nil {
+			groups[num] = make(map[string][]bulkRow)
+		}
+		names := make([]string, len(row.Values))
+		for j, value := range row.Values {
+			names[j] = strings.ToLower(value.Name)
+		}
+		signature := strings.Join(names, ",")
+		groups[num][signature] = append(groups[num][signature], bulkRow{index: i, values: row.Values})
+	}
+	results := make([]BulkResult, len(shards))
+	var tasks []func()
+	for num := range groups {
+		if groups[num] == nil {
+			continue
+		}
+		num := num
+		tasks = append(tasks, func() {
+			for _, group := range groups[num] {
+				for _, batch := range bulkBatches(group, option) {
+					table.writeBatch(ctx, shards[num], batch, update, &results[num])
+				}
+			}
+		})
+	}
+	fanOut(tasks...)
+	for num := range results {
+		result.Written += results[num].Written
+		result.Failed = append(result.Failed, results[num].Failed...)
+	}
+	sort.Slice(result.Failed, func(a, b int) bool {
+		return result.Failed[a].Index < result.Failed[b].Index
+	})
+	return result, result.Err()
+}
+
+// writeBatch writes batch to shard, invalidates the written rows and mirrors them to the resharding target.
+// The locks of the table are held per batch, so a pending cutover waits only for the batches in progress.
+func (table *Table) writeBatch(ctx context.Context, shard *Shard, batch []bulkRow, update bool, result *BulkResult) {
+	table.mx.RLock()
+	defer table.mx.RUnlock()
+	reshard := table.reshard
+	if reshard != nil {
+		if !reshard.leased() {
+			for _, row := range batch {
+				result.Failed = append(result.Failed, RowError{Index: row.index, Err: ErrReshardFenced})
+			}
+			return
+		}
+		// batches of the resharding copy must not interleave with the write and its mirroring
+		reshard.copyMx.RLock()
+		defer reshard.copyMx.RUnlock()
+	}
+	failed := len(result.Failed)
+	shard.putBatch(ctx, batch, update, result)
+	skipped := make(map[int]bool, len(result.Failed)-failed)
+	for _, row := range result.Failed[failed:] {
+		skipped[row.Index] = true
+	}
+	var written []Columns
+	for _, row := range batch {
+		if !skipped[row.index] {
+			written = append(written, row.values)
+		}
+	}
+	if len(written) == 0 {
+		return
+	}
+	table.invalidateRows(ctx, written)
+	if reshard != nil {
+		err := reshard.mirrorPuts(shard, written)
+		if err != nil {
+			reshard.mirrorFailed(err)
+		}
+	}
+}
+
+// bulkBatches splits rows with the same columns into batches limited by options
+func bulkBatches(rows []bulkRow, options BulkOptions) [][]bulkRow {
+	var batches [][]bulkRow
+	start, size := 0, 0
+	for i, row := range rows {
+		rowSize := estimateRowSize(row.values)
+		full := i > start && ((options.MaxRows > 0 && i-start >= options.MaxRows) ||
+			(options.MaxPacketSize > 0 && size+rowSize > options.MaxPacketSize) ||
+			(i-start+1)*len(row.values) > maxBulkArgs)
+		if full {
+			batches = append(batches, rows[start:i])
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	if start < len(rows) {
+		batches = append(batches, rows[start:])
+	}
+	return batches
+}
+
+// estimateRowSize estimates the bytes of a row in a statement, values are sent as hex by some dialects
+func estimateRowSize(values Columns) int {
+	size := 4
+	for _, value := range values {
+		switch v := value.Value.(type) {
+		case string:
+			size += 2*len(v) + 8
+		case []byte:
+			size += 2*len(v) + 8
+		default:
+			size += 32
+		}
+	}
+	return size
+}
+
+// putBatch writes batch by one statement, or row by row if it fails
+func (shard *Shard) putBatch(ctx context.Context, batch []bulkRow, update bool, result *BulkResult) {
+	stmt := shard.putManyStatement(batch, update)
+	_, err := shard.execStatement(withOperation(ctx, OpPut), stmt, true)
+	if err == nil {
+		result.Written += len(batch)
+		return
+	}
+	if len(batch) == 1 || ctx.Err() != nil || errorCode(err) == CodeConnection || errorCode(err) == CodeShardUnavailable ||
+		errors.Is(err, ErrShardRetired) {
+		for _, row := range batch {
+			result.Failed = append(result.Failed, RowError{Index: row.index, Err: err})
+		}
+		return
+	}
+	for _, row := range batch {
+		shard.putBatch(ctx, []bulkRow{row}, update, result)
+	}
+}
+
+// putManyStatement inserts rows with the same columns
+func (shard *Shard) putManyStatement(rows []bulkRow, update bool) *statement {
+	first := rows[0].values
+	stmt := newStatement(shard.table.dialect, "INSERT INTO {table} (")
+	for i := 0; i < len(first); i++ {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.ident(first[i].Name)
+	}
+	stmt.write(") values ")
+	for i, row := range rows {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.write("(")
+		for j := 0; j < len(row.values); j++ {
+			if j != 0 {
+				stmt.write(", ")
+			}
+			stmt.bind(shard.table, row.values[j].Name, row.values[j].Value)
+		}
+		stmt.write(")")
+	}
+	if update {
+		stmt.write(shard.upsertClause(first))
+	}
+	return stmt.write(";")
+}
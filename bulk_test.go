@@ -0,0 +1,84 @@
+package eplidr
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPutMany(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields, WithCache(CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute}))
+	putItems(t, table, 2)
+	// a missing row is cached before PutMany writes it
+	if _, found := cachedStatus(t, table, 5); found {
+		t.Fatal("row 5 is found before PutMany")
+	}
+
+	var rows []Row
+	for i := int64(0); i < 10; i++ {
+		rows = append(rows, Row{ShardKey: i, Values: Columns{{"id", i}, {"status", i}}})
+	}
+	rows = append(rows, Row{ShardKey: int64(20), Values: Columns{{"id", "not a number"}}})
+	result, err := table.PutMany(rows, BulkOptions{MaxRows: 3})
+	if err == nil {
+		t.Fatal("PutMany of existing rows succeeded")
+	}
+	// rows 0 and 1 exist, the batches with them are written row by row
+	if result.Written != 8 || len(result.Failed) != 3 {
+		t.Fatalf("written %d, failed %v, want 8 and 3", result.Written, result.Failed)
+	}
+	for i, index := range []int{0, 1, 10} {
+		if result.Failed[i].Index != index {
+			t.Errorf("failed row %d has index %d, want %d", i, result.Failed[i].Index, index)
+		}
+	}
+	if !errors.Is(result.Failed[0].Err, ErrDuplicateKey) || !errors.Is(result.Failed[2].Err, ErrValidation) {
+		t.Errorf("errors of failed rows: %v, %v", result.Failed[0].Err, result.Failed[2].Err)
+	}
+	if status, found := cachedStatus(t, table, 5); !found || status != 5 {
+		t.Errorf("row 5 after PutMany: %d %v, want 5", status, found)
+	}
+	if status, _ := cachedStatus(t, table, 1); status != 1 {
+		t.Errorf("row 1 not written by PutMany: status %d, want 1", status)
+	}
+
+	result, err = table.PutOrUpdateMany(rows[:10], BulkOptions{MaxRows: 4})
+	if err != nil || result.Written != 10 {
+		t.Fatalf("PutOrUpdateMany: %v, written %d", err, result.Written)
+	}
+	if status, _ := cachedStatus(t, table, 0); status != 0 {
+		t.Errorf("row 0 after PutOrUpdateMany: status %d, want 0", status)
+	}
+}
+
+func TestBulkBatches(t *testing.T) {
+	rows := make([]bulkRow, 10)
+	for i := range rows {
+		rows[i] = bulkRow{index: i, values: Columns{{"id", int64(i)}, {"name", "0123456789"}}}
+	}
+	tests := []struct {
+		options BulkOptions
+		sizes   []int
+	}{
+		{BulkOptions{}, []int{10}},
+		{BulkOptions{MaxRows: 4}, []int{4, 4, 2}},
+		// a row is estimated at 4 + 32 + 2*10 + 8 = 64 bytes
+		{BulkOptions{MaxPacketSize: 200}, []int{3, 3, 3, 1}},
+	}
+	for _, test := range tests {
+		var sizes []int
+		for _, batch := range bulkBatches(rows, test.options) {
+			sizes = append(sizes, len(batch))
+		}
+		if len(sizes) != len(test.sizes) {
+			t.Errorf("%+v: batches %v, want %v", test.options, sizes, test.sizes)
+			continue
+		}
+		for i := range sizes {
+			if sizes[i] != test.sizes[i] {
+				t.Errorf("%+v: batches %v, want %v", test.options, sizes, test.sizes)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,742 @@
+package eplidr
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"hash/fnv"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions configure the read-through cache of Table.Get. Rows are cached by primary key when Get is
+// called with Keys of the whole primary key, Put, PutOrUpdate, Set, Add and Remove of the same table
+// invalidate them. Writes by raw statements or by other programs are not seen until TTL passes,
+// InvalidateCache and ClearCache drop rows explicitly.
+type CacheOptions struct {
+	// Size is the maximum number of rows in the in-process cache
+	Size int
+	// TTL is how long a row is cached
+	TTL time.Duration
+	// NegativeTTL is how long a missing row is cached, 0 disables caching of missing rows
+	NegativeTTL time.Duration
+	// Remote is a cache shared by processes, it is read after the in-process cache misses.
+	// Writes that do not identify rows by primary key select primary keys of the matching rows
+	// before the write to drop them from it.
+	Remote RemoteCache
+	// LoadTimeout bounds the load of a missed row. The load is shared by concurrent misses of the row
+	// and is not canceled with the context of the Get that started it, 0 is 10 seconds.
+	LoadTimeout time.Duration
+}
+
+var DefaultCacheOptions = CacheOptions{
+	Size:        10000,
+	TTL:         time.Minute,
+	NegativeTTL: 10 * time.Second,
+	LoadTimeout: 10 * time.Second,
+}
+
+// RemoteCache is a shared cache like Redis or Memcached, values are rows encoded with gob
+type RemoteCache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// WithCache caches rows read by Get, SingleKeyTable.Get and its typed getters
+func WithCache(options CacheOptions) TableOption {
+	return func(table *Table) {
+		table.cache = newRowCache(options)
+	}
+}
+
+// CacheStats are counters of the cache of a table
+type CacheStats struct {
+	Hits       uint64
+	RemoteHits uint64
+	Misses     uint64
+	Evictions  uint64
+}
+
+// cachedRow is a row by lower case column name, Found is false for a cached missing row
+type cachedRow struct {
+	Found  bool
+	Values map[string]interface{}
+}
+
+type cacheEntry struct {
+	key     string
+	row     *cachedRow
+	expires time.Time
+}
+
+// rowCache is an LRU of rows bounded by size and TTL with a remote cache behind it
+type rowCache struct {
+	options CacheOptions
+	// keys identify cached rows, the primary key of the table is used if it is empty
+	keys []string
+
+	mx      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// generations are bumped by invalidations, a row loaded while the generation of its key
+	// or the table changed is not cached
+	generation  atomic.Uint64
+	generations [64]atomic.Uint64
+
+	flightMx sync.Mutex
+	flights  map[string]*cacheFlight
+
+	hits, remoteHits, misses, evictions atomic.Uint64
+}
+
+// cacheFlight is a load of a row shared by concurrent misses of its key. generation and keyGeneration are
+// the generations it started at, misses after an invalidation do not share it.
+type cacheFlight struct {
+	done          chan struct{}
+	row           *cachedRow
+	err           error
+	generation    uint64
+	keyGeneration uint64
+}
+
+func newRowCache(options CacheOptions) *rowCache {
+	return &rowCache{
+		options: options,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		flights: make(map[string]*cacheFlight),
+	}
+}
+
+func (cache *rowCache) local(key string) (*cachedRow, bool) {
+	cache.mx.Lock()
+	defer cache.mx.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cache.lru.Remove(element)
+		delete(cache.entries, key)
+		return nil, false
+	}
+	cache.lru.MoveToFront(element)
+	return entry.row, true
+}
+
+func (cache *rowCache) store(key string, row *cachedRow, ttl time.Duration) {
+	if cache.options.Size <= 0 || ttl <= 0 {
+		return
+	}
+	cache.mx.Lock()
+	defer cache.mx.Unlock()
+	entry := &cacheEntry{key: key, row: row, expires: time.Now().Add(ttl)}
+	if element, ok := cache.entries[key]; ok {
+		element.Value = entry
+		cache.lru.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.lru.PushFront(entry)
+	for cache.lru.Len() > cache.options.Size {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+		cache.evictions.Add(1)
+	}
+}
+
+func (cache *rowCache) ttl(row *cachedRow) time.Duration {
+	if row.Found {
+		return cache.options.TTL
+	}
+	return cache.options.NegativeTTL
+}
+
+func (cache *rowCache) keyGeneration(key string) *atomic.Uint64 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return &cache.generations[hash.Sum32()%uint32(len(cache.generations))]
+}
+
+// row returns the cached row of key or loads it, concurrent misses of a key share one load.
+// The load runs detached from ctx, every caller stops waiting for it when its own ctx is done.
+func (cache *rowCache) row(ctx context.Context, key string, load func(ctx context.Context) (*cachedRow, error)) (*cachedRow, error) {
+	if row, ok := cache.local(key); ok {
+		cache.hits.Add(1)
+		return row, nil
+	}
+	cache.flightMx.Lock()
+	flight, ok := cache.flights[key]
+	if !ok || !cache.unchanged(key, flight.generation, flight.keyGeneration) {
+		flight = &cacheFlight{
+			done:          make(chan struct{}),
+			generation:    cache.generation.Load(),
+			keyGeneration: cache.keyGeneration(key).Load(),
+		}
+		cache.flights[key] = flight
+		go cache.load(detachedContext{ctx}, key, flight, load)
+	}
+	cache.flightMx.Unlock()
+	select {
+	case <-flight.done:
+		return flight.row, flight.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load fills flight with the row of key within LoadTimeout
+func (cache *rowCache) load(ctx context.Context, key string, flight *cacheFlight, load func(ctx context.Context) (*cachedRow, error)) {
+	timeout := cache.options.LoadTimeout
+	if timeout <= 0 {
+		timeout = DefaultCacheOptions.LoadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	flight.row, flight.err = cache.fill(ctx, key, flight, load)
+	cache.flightMx.Lock()
+	if cache.flights[key] == flight {
+		delete(cache.flights, key)
+	}
+	cache.flightMx.Unlock()
+	close(flight.done)
+}
+
+// detachedContext has values of its parent without its deadline and cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (ctx detachedContext) Done() <-chan struct{}             { return nil }
+func (ctx detachedContext) Err() error                        { return nil }
+func (ctx detachedContext) Value(key interface{}) interface{} { return ctx.parent.Value(key) }
+
+func (cache *rowCache) fill(ctx context.Context, key string, flight *cacheFlight, load func(ctx context.Context) (*cachedRow, error)) (*cachedRow, error) {
+	generation, keyGeneration := flight.generation, flight.keyGeneration
+	if cache.options.Remote != nil {
+		data, ok, err := cache.options.Remote.Get(ctx, key)
+		if err != nil {
+			logger.Warn("remote cache get ", key, ": ", err.Error())
+		}
+		if err == nil && ok {
+			row, err := decodeCachedRow(data)
+			if err == nil {
+				cache.remoteHits.Add(1)
+				if cache.unchanged(key, generation, keyGeneration) {
+					cache.store(key, row, cache.ttl(row))
+				}
+				return row, nil
+			}
+			logger.Warn("remote cache decode ", key, ": ", err.Error())
+		}
+	}
+	cache.misses.Add(1)
+	row, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ttl := cache.ttl(row)
+	if ttl <= 0 || !cache.unchanged(key, generation, keyGeneration) {
+		return row, nil
+	}
+	cache.store(key, row, ttl)
+	if cache.options.Remote != nil {
+		data, err := encodeCachedRow(row)
+		if err == nil {
+			err = cache.options.Remote.Set(ctx, key, data, ttl)
+		}
+		if err != nil {
+			logger.Warn("remote cache set ", key, ": ", err.Error())
+		}
+	}
+	return row, nil
+}
+
+func (cache *rowCache) unchanged(key string, generation uint64, keyGeneration uint64) bool {
+	return cache.generation.Load() == generation && cache.keyGeneration(key).Load() == keyGeneration
+}
+
+// invalidate drops rows of keys from both caches
+func (cache *rowCache) invalidate(ctx context.Context, keys ...string) {
+	cache.mx.Lock()
+	for _, key := range keys {
+		cache.keyGeneration(key).Add(1)
+		if element, ok := cache.entries[key]; ok {
+			cache.lru.Remove(element)
+			delete(cache.entries, key)
+		}
+	}
+	cache.mx.Unlock()
+	if cache.options.Remote != nil && len(keys) != 0 {
+		err := cache.options.Remote.Delete(ctx, keys...)
+		if err != nil {
+			logger.Warn("remote cache delete: ", err.Error())
+		}
+	}
+}
+
+// clear drops all rows of the in-process cache
+func (cache *rowCache) clear() {
+	cache.mx.Lock()
+	defer cache.mx.Unlock()
+	cache.generation.Add(1)
+	cache.entries = make(map[string]*list.Element)
+	cache.lru.Init()
+}
+
+// cacheKey returns the cache key of the row with primary key values by column name, ok is false if
+// values do not contain the whole primary key
+func (table *Table) cacheKey(values map[string]interface{}) (string, bool) {
+	keys := table.cacheColumns()
+	if len(keys) == 0 {
+		return "", false
+	}
+	parts := make([]string, len(keys)+1)
+	parts[0] = "eplidr:" + table.name
+	for i, key := range keys {
+		value, ok := values[strings.ToLower(key)]
+		if !ok {
+			return "", false
+		}
+		parts[i+1] = strconv.Quote(table.cacheKeyValue(key, value))
+	}
+	return strings.Join(parts, ":"), true
+}
+
+// cacheKeyValue encodes value of the column name independently of its Go type, so a key given by the
+// caller and the same key read from the database are equal. Binary values are hex like hexArg encodes them.
+func (table *Table) cacheKeyValue(name string, value interface{}) string {
+	if field := table.getField(name); field != nil {
+		t := field.GetType()
+		if t == TypeUUID {
+			return fmt.Sprintf("%v", uuidArg(value))
+		}
+		switch t.GetBasicType() {
+		case BasicTypeVarByte, BasicTypeBinary:
+			return strings.ToLower(fmt.Sprintf("%v", hexArg(value)))
+		}
+	}
+	return fmt.Sprintf("%v", normalizeArg(value))
+}
+
+// cacheColumns returns the columns identifying cached rows
+func (table *Table) cacheColumns() []string {
+	if len(table.cache.keys) != 0 {
+		return table.cache.keys
+	}
+	return table.primaryKeys()
+}
+
+// whereCacheKey returns the cache key of the row selected by where, exact requires where to have only
+// primary key columns
+func (table *Table) whereCacheKey(where Condition, exact bool) (string, bool) {
+	keys, ok := where.(Keys)
+	if !ok {
+		return "", false
+	}
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		values[strings.ToLower(key.Name)] = key.Value
+	}
+	if exact && len(values) != len(table.cacheColumns()) {
+		return "", false
+	}
+	return table.cacheKey(values)
+}
+
+// getCached is Get through the cache, ok is false if where does not select a row by primary key
+func (table *Table) getCached(ctx context.Context, shardKey interface{}, where Condition, columns SelectColumns) (err error, found bool, ok bool) {
+	key, ok := table.whereCacheKey(where, true)
+	if !ok {
+		return nil, false, false
+	}
+	row, err := table.cache.row(ctx, key, func(ctx context.Context) (*cachedRow, error) {
+		return table.loadRow(ctx, shardKey, where)
+	})
+	if err != nil {
+		return err, false, true
+	}
+	if !row.Found {
+		return nil, false, true
+	}
+	for _, column := range columns {
+		value, selected := row.Values[strings.ToLower(column.Name)]
+		if !selected {
+			return notSelected(column.Name), true, true
+		}
+		err = assignValue(column.Output, value)
+		if err != nil {
+			return fmt.Errorf("eplidr: column %s: %w", column.Name, err), true, true
+		}
+	}
+	return nil, true, true
+}
+
+// loadRow selects all columns of the row from the primary, replicas may not have the latest writes
+func (table *Table) loadRow(ctx context.Context, shardKey interface{}, where Condition) (*cachedRow, error) {
+	shard := table.shard(shardKey)
+	var result *FullSelectResult
+	err := shard.retry(ctx, true, func() (err error) {
+		result, err = shard.fullSelect(ctx, shard.driver, where, SelectOptions{Limit: 1})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	row := &cachedRow{Values: make(map[string]interface{}, len(result.fields))}
+	if len(result.cache) == 0 {
+		return row, nil
+	}
+	row.Found = true
+	for i, field := range result.fields {
+		row.Values[strings.ToLower(field.GetName())] = result.cache[0][i]
+	}
+	return row, nil
+}
+
+// invalidateWhere drops the row selected by where. If where does not select rows by primary key
+// the whole in-process cache is cleared and keys, returned by remoteKeys before the write, are dropped.
+func (table *Table) invalidateWhere(ctx context.Context, where Condition, keys []string) {
+	if table.cache == nil {
+		return
+	}
+	if key, ok := table.whereCacheKey(where, false); ok {
+		table.cache.invalidate(ctx, key)
+		return
+	}
+	table.cache.clear()
+	table.cache.invalidate(ctx, keys...)
+}
+
+// remoteKeys returns cache keys of rows of shard matching where if the table has a remote cache and
+// where does not select rows by primary key, these rows can not be dropped from it after the write
+func (table *Table) remoteKeys(ctx context.Context, shard *Shard, ex executor, where Condition) ([]string, error) {
+	if table.cache == nil || table.cache.options.Remote == nil {
+		return nil, nil
+	}
+	if _, ok := table.whereCacheKey(where, false); ok {
+		return nil, nil
+	}
+	result, err := shard.fullSelect(ctx, ex, where, SelectOptions{Columns: table.cacheColumns()})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(result.cache))
+	for _, row := range result.cache {
+		values := make(map[string]interface{}, len(result.fields))
+		for i, field := range result.fields {
+			values[strings.ToLower(field.GetName())] = row[i]
+		}
+		if key, ok := table.cacheKey(values); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// invalidateValues drops the row with primary key in values
+func (table *Table) invalidateValues(ctx context.Context, values Columns) {
+	if table.cache == nil {
+		return
+	}
+	byName := make(map[string]interface{}, len(values))
+	for _, value := range values {
+		byName[strings.ToLower(value.Name)] = value.Value
+	}
+	if key, ok := table.cacheKey(byName); ok {
+		table.cache.invalidate(ctx, key)
+		return
+	}
+	table.cache.clear()
+}
+
+// invalidateRows drops the rows with primary keys in values of rows
+func (table *Table) invalidateRows(ctx context.Context, rows []Columns) {
+	if table.cache == nil {
+		return
+	}
+	keys := make([]string, 0, len(rows))
+	for _, values := range rows {
+		byName := make(map[string]interface{}, len(values))
+		for _, value := range values {
+			byName[strings.ToLower(value.Name)] = value.Value
+		}
+		key, ok := table.cacheKey(byName)
+		if !ok {
+			table.cache.clear()
+			continue
+		}
+		keys = append(keys, key)
+	}
+	table.cache.invalidate(ctx, keys...)
+}
+
+// InvalidateCache drops cached rows selected by where, use it after raw statements change rows.
+// If where does not select rows by primary key, rows matching it on all shards are dropped from the remote cache.
+func (table *Table) InvalidateCache(ctx context.Context, where Condition) error {
+	var keys []string
+	for _, shard := range table.shards() {
+		shardKeys, err := table.remoteKeys(ctx, shard, shard.driver, where)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, shardKeys...)
+	}
+	table.invalidateWhere(ctx, where, keys)
+	return nil
+}
+
+// ClearCache drops all rows of the in-process cache
+func (table *Table) ClearCache() {
+	if table.cache != nil {
+		table.cache.clear()
+	}
+}
+
+// CacheStats returns counters of the cache, zero if the table has no cache
+func (table *Table) CacheStats() CacheStats {
+	if table.cache == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:       table.cache.hits.Load(),
+		RemoteHits: table.cache.remoteHits.Load(),
+		Misses:     table.cache.misses.Load(),
+		Evictions:  table.cache.evictions.Load(),
+	}
+}
+
+func init() {
+	gob.Register(uuid.UUID{})
+	gob.Register(&big.Int{})
+}
+
+// remoteRow is cachedRow encoded for RemoteCache, gob can not encode NULL values in a map
+type remoteRow struct {
+	Found  bool
+	Names  []string
+	Values []interface{}
+	Nulls  []bool
+}
+
+func encodeCachedRow(row *cachedRow) ([]byte, error) {
+	encoded := remoteRow{Found: row.Found}
+	for name, value := range row.Values {
+		encoded.Names = append(encoded.Names, name)
+		encoded.Nulls = append(encoded.Nulls, value == nil)
+		if value == nil {
+			value = false
+		}
+		encoded.Values = append(encoded.Values, value)
+	}
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(encoded)
+	return buffer.Bytes(), err
+}
+
+func decodeCachedRow(data []byte) (*cachedRow, error) {
+	var encoded remoteRow
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(encoded.Values) != len(encoded.Names) || len(encoded.Nulls) != len(encoded.Names) {
+		return nil, errors.New("eplidr: malformed cached row")
+	}
+	row := &cachedRow{Found: encoded.Found, Values: make(map[string]interface{}, len(encoded.Names))}
+	for i, name := range encoded.Names {
+		if encoded.Nulls[i] {
+			row.Values[name] = nil
+		} else {
+			row.Values[name] = encoded.Values[i]
+		}
+	}
+	return row, nil
+}
+
+var errNullValue = errors.New("eplidr: value is NULL")
+
+// assignValue stores a value of a cached row in dest like rows.Scan stores a column
+func assignValue(dest interface{}, value interface{}) error {
+	if scanner, ok := dest.(interface{ Scan(src interface{}) error }); ok {
+		switch v := value.(type) {
+		case uuid.UUID:
+			return scanner.Scan(v.String())
+		case *big.Int:
+			return scanner.Scan(v.String())
+		}
+		return scanner.Scan(value)
+	}
+	switch d := dest.(type) {
+	case *interface{}:
+		*d = value
+		return nil
+	case **big.Int:
+		if value == nil {
+			*d = nil
+			return nil
+		}
+		v, ok := value.(*big.Int)
+		if !ok {
+			return fmt.Errorf("eplidr: can not assign %T to %T", value, dest)
+		}
+		*d = new(big.Int).Set(v)
+		return nil
+	case *big.Int:
+		v, ok := value.(*big.Int)
+		if !ok {
+			return fmt.Errorf("eplidr: can not assign %T to %T", value, dest)
+		}
+		d.Set(v)
+		return nil
+	case *uuid.UUID:
+		switch v := value.(type) {
+		case uuid.UUID:
+			*d = v
+			return nil
+		case string:
+			parsed, err := uuid.Parse(v)
+			*d = parsed
+			return err
+		case []byte:
+			parsed, err := decodeUUID(v)
+			*d = parsed
+			return err
+		}
+	case *[]byte:
+		switch v := value.(type) {
+		case nil:
+			*d = nil
+			return nil
+		case []byte:
+			*d = append([]byte(nil), v...)
+			return nil
+		case string:
+			*d = []byte(v)
+			return nil
+		case uuid.UUID:
+			*d = append([]byte(nil), v[:]...)
+			return nil
+		}
+	case *string:
+		switch v := value.(type) {
+		case string:
+			*d = v
+			return nil
+		case []byte:
+			*d = string(v)
+			return nil
+		case uuid.UUID:
+			*d = v.String()
+			return nil
+		case *big.Int:
+			*d = v.String()
+			return nil
+		case nil:
+		default:
+			*d = fmt.Sprintf("%v", v)
+			return nil
+		}
+	}
+	out := reflect.ValueOf(dest)
+	if out.Kind() != reflect.Pointer || out.IsNil() {
+		return fmt.Errorf("eplidr: destination %T is not a pointer", dest)
+	}
+	out = out.Elem()
+	if out.Kind() == reflect.Pointer {
+		if value == nil {
+			out.Set(reflect.Zero(out.Type()))
+			return nil
+		}
+		target := reflect.New(out.Type().Elem())
+		err := assignValue(target.Interface(), value)
+		if err != nil {
+			return err
+		}
+		out.Set(target)
+		return nil
+	}
+	if value == nil {
+		return errNullValue
+	}
+	in := reflect.ValueOf(value)
+	switch out.Kind() {
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			out.SetString(v)
+			return nil
+		case []byte:
+			out.SetString(string(v))
+			return nil
+		}
+	case reflect.Slice:
+		if v, ok := value.([]byte); ok && out.Type().Elem().Kind() == reflect.Uint8 {
+			out.SetBytes(append([]byte(nil), v...))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if in.CanInt() {
+			if out.OverflowInt(in.Int()) {
+				return fmt.Errorf("eplidr: %v overflows %s", value, out.Type())
+			}
+			out.SetInt(in.Int())
+			return nil
+		}
+		if in.CanUint() && in.Uint() <= 1<<63-1 && !out.OverflowInt(int64(in.Uint())) {
+			out.SetInt(int64(in.Uint()))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if in.CanUint() {
+			if out.OverflowUint(in.Uint()) {
+				return fmt.Errorf("eplidr: %v overflows %s", value, out.Type())
+			}
+			out.SetUint(in.Uint())
+			return nil
+		}
+		if in.CanInt() && in.Int() >= 0 && !out.OverflowUint(uint64(in.Int())) {
+			out.SetUint(uint64(in.Int()))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case in.CanFloat():
+			out.SetFloat(in.Float())
+			return nil
+		case in.CanInt():
+			out.SetFloat(float64(in.Int()))
+			return nil
+		case in.CanUint():
+			out.SetFloat(float64(in.Uint()))
+			return nil
+		}
+	case reflect.Bool:
+		switch {
+		case in.Kind() == reflect.Bool:
+			out.SetBool(in.Bool())
+			return nil
+		case in.CanInt():
+			out.SetBool(in.Int() != 0)
+			return nil
+		}
+	}
+	if in.Type().AssignableTo(out.Type()) {
+		out.Set(in)
+		return nil
+	}
+	return fmt.Errorf("eplidr: can not assign %T to %T", value, dest)
+}
@@ -0,0 +1,247 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRemote is a RemoteCache in a map, Get blocks while blocked is not nil
+type memoryRemote struct {
+	mx      sync.Mutex
+	values  map[string][]byte
+	blocked chan struct{}
+}
+
+func newMemoryRemote() *memoryRemote {
+	return &memoryRemote{values: make(map[string][]byte)}
+}
+
+func (remote *memoryRemote) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	remote.mx.Lock()
+	blocked := remote.blocked
+	remote.mx.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+	remote.mx.Lock()
+	defer remote.mx.Unlock()
+	value, ok := remote.values[key]
+	return value, ok, nil
+}
+func (remote *memoryRemote) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	remote.mx.Lock()
+	defer remote.mx.Unlock()
+	remote.values[key] = value
+	return nil
+}
+func (remote *memoryRemote) Delete(ctx context.Context, keys ...string) error {
+	remote.mx.Lock()
+	defer remote.mx.Unlock()
+	for _, key := range keys {
+		delete(remote.values, key)
+	}
+	return nil
+}
+func (remote *memoryRemote) len() int {
+	remote.mx.Lock()
+	defer remote.mx.Unlock()
+	return len(remote.values)
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	remote := newMemoryRemote()
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields, WithCache(CacheOptions{
+		Size: 100, TTL: time.Minute, NegativeTTL: time.Minute, Remote: remote,
+	}))
+	putItems(t, table, 6)
+	for id := int64(0); id < 6; id++ {
+		cachedStatus(t, table, id)
+	}
+	if stats := table.CacheStats(); stats.Misses != 6 || remote.len() != 6 {
+		t.Fatalf("stats %+v, remote %d", stats, remote.len())
+	}
+	if status, _ := cachedStatus(t, table, 1); status != 1 || table.CacheStats().Hits != 1 {
+		t.Fatalf("status %d, stats %+v", status, table.CacheStats())
+	}
+
+	err := table.Set(int64(1), Keys{{"id", int64(1)}}, Columns{{"status", int64(5)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := cachedStatus(t, table, 1); status != 5 {
+		t.Errorf("status after Set by key %d, want 5", status)
+	}
+
+	// rows with status 2 are 2 and 5, on both shards
+	err = table.Add(int64(2), Eq("status", int64(2)), Columns{{"status", 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Add(int64(5), Eq("status", int64(2)), Columns{{"status", 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.len() != 4 {
+		t.Errorf("remote has %d rows after writes by condition, want 4", remote.len())
+	}
+	if status, _ := cachedStatus(t, table, 5); status != 12 {
+		t.Errorf("status after Add by condition %d, want 12", status)
+	}
+
+	err = table.Remove(int64(3), Keys{{"id", int64(3)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := cachedStatus(t, table, 3); found {
+		t.Error("removed row is found")
+	}
+	err = table.Put(int64(3), Columns{{"id", int64(3)}, {"status", int64(7)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, found := cachedStatus(t, table, 3); !found || status != 7 {
+		t.Errorf("cached missing row is not invalidated by Put: %d %v", status, found)
+	}
+
+	err = table.InTx(context.Background(), int64(4), func(tx *Tx) error {
+		return tx.Set(Gte("id", int64(0)), Columns{{"status", int64(9)}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := cachedStatus(t, table, 4); status != 9 {
+		t.Errorf("status after transaction %d, want 9", status)
+	}
+
+	_, err = table.GetShard(table.GetShardNum(int64(4))).Exec(`UPDATE {table} SET "status" = 20;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.InvalidateCache(context.Background(), Keys{{"id", int64(4)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := cachedStatus(t, table, 4); status != 20 {
+		t.Errorf("status after InvalidateCache %d, want 20", status)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	remote := newMemoryRemote()
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields, WithCache(CacheOptions{
+		Size: 100, TTL: time.Minute, Remote: remote,
+	}))
+	putItems(t, table, 1)
+	memoryTracer := NewMemoryTracer()
+	SetTracer(memoryTracer)
+	defer SetTracer(nil)
+
+	// the load is blocked in the remote cache until all gets wait for it
+	remote.blocked = make(chan struct{})
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		var status int64
+		err, _ := table.GetContext(leaderCtx, int64(0), Keys{{"id", int64(0)}}, SelectColumns{{"status", &status}})
+		leaderDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var status int64
+			var found bool
+			errs[i], found = table.GetContext(context.Background(), int64(0), Keys{{"id", int64(0)}}, SelectColumns{{"status", &status}})
+			if errs[i] == nil && !found {
+				errs[i] = errors.New("row is not found")
+			}
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	// the caller that started the load gives up, the others still get the row
+	cancelLeader()
+	if err := <-leaderDone; err != context.Canceled {
+		t.Errorf("canceled get returned %v", err)
+	}
+	remote.mx.Lock()
+	close(remote.blocked)
+	remote.blocked = nil
+	remote.mx.Unlock()
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	queries := 0
+	for _, span := range memoryTracer.Spans() {
+		if span.Name == "eplidr.query" {
+			queries++
+		}
+	}
+	if stats := table.CacheStats(); queries != 1 || stats.Misses != 1 {
+		t.Errorf("%d queries, stats %+v, want one load", queries, stats)
+	}
+}
+
+func TestCacheKeyEncoding(t *testing.T) {
+	table := renderTable(SQLite, TableFields{
+		DefaultTableField{Name: "id", Type: GetSizedType(BasicTypeVarByte, 16), PrimaryKey: true},
+		DefaultTableField{Name: "owner", Type: TypeUUID, PrimaryKey: true},
+	})
+	table.cache = newRowCache(CacheOptions{Size: 10, TTL: time.Minute})
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	want, ok := table.cacheKey(map[string]interface{}{"id": []byte{1, 2, 0xab}, "owner": id})
+	if !ok {
+		t.Fatal("no cache key of the whole primary key")
+	}
+	// the same key as hex and as text or bytes of the UUID, like it is read back from the database
+	for _, values := range []map[string]interface{}{
+		{"id": "0102ab", "owner": id.String()},
+		{"id": "0102AB", "owner": strings.ToUpper(id.String())},
+		{"id": []byte{1, 2, 0xab}, "owner": id[:]},
+	} {
+		if key, _ := table.cacheKey(values); key != want {
+			t.Errorf("cache key of %v is %q, want %q", values, key, want)
+		}
+	}
+}
+
+func TestCacheFlightGeneration(t *testing.T) {
+	cache := newRowCache(CacheOptions{Size: 10, TTL: time.Minute, LoadTimeout: time.Second})
+	ctx := context.Background()
+	started, release := make(chan struct{}), make(chan struct{})
+	stale := make(chan *cachedRow)
+	go func() {
+		row, _ := cache.row(ctx, "key", func(ctx context.Context) (*cachedRow, error) {
+			close(started)
+			<-release
+			return &cachedRow{Found: true, Values: map[string]interface{}{"status": int64(1)}}, nil
+		})
+		stale <- row
+	}()
+	<-started
+	cache.invalidate(ctx, "key")
+	// a miss after the invalidation does not join the load started before it
+	row, err := cache.row(ctx, "key", func(ctx context.Context) (*cachedRow, error) {
+		return &cachedRow{Found: true, Values: map[string]interface{}{"status": int64(2)}}, nil
+	})
+	if err != nil || row.Values["status"] != int64(2) {
+		t.Fatalf("row after invalidation: %v %v, want status 2", row, err)
+	}
+	close(release)
+	if row = <-stale; row.Values["status"] != int64(1) {
+		t.Errorf("load started before the invalidation returned %v", row.Values)
+	}
+	if row, ok := cache.local("key"); !ok || row.Values["status"] != int64(2) {
+		t.Errorf("cached row %v %v, want status 2", row, ok)
+	}
+}
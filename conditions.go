@@ -0,0 +1,280 @@
+package eplidr
+
+import "strings"
+
+// Condition is an expression of WHERE clause. Keys (equality of all keys) and Key are conditions too.
+// Values are bound like column values, so UUID, binary and big.Int columns are compared in their stored form.
+type Condition interface {
+	// write appends the condition to stmt
+	write(table *Table, stmt *statement)
+	// empty reports whether the condition matches all rows, WHERE clause is omitted for it
+	empty() bool
+}
+
+type comparison struct {
+	column   string
+	operator string
+	value    interface{}
+}
+
+func (c comparison) write(table *Table, stmt *statement) {
+	stmt.ident(c.column).write(" ", c.operator, " ").bind(table, c.column, c.value)
+}
+func (c comparison) empty() bool {
+	return false
+}
+
+func Eq(column string, value interface{}) Condition {
+	return comparison{column, "=", value}
+}
+func Ne(column string, value interface{}) Condition {
+	return comparison{column, "<>", value}
+}
+func Gt(column string, value interface{}) Condition {
+	return comparison{column, ">", value}
+}
+func Gte(column string, value interface{}) Condition {
+	return comparison{column, ">=", value}
+}
+func Lt(column string, value interface{}) Condition {
+	return comparison{column, "<", value}
+}
+func Lte(column string, value interface{}) Condition {
+	return comparison{column, "<=", value}
+}
+func Like(column string, pattern string) Condition {
+	return comparison{column, "LIKE", pattern}
+}
+
+type between struct {
+	column   string
+	from, to interface{}
+}
+
+func (c between) write(table *Table, stmt *statement) {
+	stmt.ident(c.column).write(" BETWEEN ").bind(table, c.column, c.from).write(" AND ").bind(table, c.column, c.to)
+}
+func (c between) empty() bool {
+	return false
+}
+
+// Between matches from <= column <= to
+func Between(column string, from interface{}, to interface{}) Condition {
+	return between{column, from, to}
+}
+
+type in struct {
+	column string
+	not    bool
+	values []interface{}
+}
+
+func (c in) write(table *Table, stmt *statement) {
+	if len(c.values) == 0 {
+		// IN () is a syntax error, an empty list matches nothing
+		if c.not {
+			stmt.write("1 = 1")
+		} else {
+			stmt.write("1 = 0")
+		}
+		return
+	}
+	stmt.ident(c.column)
+	if c.not {
+		stmt.write(" NOT")
+	}
+	stmt.write(" IN (")
+	for i, value := range c.values {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.bind(table, c.column, value)
+	}
+	stmt.write(")")
+}
+func (c in) empty() bool {
+	return false
+}
+
+func In(column string, values ...interface{}) Condition {
+	return in{column: column, values: values}
+}
+func NotIn(column string, values ...interface{}) Condition {
+	return in{column: column, not: true, values: values}
+}
+
+type isNull struct {
+	column string
+	not    bool
+}
+
+func (c isNull) write(table *Table, stmt *statement) {
+	stmt.ident(c.column)
+	if c.not {
+		stmt.write(" IS NOT NULL")
+	} else {
+		stmt.write(" IS NULL")
+	}
+}
+func (c isNull) empty() bool {
+	return false
+}
+
+func IsNull(column string) Condition {
+	return isNull{column: column}
+}
+func IsNotNull(column string) Condition {
+	return isNull{column: column, not: true}
+}
+
+type group struct {
+	operator   string
+	conditions []Condition
+}
+
+func (c group) write(table *Table, stmt *statement) {
+	written := 0
+	for _, condition := range c.conditions {
+		if condition == nil || condition.empty() {
+			continue
+		}
+		if written != 0 {
+			stmt.write(" ", c.operator, " ")
+		}
+		stmt.write("(")
+		condition.write(table, stmt)
+		stmt.write(")")
+		written++
+	}
+	if written == 0 {
+		// OR of no conditions matches nothing
+		stmt.write("1 = 0")
+	}
+}
+func (c group) empty() bool {
+	if c.operator == "OR" {
+		// a condition matching all rows makes OR match all rows
+		for _, condition := range c.conditions {
+			if condition != nil && condition.empty() {
+				return true
+			}
+		}
+		return false
+	}
+	for _, condition := range c.conditions {
+		if condition != nil && !condition.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// And matches rows matching all conditions, conditions matching all rows and nil are skipped
+func And(conditions ...Condition) Condition {
+	return group{"AND", conditions}
+}
+
+// Or matches rows matching any of conditions, nil conditions are skipped. Or of no conditions matches
+// no rows, Or with a condition matching all rows (e.g. empty Keys) matches all rows.
+func Or(conditions ...Condition) Condition {
+	return group{"OR", conditions}
+}
+
+type not struct {
+	condition Condition
+}
+
+func (c not) write(table *Table, stmt *statement) {
+	if c.condition == nil || c.condition.empty() {
+		// negation of a condition matching all rows
+		stmt.write("1 = 0")
+		return
+	}
+	stmt.write("NOT (")
+	c.condition.write(table, stmt)
+	stmt.write(")")
+}
+func (c not) empty() bool {
+	return false
+}
+
+// Not matches rows not matching condition, Not of a condition matching all rows matches no rows
+func Not(condition Condition) Condition {
+	return not{condition}
+}
+
+type raw struct {
+	query string
+	args  []interface{}
+}
+
+func (c raw) write(table *Table, stmt *statement) {
+	stmt.write(c.query)
+	stmt.args = append(stmt.args, c.args...)
+	stmt.columns = append(stmt.columns, make([]string, len(c.args))...)
+}
+func (c raw) empty() bool {
+	return c.query == ""
+}
+
+// Raw is a condition written as is, values are bound to `?` placeholders of query
+func Raw(query string, args ...interface{}) Condition {
+	return raw{query, args}
+}
+
+func (key Key) write(table *Table, stmt *statement) {
+	Eq(key.Name, key.Value).write(table, stmt)
+}
+func (key Key) empty() bool {
+	return false
+}
+
+func (keys Keys) write(table *Table, stmt *statement) {
+	for i := 0; i < len(keys); i++ {
+		if i != 0 {
+			stmt.write(" AND ")
+		}
+		keys[i].write(table, stmt)
+	}
+}
+func (keys Keys) empty() bool {
+	return len(keys) == 0
+}
+
+// writeWhere appends WHERE clause of condition to stmt
+func writeWhere(table *Table, stmt *statement, condition Condition) {
+	if condition == nil || condition.empty() {
+		return
+	}
+	stmt.write("WHERE ")
+	condition.write(table, stmt)
+}
+
+// equalValue returns the value column is compared to if condition matches only rows with column = value
+func equalValue(condition Condition, column string) (interface{}, bool) {
+	switch condition := condition.(type) {
+	case Key:
+		if strings.EqualFold(condition.Name, column) {
+			return condition.Value, true
+		}
+	case Keys:
+		for _, key := range condition {
+			if strings.EqualFold(key.Name, column) {
+				return key.Value, true
+			}
+		}
+	case comparison:
+		if condition.operator == "=" && strings.EqualFold(condition.column, column) {
+			return condition.value, true
+		}
+	case group:
+		if condition.operator == "AND" {
+			for _, condition := range condition.conditions {
+				if value, ok := equalValue(condition, column); ok {
+					return value, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
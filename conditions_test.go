@@ -0,0 +1,105 @@
+package eplidr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConditionRendering(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		want      string
+		args      []interface{}
+	}{
+		{"nil", nil, "", nil},
+		{"empty keys", Keys{}, "", nil},
+		{"empty and", And(), "", nil},
+		{"keys", Keys{{"id", 1}, {"status", 2}}, `WHERE "id" = ? AND "status" = ?`, []interface{}{1, 2}},
+		{"between", Between("id", 1, 5), `WHERE "id" BETWEEN ? AND ?`, []interface{}{1, 5}},
+		{"in", In("status", 1, 2), `WHERE "status" IN (?, ?)`, []interface{}{1, 2}},
+		{"empty in", In("status"), "WHERE 1 = 0", nil},
+		{"empty not in", NotIn("status"), "WHERE 1 = 1", nil},
+		{"and skips match-all", And(Keys{}, Eq("id", 1), nil), `WHERE ("id" = ?)`, []interface{}{1}},
+		{"or", Or(Eq("id", 1), IsNotNull("data")), `WHERE ("id" = ?) OR ("data" IS NOT NULL)`, []interface{}{1}},
+		{"empty or", Or(), "WHERE 1 = 0", nil},
+		{"or of nil", Or(nil), "WHERE 1 = 0", nil},
+		{"or with match-all", Or(Eq("id", 1), Keys{}), "", nil},
+		{"and with empty or", And(Eq("id", 1), Or()), `WHERE ("id" = ?) AND (1 = 0)`, []interface{}{1}},
+		{"not", Not(Like("name", "a%")), `WHERE NOT ("name" LIKE ?)`, []interface{}{"a%"}},
+		{"not of match-all", Not(And()), "WHERE 1 = 0", nil},
+		{"not of nil", Not(nil), "WHERE 1 = 0", nil},
+		{"raw", Raw(`"id" % ? = 0`, 2), `WHERE "id" % ? = 0`, []interface{}{2}},
+	}
+	table := renderTable(SQLite, itemFields)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmt := newStatement(SQLite)
+			writeWhere(table, stmt, test.condition)
+			if stmt.String() != test.want || !reflect.DeepEqual(stmt.args, test.args) {
+				t.Errorf("got %q %#v, want %q %#v", stmt.String(), stmt.args, test.want, test.args)
+			}
+		})
+	}
+}
+
+func TestKeysQuery(t *testing.T) {
+	keys := Keys{{"name", "it's"}, {"data", []byte{1, 2}}, {"status", nil}}
+	table := renderTable(MySQL, itemFields)
+	where, args := keys.Where(table)
+	if want := "WHERE `name` = ? AND `data` = UNHEX(?) AND `status` = ?"; where != want {
+		t.Errorf("Where = %s, want %s", where, want)
+	}
+	if want := []interface{}{"it's", "0102", nil}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Where args = %#v, want %#v", args, want)
+	}
+	if got, want := keys.Query(table), "WHERE `name` = 'it''s' AND `data` = UNHEX('0102') AND `status` = NULL"; got != want {
+		t.Errorf("Query = %s, want %s", got, want)
+	}
+	if got, want := (Column{"data", []byte{1, 2}}).GetStringValue(renderTable(SQLite, itemFields)), "X'0102'"; got != want {
+		t.Errorf("GetStringValue = %s, want %s", got, want)
+	}
+
+	db := openSQLite(t)
+	items := newSQLiteTable(t, db, "items", 1, itemFields)
+	putItems(t, items, 3)
+	var count int
+	query := `SELECT COUNT(*) FROM "items0" ` + Keys{{"name", "item"}, {"status", 1}}.Query(items)
+	if err := db.QueryRow(query).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%s matched %d rows, want 1", query, count)
+	}
+}
+
+func TestConditionMatches(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	putItems(t, table, 9)
+	tests := []struct {
+		name      string
+		condition Condition
+		want      int
+	}{
+		{"all", nil, 9},
+		{"status", Eq("status", 1), 3},
+		{"empty or", Or(), 0},
+		{"or with match-all", Or(Eq("status", 1), Keys{}), 9},
+		{"not of match-all", Not(Keys{}), 0},
+		{"not", Not(Eq("status", 1)), 6},
+		{"empty in", In("status"), 0},
+		{"empty not in", NotIn("status"), 9},
+		{"and", And(Gte("id", 3), Lt("id", 6), Ne("status", 0)), 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := table.SelectAll(test.condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(result.cache); got != test.want {
+				t.Errorf("selected %d rows, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestContextVariants(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	putItems(t, table, 4)
+	shard := table.shard(int64(2))
+
+	result, err := shard.AsyncGetInt64Context(context.Background(), Key{"id", int64(2)}, "status").Await()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found || result.Result != 2 {
+		t.Errorf("AsyncGetInt64Context = %+v, want 2", result)
+	}
+	name, err := shard.AsyncGetString(Key{"id", int64(2)}, "name").Await()
+	if err != nil || name.Result != "item" {
+		t.Errorf("AsyncGetString = %+v %v, want item", name, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = shard.AsyncGetStringContext(ctx, Key{"id", int64(2)}, "name").Await(); !errors.Is(err, context.Canceled) {
+		t.Errorf("AsyncGetStringContext with canceled ctx: %v", err)
+	}
+	if _, _, err = table.GetInt64Context(ctx, Key{"id", int64(2)}, "status"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetInt64Context with canceled ctx: %v", err)
+	}
+	if err = table.PutContext(ctx, int64(9), Columns{{"id", int64(9)}, {"status", int64(0)}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("PutContext with canceled ctx: %v", err)
+	}
+	if _, err = table.SelectAllContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("SelectAllContext with canceled ctx: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package eplidr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"strconv"
+)
+
+// encodeCursorValues encodes values keeping their types, json alone would turn []byte into string
+func encodeCursorValues(values []interface{}) (string, error) {
+	var encoded []string
+	for _, value := range values {
+		switch value := value.(type) {
+		case nil:
+			encoded = append(encoded, "n:")
+		case []byte:
+			encoded = append(encoded, "b:"+base64.StdEncoding.EncodeToString(value))
+		case string:
+			encoded = append(encoded, "s:"+value)
+		case int:
+			encoded = append(encoded, "i:"+strconv.FormatInt(int64(value), 10))
+		case int32:
+			encoded = append(encoded, "i:"+strconv.FormatInt(int64(value), 10))
+		case int64:
+			encoded = append(encoded, "i:"+strconv.FormatInt(value, 10))
+		case uint:
+			encoded = append(encoded, "u:"+strconv.FormatUint(uint64(value), 10))
+		case uint32:
+			encoded = append(encoded, "u:"+strconv.FormatUint(uint64(value), 10))
+		case uint64:
+			encoded = append(encoded, "u:"+strconv.FormatUint(value, 10))
+		case float64:
+			encoded = append(encoded, "f:"+strconv.FormatFloat(value, 'g', -1, 64))
+		case bool:
+			encoded = append(encoded, "t:"+strconv.FormatBool(value))
+		case uuid.UUID:
+			encoded = append(encoded, "U:"+value.String())
+		case *big.Int:
+			encoded = append(encoded, "B:"+value.String())
+		default:
+			return "", fmt.Errorf("eplidr: unsupported cursor value %T", value)
+		}
+	}
+	bytes, err := json.Marshal(encoded)
+	return string(bytes), err
+}
+
+func decodeCursorValues(s string) ([]interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var encoded []string
+	err := json.Unmarshal([]byte(s), &encoded)
+	if err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	for _, value := range encoded {
+		if len(value) < 2 {
+			return nil, errors.New("eplidr: malformed cursor " + s)
+		}
+		var decoded interface{}
+		switch value[:2] {
+		case "n:":
+			decoded = nil
+		case "b:":
+			decoded, err = base64.StdEncoding.DecodeString(value[2:])
+		case "s:":
+			decoded = value[2:]
+		case "i:":
+			decoded, err = strconv.ParseInt(value[2:], 10, 64)
+		case "u:":
+			decoded, err = strconv.ParseUint(value[2:], 10, 64)
+		case "f:":
+			decoded, err = strconv.ParseFloat(value[2:], 64)
+		case "t:":
+			decoded, err = strconv.ParseBool(value[2:])
+		case "U:":
+			decoded, err = uuid.Parse(value[2:])
+		case "B:":
+			var ok bool
+			decoded, ok = new(big.Int).SetString(value[2:], 10)
+			if !ok {
+				err = errors.New("eplidr: malformed cursor " + s)
+			}
+		default:
+			return nil, errors.New("eplidr: malformed cursor " + s)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, decoded)
+	}
+	return values, nil
+}
@@ -0,0 +1,74 @@
+package eplidr
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorValues(t *testing.T) {
+	values := []interface{}{
+		nil, []byte{0, 1, 255}, "a:b", int64(-5), uint64(1 << 63), 1.5, true,
+		uuid.MustParse("0b7b5a2e-5c39-4f0e-9a4b-6f3c2a1d9e8f"), big.NewInt(1234567890123),
+	}
+	encoded, err := encodeCursorValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeCursorValues(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, values) {
+		t.Errorf("decoded %#v, want %#v", decoded, values)
+	}
+	// narrower integers are decoded as 64 bit ones
+	encoded, err = encodeCursorValues([]interface{}{int32(7), uint32(8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = decodeCursorValues(encoded)
+	if err != nil || !reflect.DeepEqual(decoded, []interface{}{int64(7), uint64(8)}) {
+		t.Errorf("decoded %#v %v", decoded, err)
+	}
+	if _, err = encodeCursorValues([]interface{}{struct{}{}}); err == nil {
+		t.Error("unsupported value is encoded")
+	}
+	for _, malformed := range []string{"[", `["x"]`, `["x:1"]`, `["i:a"]`, `["B:1.5"]`} {
+		if _, err = decodeCursorValues(malformed); err == nil {
+			t.Errorf("malformed cursor %s is decoded", malformed)
+		}
+	}
+}
+
+func TestCursorOrder(t *testing.T) {
+	table := renderTable(SQLite, itemFields)
+	order := SelectOptions{OrderBy: []OrderBy{{Column: "status", Desc: true}}}
+	token, err := encodeCursor(order.order(table), []interface{}{int64(2), int64(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := order
+	options.After = token
+	after, err := options.after(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := newStatement(SQLite)
+	writeWhere(table, stmt, after)
+	want := `WHERE (("status" < ?)) OR (("status" = ?) AND ("id" > ?))`
+	if stmt.String() != want || !reflect.DeepEqual(stmt.args, []interface{}{int64(2), int64(2), int64(5)}) {
+		t.Errorf("got %q %v, want %q", stmt.String(), stmt.args, want)
+	}
+	options.OrderBy = []OrderBy{{Column: "status"}}
+	if _, err = options.after(table); err == nil {
+		t.Error("cursor of another order is accepted")
+	}
+	options.After = "not a cursor"
+	if _, err = options.after(table); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got %v, want ErrInvalidCursor", err)
+	}
+}
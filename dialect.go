@@ -0,0 +1,187 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect owns everything that differs between SQL databases
+type Dialect interface {
+	Name() string
+	// QuoteIdentifier quotes table, column or index name
+	QuoteIdentifier(name string) string
+	// QuoteString returns s as a string literal, it is used in DDL where placeholders are not allowed
+	QuoteString(s string) string
+	// QuoteBytes returns b as a binary literal
+	QuoteBytes(b []byte) string
+	// Rebind converts `?` placeholders of query to the dialect placeholders
+	Rebind(query string) string
+	// ColumnType returns column type used in CREATE TABLE for t
+	ColumnType(t Type) string
+	// SameType reports whether the described column type (as returned by DescribeTable) is t
+	SameType(t Type, described string) bool
+	// EncodeValue returns placeholder expression and arg for v stored in a column of type t
+	EncodeValue(t Type, v interface{}) (string, interface{})
+	// DecodeColumn returns select expression reading quoted column of type t
+	DecodeColumn(t Type, column string) string
+	// UUIDSortKey returns bytes of id that sort like ORDER BY sorts UUID columns
+	UUIDSortKey(id uuid.UUID) []byte
+	// Upsert returns clause appended to INSERT that updates columns if row with same keys exists,
+	// it is empty if there are no keys
+	Upsert(keys []string, columns []string) string
+	// TableExists returns query (and its args) that returns a row if table exists
+	TableExists(table string) (string, []interface{})
+	// DescribeTable returns the current schema of table
+	DescribeTable(db *sql.DB, table string) (*TableDescription, error)
+	// IndexName returns name of the index on column of table
+	IndexName(table string, column string) string
+	// DropIndex returns statement that drops index of table
+	DropIndex(table string, index string) string
+	// ModifyColumn returns statements that change the existing column to field
+	ModifyColumn(table string, field DefaultTableField) []string
+	// AlterPrimaryKey returns statements that replace the primary key of table
+	AlterPrimaryKey(table string, description *TableDescription, name string, keys []string) []string
+	// Limit returns LIMIT and OFFSET clause, 0 means no limit or no offset
+	Limit(limit int, offset int) string
+	// ForUpdate returns clause appended to SELECT that locks the selected rows until the end of transaction
+	ForUpdate() string
+	// BinaryCollation reports whether strings are ordered by their bytes, as rows of shards are merged
+	BinaryCollation() bool
+	// RenameTables returns statements that rename the tables, they are executed in one transaction
+	RenameTables(renames []TableRename) []string
+	// ReplicaLag returns how far the replica db is behind its primary
+	ReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error)
+	// ErrorCode classifies an error of the dialect driver, it is CodeUnknown for other errors
+	ErrorCode(err error) ErrorCode
+}
+
+// TableOption configures Table in NewTable
+type TableOption func(table *Table)
+
+// WithDialect sets SQL dialect of table, MySQL is used by default
+func WithDialect(dialect Dialect) TableOption {
+	return func(table *Table) {
+		table.dialect = dialect
+	}
+}
+
+func quoteWith(quote string, name string) string {
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote
+}
+
+// TableRename renames table From to To
+type TableRename struct {
+	From string
+	To   string
+}
+
+// renameEach renames every table by its own ALTER TABLE, the statements are atomic in a transaction
+// of dialects with transactional DDL
+func renameEach(dialect Dialect, renames []TableRename) []string {
+	var statements []string
+	for _, rename := range renames {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", dialect.QuoteIdentifier(rename.From), dialect.QuoteIdentifier(rename.To)))
+	}
+	return statements
+}
+
+// defaultLiteral returns DefaultValue v as SQL, strings are quoted and DefaultExpression is written as is
+func defaultLiteral(dialect Dialect, v interface{}) string {
+	switch v := v.(type) {
+	case DefaultExpression:
+		return string(v)
+	case string:
+		return dialect.QuoteString(v)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("%v", v)
+	}
+	return dialect.QuoteString(fmt.Sprintf("%v", v))
+}
+
+// inlineValue returns the value of the column name as SQL literal instead of a placeholder and an arg
+func inlineValue(table *Table, name string, v interface{}) string {
+	placeholder, arg := encodeValue(table, name, v)
+	var literal string
+	switch arg := arg.(type) {
+	case nil:
+		literal = "NULL"
+	case []byte:
+		literal = table.dialect.QuoteBytes(arg)
+	default:
+		literal = defaultLiteral(table.dialect, arg)
+	}
+	return strings.Replace(placeholder, "?", literal, 1)
+}
+
+// rebindNumbered replaces `?` placeholders outside of quoted literals with prefix and arg number
+func rebindNumbered(query string, prefix string) string {
+	var builder strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			builder.WriteString(prefix + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+func bytesArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		bytes, err := hex.DecodeString(v)
+		if err != nil {
+			return []byte(v)
+		}
+		return bytes
+	case []byte:
+		return v
+	case big.Int:
+		return v.Bytes()
+	case *big.Int:
+		return v.Bytes()
+	case uuid.UUID:
+		return v[:]
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
+
+func sizedType(t Type) (*SizedType, bool) {
+	sized, ok := t.(*SizedType)
+	return sized, ok
+}
+
+func columnNames(dialect Dialect, names []string) string {
+	var quoted []string
+	for _, name := range names {
+		quoted = append(quoted, dialect.QuoteIdentifier(name))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,176 @@
+package eplidr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumnDefinitions(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    []string
+		index   string
+	}{
+		{MySQL, []string{
+			"`id` BIGINT primary key NOT NULL",
+			"`name` VARCHAR(32) default '' NOT NULL",
+			"`status` BIGINT NOT NULL",
+			"`data` VARBINARY(16)",
+		}, "CREATE INDEX `Istatus` ON `items0` (`status`)"},
+		{PostgreSQL, []string{
+			`"id" BIGINT primary key NOT NULL`,
+			`"name" VARCHAR(32) default '' NOT NULL`,
+			`"status" BIGINT NOT NULL`,
+			`"data" BYTEA`,
+		}, `CREATE INDEX "items0_Istatus" ON "items0" ("status")`},
+		{SQLite, []string{
+			`"id" INTEGER primary key NOT NULL`,
+			`"name" VARCHAR(32) default '' NOT NULL`,
+			`"status" INTEGER NOT NULL`,
+			`"data" BLOB`,
+		}, `CREATE INDEX "items0_Istatus" ON "items0" ("status")`},
+	}
+	for _, test := range tests {
+		t.Run(test.dialect.Name(), func(t *testing.T) {
+			for i, field := range itemFields {
+				if got := field.QueryInit(test.dialect, "items0"); got != test.want[i] {
+					t.Errorf("QueryInit of %s = %s, want %s", field.GetName(), got, test.want[i])
+				}
+			}
+			if got := itemFields[2].QueryAfter(test.dialect, "items0"); got != test.index {
+				t.Errorf("QueryAfter = %s, want %s", got, test.index)
+			}
+		})
+	}
+}
+
+func TestDefaultLiterals(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		value   interface{}
+		want    string
+	}{
+		{MySQL, `it's \`, `'it''s \\'`},
+		{PostgreSQL, `it's \`, `'it''s \'`},
+		{SQLite, "x'); DROP TABLE t; --", `'x''); DROP TABLE t; --'`},
+		{SQLite, 5, "5"},
+		{SQLite, true, "TRUE"},
+		{MySQL, DefaultExpression("CURRENT_TIMESTAMP"), "CURRENT_TIMESTAMP"},
+	}
+	for _, test := range tests {
+		if got := defaultLiteral(test.dialect, test.value); got != test.want {
+			t.Errorf("%s default %v = %s, want %s", test.dialect.Name(), test.value, got, test.want)
+		}
+	}
+}
+
+func TestUpsertWithoutKeys(t *testing.T) {
+	for _, dialect := range []Dialect{MySQL, PostgreSQL, SQLite} {
+		if got := dialect.Upsert(nil, []string{"name"}); got != "" {
+			t.Errorf("%s Upsert without keys = %q, want plain INSERT", dialect.Name(), got)
+		}
+	}
+	if got, want := renderTable(PostgreSQL, itemFields).ColumnNamesToQuery("id", "name"), ` "id", "name"`; got != want {
+		t.Errorf("ColumnNamesToQuery = %s, want %s", got, want)
+	}
+	if got, want := ColumnNamesToQuery("id", "name"), " `id`, `name`"; got != want {
+		t.Errorf("deprecated ColumnNamesToQuery = %s, want %s", got, want)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	type rendered struct {
+		query string
+		args  []interface{}
+	}
+	tests := []struct {
+		dialect Dialect
+		want    []rendered
+	}{
+		{MySQL, []rendered{
+			{"INSERT INTO {table} (`id`, `name`, `data`) values (?, ?, UNHEX(?)) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `data` = VALUES(`data`)", []interface{}{int64(1), "a", "01"}},
+			{"UPDATE {table} SET `name` = ? WHERE `id` = ?;", []interface{}{"b", int64(1)}},
+			{"UPDATE {table} SET `status` = `status` + ? WHERE `id` = ?;", []interface{}{2, int64(1)}},
+			{"DELETE FROM {table} WHERE (`id` > ?) AND ((`status` = ?) OR (`data` IS NULL));", []interface{}{1, 1}},
+			{"SELECT `name` FROM {table} WHERE `id` = ? FOR UPDATE;", []interface{}{int64(1)}},
+			{"SELECT `id`, `name`, `status`, `data` FROM {table}  ORDER BY `status` DESC, `id` ASC LIMIT 2 OFFSET 3;", nil},
+		}},
+		{PostgreSQL, []rendered{
+			{`INSERT INTO {table} ("id", "name", "data") values ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name", "data" = excluded."data"`, []interface{}{int64(1), "a", []byte{1}}},
+			{`UPDATE {table} SET "name" = $1 WHERE "id" = $2;`, []interface{}{"b", int64(1)}},
+			{`UPDATE {table} SET "status" = "status" + $1 WHERE "id" = $2;`, []interface{}{2, int64(1)}},
+			{`DELETE FROM {table} WHERE ("id" > $1) AND (("status" = $2) OR ("data" IS NULL));`, []interface{}{1, 1}},
+			{`SELECT "name" FROM {table} WHERE "id" = $1 FOR UPDATE;`, []interface{}{int64(1)}},
+			{`SELECT "id", "name", "status", "data" FROM {table}  ORDER BY "status" DESC, "id" ASC LIMIT 2 OFFSET 3;`, nil},
+		}},
+		{SQLite, []rendered{
+			{`INSERT INTO {table} ("id", "name", "data") values (?, ?, ?) ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name", "data" = excluded."data"`, []interface{}{int64(1), "a", []byte{1}}},
+			{`UPDATE {table} SET "name" = ? WHERE "id" = ?;`, []interface{}{"b", int64(1)}},
+			{`UPDATE {table} SET "status" = "status" + ? WHERE "id" = ?;`, []interface{}{2, int64(1)}},
+			{`DELETE FROM {table} WHERE ("id" > ?) AND (("status" = ?) OR ("data" IS NULL));`, []interface{}{1, 1}},
+			{`SELECT "name" FROM {table} WHERE "id" = ?;`, []interface{}{int64(1)}},
+			{`SELECT "id", "name", "status", "data" FROM {table}  ORDER BY "status" DESC, "id" ASC LIMIT 2 OFFSET 3;`, nil},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.dialect.Name(), func(t *testing.T) {
+			shard := renderTable(test.dialect, itemFields).Shards[0]
+			selectStmt, err := shard.selectStatement(nil, itemFields, SelectOptions{
+				OrderBy: []OrderBy{{Column: "status", Desc: true}},
+				Limit:   2,
+				Offset:  3,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			statements := []*statement{
+				shard.putOrUpdateStatement(Columns{{"id", int64(1)}, {"name", "a"}, {"data", []byte{1}}}),
+				shard.setStatement(Keys{{"id", int64(1)}}, Columns{{"name", "b"}}),
+				shard.addStatement(Keys{{"id", int64(1)}}, Columns{{"status", 2}}),
+				shard.removeStatement(And(Gt("id", 1), Or(Eq("status", 1), IsNull("data")))),
+				shard.getStatement(Keys{{"id", int64(1)}}, SelectColumns{{"name", nil}}, true),
+				selectStmt,
+			}
+			for i, stmt := range statements {
+				got := rendered{test.dialect.Rebind(stmt.String()), stmt.args}
+				if !reflect.DeepEqual(got, test.want[i]) {
+					t.Errorf("statement %d = %q %#v, want %q %#v", i, got.query, got.args, test.want[i].query, test.want[i].args)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteStatements(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	err := table.PutOrUpdate(int64(1), Columns{{"id", int64(1)}, {"name", "a"}, {"status", int64(1)}, {"data", []byte{1, 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.PutOrUpdate(int64(1), Columns{{"id", int64(1)}, {"name", "b"}, {"status", int64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Add(int64(1), Keys{{"id", int64(1)}}, Columns{{"status", 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	var status int64
+	var data []byte
+	err, found := table.Get(int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"name", &name}, {"status", &status}, {"data", &data}})
+	if err != nil || !found {
+		t.Fatal(err, found)
+	}
+	if name != "b" || status != 3 || !reflect.DeepEqual(data, []byte{1, 2}) {
+		t.Errorf("got %s %d %v, want b 3 [1 2]", name, status, data)
+	}
+	err = table.Remove(int64(1), Keys{{"id", int64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, found = table.Get(int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"name", &name}})
+	if err != nil || found {
+		t.Errorf("removed row: %v %v", err, found)
+	}
+}
@@ -1,16 +1,19 @@
 package eplidr
 
 import (
-	"encoding/hex"
+	"context"
 	"fmt"
 	"github.com/oppositemc/nonimus"
-	"math/big"
-	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 var (
 	shiftTableIterator int
 	pool               *nonimus.Pool
+	// poolQueued and poolRunning count tasks waiting in the pool and running in it
+	poolQueued  atomic.Int64
+	poolRunning atomic.Int64
 )
 
 func init() {
@@ -19,6 +22,64 @@ func init() {
 	pool = nonimus.NewPoolCollectorSize(2, 1000)
 }
 
+// fanOutWorkers is the maximum number of goroutines running tasks of one fanOut call
+const fanOutWorkers = 16
+
+// fanOut runs tasks in goroutines of its own and waits until all of them are done. It does not use
+// the async pool, so it can be called from Async* callbacks and does not delay other async operations.
+func fanOut(tasks ...func()) {
+	workers := len(tasks)
+	if workers > fanOutWorkers {
+		workers = fanOutWorkers
+	}
+	queue := make(chan func())
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				task()
+			}
+		}()
+	}
+	for _, task := range tasks {
+		queue <- task
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// async runs f in the pool, the promise is rejected with ctx error if ctx is done before f starts.
+// The time f waits for a worker is traced by an eplidr.pool.wait span.
+func async[T any](ctx context.Context, f func() (T, error)) *nonimus.Promise[T] {
+	_, wait := tracer.Start(ctx, "eplidr.pool.wait")
+	poolQueued.Add(1)
+	// a promise never settles if it is resolved without Then or rejected without Catch,
+	// f starts after they are set, so Await works without them
+	ready := make(chan struct{})
+	promise := nonimus.AddPromise(pool, func(resolve func(T), reject func(error)) {
+		<-ready
+		wait.End()
+		poolQueued.Add(-1)
+		poolRunning.Add(1)
+		defer poolRunning.Add(-1)
+		if err := ctx.Err(); err != nil {
+			reject(err)
+			return
+		}
+		result, err := f()
+		if err != nil {
+			reject(err)
+			return
+		}
+		resolve(result)
+	})
+	promise.Then(func(T) {}).Catch(func(error) {})
+	close(ready)
+	return promise
+}
+
 type Column struct { // Make column an interface
 	Name  string
 	Value interface{}
@@ -52,87 +113,74 @@ func (s SelectColumns) Query(table *Table) string {
 		if field == nil {
 			continue
 		}
-		switch field.GetType() {
-		case TypeUUID:
-			result += fmt.Sprintf("BIN_TO_UUID(%s, true) AS %s,", name, name)
-		default:
-			result += fmt.Sprintf("`%s`,", name)
-		}
+		result += selectColumn(table.dialect, field) + ","
 	}
 	return result[:len(result)-1]
 }
 
+// Where returns WHERE clause with placeholders and args for it
+func (keys Keys) Where(table *Table) (string, []interface{}) {
+	stmt := &statement{dialect: table.dialect}
+	writeWhere(table, stmt, keys)
+	return stmt.String(), stmt.args
+}
+
+// Query returns WHERE clause with the values written as literals.
+//
+// Deprecated: use Where, it passes the values as args.
 func (keys Keys) Query(table *Table) string {
-	if len(keys) == 0 {
-		return ""
-	}
-	query := "WHERE "
-	for i := 0; i < len(keys); i++ {
-		if i == len(keys)-1 {
-			query += fmt.Sprintf("`%s` = %s", keys[i].Name, keys[i].GetStringValue(table))
+	query := ""
+	for i, key := range keys {
+		if i == 0 {
+			query += "WHERE "
 		} else {
-			query += fmt.Sprintf("`%s` = %s AND ", keys[i].Name, keys[i].GetStringValue(table))
+			query += " AND "
 		}
+		query += table.dialect.QuoteIdentifier(key.Name) + " = " + key.GetStringValue(table)
 	}
 	return query
 }
-func (key Key) GetStringValue(table *Table) string {
-	if table.getField(key.Name) == nil {
-		logger.Debug(table.name)
-		logger.Debug(key.Name)
-	}
-	if table.getField(key.Name).GetType().GetBasicType() == BasicTypeVarChar {
-		return fmt.Sprintf("'%s'", key.Value)
-	} else if table.getField(key.Name).GetType() == TypeUUID {
-		return fmt.Sprintf("UUID_TO_BIN('%s', true)", key.Value)
-	} else if table.getField(key.Name).GetType().GetBasicType() == BasicTypeVarByte {
-		return fmt.Sprintf("UNHEX(%s)", value(key.Value))
-	} else if table.getField(key.Name).GetType().GetBasicType() == BasicTypeBinary {
-		return fmt.Sprintf("UNHEX(%s)", value(key.Value))
-	} else {
-		return value(key.Value)
-	}
 
+// GetStringValue returns key value as SQL literal.
+//
+// Deprecated: use Placeholder, it passes the value as arg.
+func (key Key) GetStringValue(table *Table) string {
+	return inlineValue(table, key.Name, key.Value)
 }
+
+// GetStringValue returns column value as SQL literal.
+//
+// Deprecated: use Placeholder, it passes the value as arg.
 func (column Column) GetStringValue(table *Table) string {
-	if table.getField(column.Name).GetType().GetBasicType() == BasicTypeVarChar {
-		return fmt.Sprintf("'%s'", column.Value)
-	} else if table.getField(column.Name).GetType() == TypeUUID {
-		return fmt.Sprintf("UUID_TO_BIN('%s', true)", column.Value)
-	} else if table.getField(column.Name).GetType().GetBasicType() == BasicTypeVarByte {
-		return fmt.Sprintf("UNHEX(%s)", value(column.Value))
-	} else if table.getField(column.Name).GetType().GetBasicType() == BasicTypeBinary {
-		return fmt.Sprintf("UNHEX(%s)", value(column.Value))
-	} else {
-		return value(column.Value)
-	}
+	return inlineValue(table, column.Name, column.Value)
 }
 
-func value(i interface{}) string {
-	switch v := i.(type) {
-	case string:
-		return fmt.Sprintf("'%s'", v)
-	case []interface{}: // Serialize s
-		return fmt.Sprintf("'%v'", v[0])
-	case int64:
-		return strconv.FormatInt(v, 10)
-	case big.Int:
-		//logger.Debug(v.String(), hex.EncodeToString(v.Bytes()))
-		return fmt.Sprintf("'%s'", hex.EncodeToString(v.Bytes()))
-	case *big.Int:
-		//logger.Debug(v.String(), hex.EncodeToString(v.Bytes()))
-		return fmt.Sprintf("'%s'", hex.EncodeToString(v.Bytes()))
-	case float64:
-		return fmt.Sprintf("%f", v)
-	default:
-		return fmt.Sprintf("%v", v)
-	}
+// Placeholder returns placeholder expression and arg for key value
+func (key Key) Placeholder(table *Table) (string, interface{}) {
+	return encodeValue(table, key.Name, key.Value)
+}
+
+// Placeholder returns placeholder expression and arg for column value
+func (column Column) Placeholder(table *Table) (string, interface{}) {
+	return encodeValue(table, column.Name, column.Value)
 }
 
+// ColumnNamesToQuery returns names quoted for MySQL.
+//
+// Deprecated: use Table.ColumnNamesToQuery, it quotes names for the dialect of the table.
 func ColumnNamesToQuery(names ...string) string {
+	return columnNamesToQuery(MySQL, names)
+}
+
+// ColumnNamesToQuery returns names quoted for the dialect of the table
+func (table *Table) ColumnNamesToQuery(names ...string) string {
+	return columnNamesToQuery(table.dialect, names)
+}
+
+func columnNamesToQuery(dialect Dialect, names []string) string {
 	result := ""
 	for i := 0; i < len(names); i++ {
-		result += " `" + names[i] + "`,"
+		result += " " + dialect.QuoteIdentifier(names[i]) + ","
 	}
 	return result[:len(result)-1]
 }
@@ -0,0 +1,87 @@
+package eplidr
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+var itemFields = TableFields{
+	DefaultTableField{Name: "id", Type: TypeInt64, PrimaryKey: true},
+	DefaultTableField{Name: "name", Type: GetSizedType(BasicTypeVarChar, 32), DefaultValue: ""},
+	DefaultTableField{Name: "status", Type: TypeInt64, Index: true},
+	DefaultTableField{Name: "data", Type: GetSizedType(BasicTypeVarByte, 16), Nullable: true},
+}
+
+// openSQLite opens a SQLite database in a file of the test, shards of a table are tables of it
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// newSQLiteTable creates table name with shardsCount shards in db
+func newSQLiteTable(t *testing.T, db *sql.DB, name string, shardsCount uint, fields TableFields, options ...TableOption) *Table {
+	t.Helper()
+	table, err := NewTable(name, shardsCount, fields, db, append([]TableOption{WithDialect(SQLite)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(table.StopHealthCheck)
+	return table
+}
+
+// renderTable returns table of dialect that is not connected, it only renders statements
+func renderTable(dialect Dialect, fields TableFields) *Table {
+	table := &Table{
+		name:        "items",
+		fields:      fields,
+		fieldsMap:   make(map[FieldName]TableField),
+		shardsCount: 1,
+		router:      ModuloRouter{Hash: StandardGetShardFunc},
+		dialect:     dialect,
+	}
+	for _, field := range fields {
+		table.fieldsMap[FieldName(strings.ToLower(field.GetName()))] = field
+	}
+	table.Shards = []*Shard{{table: table, name: table.GetName(0)}}
+	return table
+}
+
+func putItems(t *testing.T, table *Table, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		err := table.Put(int64(i), Columns{{"id", int64(i)}, {"name", "item"}, {"status", int64(i % 3)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func selectedIDs(t *testing.T, result *FullSelectResult) []int64 {
+	t.Helper()
+	var ids []int64
+	for result.Next() {
+		ids = append(ids, result.GetInt64("id"))
+	}
+	return ids
+}
+
+func cachedStatus(t *testing.T, table *Table, id int64) (int64, bool) {
+	t.Helper()
+	var status int64
+	err, found := table.Get(id, Keys{{"id", id}}, SelectColumns{{"status", &status}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, found
+}
@@ -1,10 +1,49 @@
 package eplidr
 
-// TODO error handling
-// Ideas: parse SQL error, return own error on validating data, BTW eplidr.Error implements error interface!
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
 
 type ErrorCode int
 
+const (
+	CodeUnknown ErrorCode = iota
+	// CodeNotFound is sql.ErrNoRows of QueryRow, Get reports a missing row by found instead
+	CodeNotFound
+	CodeDuplicateKey
+	CodeDeadlock
+	CodeLockTimeout
+	CodeUnknownColumn
+	CodeConnection
+	CodeValidation
+	CodeShardUnavailable
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	CodeUnknown:          "unknown",
+	CodeNotFound:         "not_found",
+	CodeDuplicateKey:     "duplicate_key",
+	CodeDeadlock:         "deadlock",
+	CodeLockTimeout:      "lock_timeout",
+	CodeUnknownColumn:    "unknown_column",
+	CodeConnection:       "connection",
+	CodeValidation:       "validation",
+	CodeShardUnavailable: "shard_unavailable",
+}
+
+func (code ErrorCode) String() string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 type Error struct {
 	Code    ErrorCode
 	Message string
@@ -14,4 +53,114 @@ func (err Error) Error() string {
 	return err.Message
 }
 
-const ()
+// Is matches errors with the same code, errors.Is(err, ErrDeadlock) holds for every deadlock
+func (err Error) Is(target error) bool {
+	other, ok := target.(Error)
+	return ok && other.Code == err.Code
+}
+
+var (
+	ErrDuplicateKey  = Error{CodeDuplicateKey, "eplidr: duplicate key"}
+	ErrDeadlock      = Error{CodeDeadlock, "eplidr: deadlock"}
+	ErrLockTimeout   = Error{CodeLockTimeout, "eplidr: lock wait timeout"}
+	ErrUnknownColumn = Error{CodeUnknownColumn, "eplidr: unknown column"}
+	ErrConnection    = Error{CodeConnection, "eplidr: connection failed"}
+	ErrValidation    = Error{CodeValidation, "eplidr: validation failed"}
+	// ErrShardUnavailable is returned without executing statements on a shard that is unhealthy
+	ErrShardUnavailable = Error{CodeShardUnavailable, "eplidr: shard is unavailable"}
+)
+
+// QueryError is an error of a statement executed on a shard, it wraps the driver error
+type QueryError struct {
+	Table string
+	Shard uint
+	// Op is the method of the table that executed the statement
+	Op   Operation
+	Code ErrorCode
+	Err  error
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("eplidr: %s on %s shard %d: %s", err.Op, err.Table, err.Shard, err.Err.Error())
+}
+
+func (err *QueryError) Unwrap() error {
+	return err.Err
+}
+
+// Is matches Error sentinels with the code of the error
+func (err *QueryError) Is(target error) bool {
+	other, ok := target.(Error)
+	return ok && err.Code != CodeUnknown && other.Code == err.Code
+}
+
+// queryError wraps err of a statement of op executed on shard, nil stays nil
+func (shard *Shard) queryError(op Operation, err error) error {
+	if err == nil {
+		return nil
+	}
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return err
+	}
+	return &QueryError{
+		Table: shard.table.name,
+		Shard: shard.num,
+		Op:    op,
+		Code:  classifyError(shard.table.dialect, err),
+		Err:   err,
+	}
+}
+
+// queryOp returns the first keyword of query in lower case
+func queryOp(query string) string {
+	op := strings.TrimLeft(query, " \t\n(")
+	if i := strings.IndexAny(op, " \t\n;("); i != -1 {
+		op = op[:i]
+	}
+	return strings.ToLower(op)
+}
+
+// errorCode classifies err by the driver error it wraps, it is tried with every dialect
+func errorCode(err error) ErrorCode {
+	return classifyError(nil, err)
+}
+
+// classifyError classifies err by the driver error it wraps with dialect, every dialect is tried if it is nil
+func classifyError(dialect Dialect, err error) ErrorCode {
+	var own Error
+	if errors.As(err, &own) {
+		return own.Code
+	}
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return queryErr.Code
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return CodeValidation
+	}
+	dialects := []Dialect{dialect}
+	if dialect == nil {
+		dialects = []Dialect{MySQL, PostgreSQL, SQLite}
+	}
+	for _, dialect := range dialects {
+		if code := dialect.ErrorCode(err); code != CodeUnknown {
+			return code
+		}
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return CodeNotFound
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return CodeConnection
+	}
+	return CodeUnknown
+}
+
+// isDeadlock reports whether err is a deadlock or serialization failure
+func isDeadlock(err error) bool {
+	return errorCode(err) == CodeDeadlock
+}
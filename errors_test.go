@@ -0,0 +1,66 @@
+package eplidr
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"testing"
+)
+
+type sqlStateError string
+
+func (err sqlStateError) Error() string {
+	return "pq: " + string(err)
+}
+
+func (err sqlStateError) SQLState() string {
+	return string(err)
+}
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}, ErrDuplicateKey},
+		{fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1213}), ErrDeadlock},
+		{&mysql.MySQLError{Number: 1205}, ErrLockTimeout},
+		{mysql.ErrInvalidConn, ErrConnection},
+		{sqlStateError("40P01"), ErrDeadlock},
+		{sqlStateError("42703"), ErrUnknownColumn},
+		{sqlStateError("08006"), ErrConnection},
+		{driver.ErrBadConn, ErrConnection},
+	}
+	for _, test := range tests {
+		if code := errorCode(test.err); code != test.want.(Error).Code {
+			t.Errorf("%v: code %s, want %s", test.err, code, test.want.(Error).Code)
+		}
+	}
+	// a message of another driver mentioning a MySQL error number is not classified by it
+	if code := errorCode(errors.New("Error 1213: deadlock")); code != CodeUnknown {
+		t.Errorf("plain error is classified as %s", code)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	putItems(t, table, 2)
+
+	err := table.Put(int64(1), Columns{{"id", int64(1)}, {"name", "item"}, {"status", int64(0)}})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("duplicate put: %v, want ErrDuplicateKey", err)
+	}
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) {
+		t.Fatalf("%T is not QueryError", err)
+	}
+	if queryErr.Op != OpPut || queryErr.Table != "items" || queryErr.Shard != table.GetShardNum(int64(1)) {
+		t.Errorf("QueryError %s on %s shard %d", queryErr.Op, queryErr.Table, queryErr.Shard)
+	}
+
+	_, err = table.GetShard(0).Exec(`SELECT missing FROM {table};`)
+	if !errors.Is(err, ErrUnknownColumn) || !errors.As(err, &queryErr) || queryErr.Op != OpExec {
+		t.Errorf("select of a missing column: %v", err)
+	}
+}
@@ -8,9 +8,10 @@ type FieldName string
 type TableFields []TableField
 type TableField interface {
 	GetName() string
-	QueryInit(table string) string
-	QueryAfter(table string) string
-	QueryAlter(table string) string
+	QueryInit(dialect Dialect, table string) string
+	QueryAfter(dialect Dialect, table string) string
+	// QueryAlter returns statements that bring the existing table to this field
+	QueryAlter(dialect Dialect, table string, description *TableDescription) []string
 	GetType() Type
 }
 
@@ -21,6 +22,20 @@ type DefaultTableField struct {
 	PrimaryKey   bool
 	DefaultValue interface{}
 	Nullable     bool
+	// Sensitive values are redacted by QueryLogger
+	Sensitive bool
+}
+
+// DefaultExpression is a DefaultValue written to SQL as is, e.g. CURRENT_TIMESTAMP
+type DefaultExpression string
+
+// SensitiveField is a TableField whose values may be sensitive
+type SensitiveField interface {
+	IsSensitive() bool
+}
+
+func (f DefaultTableField) IsSensitive() bool {
+	return f.Sensitive
 }
 
 func (f DefaultTableField) GetName() string {
@@ -31,9 +46,16 @@ func (f DefaultTableField) GetType() Type {
 	return f.Type
 }
 
+// DefaultValueQuery returns the default clause with MySQL quoting.
+//
+// Deprecated: definitions render DefaultValue with the dialect of the table.
 func (f DefaultTableField) DefaultValueQuery() string {
+	return f.defaultQuery(MySQL)
+}
+
+func (f DefaultTableField) defaultQuery(dialect Dialect) string {
 	if f.DefaultValue != nil {
-		return fmt.Sprintf(" default %v", f.DefaultValue)
+		return " default " + defaultLiteral(dialect, f.DefaultValue)
 	} else {
 		return ""
 	}
@@ -47,21 +69,57 @@ func (f DefaultTableField) PrimaryKeyQuery() string {
 	}
 }
 
-func (f DefaultTableField) QueryInit(table string) string {
+func (f DefaultTableField) QueryInit(dialect Dialect, table string) string {
+	return f.definition(dialect, f.PrimaryKeyQuery())
+}
+
+func (f DefaultTableField) definition(dialect Dialect, primaryKey string) string {
 	if f.Nullable {
-		return fmt.Sprintf("`%s` %s%s%s", f.Name, f.Type.Query(), f.PrimaryKeyQuery(), f.DefaultValueQuery())
+		return fmt.Sprintf("%s %s%s%s", dialect.QuoteIdentifier(f.Name), dialect.ColumnType(f.Type), primaryKey, f.defaultQuery(dialect))
 	}
-	return fmt.Sprintf("`%s` %s%s%s %s", f.Name, f.Type.Query(), f.PrimaryKeyQuery(), f.DefaultValueQuery(), "NOT NULL")
+	return fmt.Sprintf("%s %s%s%s %s", dialect.QuoteIdentifier(f.Name), dialect.ColumnType(f.Type), primaryKey, f.defaultQuery(dialect), "NOT NULL")
 }
-func (f DefaultTableField) QueryAfter(table string) string {
+
+func (f DefaultTableField) QueryAfter(dialect Dialect, table string) string {
 	if f.Index {
-		return fmt.Sprintf("CREATE INDEX I%s ON %s (%s)", f.Name, table, f.Name)
+		return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", dialect.QuoteIdentifier(dialect.IndexName(table, f.Name)),
+			dialect.QuoteIdentifier(table), dialect.QuoteIdentifier(f.Name))
 	} else {
 		return ""
 	}
 }
-func (f DefaultTableField) QueryAlter(table string) string {
-	return "" // TODO
+func (f DefaultTableField) QueryAlter(dialect Dialect, table string, description *TableDescription) []string {
+	var queries []string
+	column, ok := description.getColumn(f.Name)
+	if !ok {
+		queries = append(queries, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", dialect.QuoteIdentifier(table), f.QueryInit(dialect, table)))
+	} else if !f.matches(dialect, column) {
+		queries = append(queries, dialect.ModifyColumn(table, f)...)
+	}
+	if ok && f.PrimaryKey && !description.isPrimaryKey([]string{f.Name}) {
+		queries = append(queries, dialect.AlterPrimaryKey(table, description, "", []string{f.Name})...)
+	}
+	index := dialect.IndexName(table, f.Name)
+	if f.Index && !description.hasIndex(index) {
+		queries = append(queries, f.QueryAfter(dialect, table))
+	} else if !f.Index && description.hasIndex(index) {
+		queries = append(queries, dialect.DropIndex(table, index))
+	}
+	return queries
+}
+
+// matches reports whether the existing column has the declared type, nullability and default
+func (f DefaultTableField) matches(dialect Dialect, column ColumnDescription) bool {
+	if !dialect.SameType(f.Type, column.Type) {
+		return false
+	}
+	if !f.PrimaryKey && f.Nullable != column.Nullable {
+		return false
+	}
+	if f.DefaultValue == nil {
+		return !column.Default.Valid
+	}
+	return column.Default.Valid && normalizeDefault(fmt.Sprintf("%v", f.DefaultValue)) == normalizeDefault(column.Default.String)
 }
 
 type SConstraintPrimaryKey struct {
@@ -76,14 +134,18 @@ func (f SConstraintPrimaryKey) GetType() Type {
 	return TypeNone
 }
 
-func (f SConstraintPrimaryKey) QueryInit(table string) string {
-	return fmt.Sprintf("CONSTRAINT %s PRIMARY KEY (%s)", f.GetName(), PlainList(f.Keys))
+// QueryInit does not name the constraint, PostgreSQL requires constraint names to be unique per schema
+func (f SConstraintPrimaryKey) QueryInit(dialect Dialect, table string) string {
+	return fmt.Sprintf("PRIMARY KEY (%s)", columnNames(dialect, f.Keys))
 }
-func (f SConstraintPrimaryKey) QueryAfter(table string) string {
+func (f SConstraintPrimaryKey) QueryAfter(dialect Dialect, table string) string {
 	return ""
 }
-func (f SConstraintPrimaryKey) QueryAlter(table string) string {
-	return "" // TODO
+func (f SConstraintPrimaryKey) QueryAlter(dialect Dialect, table string, description *TableDescription) []string {
+	if description.isPrimaryKey(f.Keys) {
+		return nil
+	}
+	return dialect.AlterPrimaryKey(table, description, "", f.Keys)
 }
 
 func ConstraintPrimaryKey(keys ...string) SConstraintPrimaryKey {
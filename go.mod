@@ -3,6 +3,17 @@ module github.com/oppositemc/eplidr
 go 1.20
 
 require (
+	github.com/go-sql-driver/mysql v1.7.1
 	github.com/google/uuid v1.3.0
 	github.com/oppositemc/nonimus v0.0.0-20230628111146-5bb40f55730e
+	modernc.org/sqlite v1.20.0
+)
+
+require (
+	github.com/mattn/go-isatty v0.0.16 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20200410134404-eec4a21b6bb0 // indirect
+	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
+	modernc.org/libc v1.21.5 // indirect
+	modernc.org/mathutil v1.5.0 // indirect
+	modernc.org/memory v1.4.0 // indirect
 )
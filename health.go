@@ -0,0 +1,282 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// HealthOptions configure health checking of the shards of a Table. A shard failing FailureThreshold
+// times in a row with a connection error or failed ping is unhealthy: its statements fail fast with
+// ErrShardUnavailable until OpenTimeout passes, then one statement or ping probes it.
+type HealthOptions struct {
+	// Interval between pings of every shard
+	Interval time.Duration
+	// Timeout of a ping
+	Timeout          time.Duration
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// ProbeTimeout is how long a probe may run before another statement or ping probes the shard,
+	// OpenTimeout is used if it is 0
+	ProbeTimeout time.Duration
+}
+
+var DefaultHealthOptions = HealthOptions{
+	Interval:         5 * time.Second,
+	Timeout:          time.Second,
+	FailureThreshold: 3,
+	OpenTimeout:      10 * time.Second,
+	ProbeTimeout:     10 * time.Second,
+}
+
+// WithHealthCheck pings shards of the table in background and enables their circuit breakers,
+// Table.StopHealthCheck stops the pings
+func WithHealthCheck(options HealthOptions) TableOption {
+	return func(table *Table) {
+		table.health = options
+	}
+}
+
+type ShardState int
+
+const (
+	// ShardHealthy shard executes statements
+	ShardHealthy ShardState = iota
+	// ShardUnhealthy shard fails statements fast
+	ShardUnhealthy
+	// ShardProbing shard is unhealthy and a probe is executing on it
+	ShardProbing
+)
+
+func (state ShardState) String() string {
+	switch state {
+	case ShardUnhealthy:
+		return "unhealthy"
+	case ShardProbing:
+		return "probing"
+	}
+	return "healthy"
+}
+
+// ShardHealth is the state of a shard reported by Table.Health
+type ShardHealth struct {
+	Shard uint
+	Name  string
+	State ShardState
+	// Latency of the last ping
+	Latency   time.Duration
+	LastCheck time.Time
+	// LastError is the last connection error or failed ping, nil if the shard has not failed
+	LastError error
+}
+
+// breaker is a circuit breaker of a shard, the zero value is a healthy shard
+type breaker struct {
+	mx        sync.Mutex
+	state     ShardState
+	failures  int
+	openedAt  time.Time
+	probedAt  time.Time
+	latency   time.Duration
+	lastCheck time.Time
+	lastError error
+}
+
+// copyFrom sets the state of b to the state of other
+func (b *breaker) copyFrom(other *breaker) {
+	other.mx.Lock()
+	state, failures, openedAt, probedAt := other.state, other.failures, other.openedAt, other.probedAt
+	latency, lastCheck, lastError := other.latency, other.lastCheck, other.lastError
+	other.mx.Unlock()
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.state, b.failures, b.openedAt, b.probedAt = state, failures, openedAt, probedAt
+	b.latency, b.lastCheck, b.lastError = latency, lastCheck, lastError
+}
+
+// allow returns ErrShardUnavailable if statements of the shard must fail fast
+func (shard *Shard) allow() error {
+	options := shard.table.health
+	if options.Interval <= 0 {
+		return nil
+	}
+	b := &shard.breaker
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	switch b.state {
+	case ShardUnhealthy:
+		if time.Since(b.openedAt) < options.OpenTimeout {
+			return ErrShardUnavailable
+		}
+		b.state = ShardProbing
+		b.probedAt = time.Now()
+		return nil
+	case ShardProbing:
+		probeTimeout := options.ProbeTimeout
+		if probeTimeout <= 0 {
+			probeTimeout = options.OpenTimeout
+		}
+		if time.Since(b.probedAt) < probeTimeout {
+			return ErrShardUnavailable
+		}
+		// the probe hangs, it is replaced by this statement
+		b.probedAt = time.Now()
+		return nil
+	}
+	return nil
+}
+
+// record updates the breaker with the result of a statement. Connection errors and timeouts are failures,
+// other errors are returned by a reachable database.
+func (shard *Shard) record(err error) {
+	switch {
+	case err == nil:
+		shard.recordSuccess()
+	case errors.Is(err, context.Canceled):
+		shard.recordCanceled()
+	case errorCode(err) == CodeConnection || errors.Is(err, context.DeadlineExceeded):
+		shard.recordFailure(err)
+	default:
+		shard.recordSuccess()
+	}
+}
+
+func (shard *Shard) recordSuccess() {
+	if shard.table.health.Interval <= 0 {
+		return
+	}
+	b := &shard.breaker
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if b.state != ShardHealthy {
+		logger.Info("shard ", shard.name, " is healthy")
+	}
+	b.state = ShardHealthy
+	b.failures = 0
+}
+
+// recordCanceled lets the next statement probe the shard if the probe was canceled
+func (shard *Shard) recordCanceled() {
+	b := &shard.breaker
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if b.state == ShardProbing {
+		b.state = ShardUnhealthy
+	}
+}
+
+func (shard *Shard) recordFailure(err error) {
+	options := shard.table.health
+	if options.Interval <= 0 {
+		return
+	}
+	b := &shard.breaker
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.failures++
+	b.lastError = err
+	switch {
+	case b.state == ShardProbing:
+		b.state = ShardUnhealthy
+		b.openedAt = time.Now()
+	case b.state == ShardHealthy && b.failures >= options.FailureThreshold:
+		logger.Warn("shard ", shard.name, " is unhealthy: ", err.Error())
+		b.state = ShardUnhealthy
+		b.openedAt = time.Now()
+	}
+}
+
+// ping checks the shard driver, an unhealthy shard is pinged only when it may be probed
+func (shard *Shard) ping(ctx context.Context) {
+	if shard.allow() != nil {
+		return
+	}
+	timeout := shard.table.health.Timeout
+	if timeout <= 0 {
+		timeout = shard.table.health.Interval
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := shard.driver.PingContext(pingCtx)
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		// the health check is stopped
+		shard.recordCanceled()
+		return
+	}
+	shard.breaker.mx.Lock()
+	shard.breaker.latency = latency
+	shard.breaker.lastCheck = time.Now()
+	shard.breaker.mx.Unlock()
+	if err != nil {
+		shard.recordFailure(err)
+	} else {
+		shard.recordSuccess()
+	}
+}
+
+// Health returns the state of every shard
+func (table *Table) Health() []ShardHealth {
+	shards := table.shards()
+	result := make([]ShardHealth, len(shards))
+	for i, shard := range shards {
+		b := &shard.breaker
+		b.mx.Lock()
+		result[i] = ShardHealth{
+			Shard:     shard.num,
+			Name:      shard.name,
+			State:     b.state,
+			Latency:   b.latency,
+			LastCheck: b.lastCheck,
+			LastError: b.lastError,
+		}
+		b.mx.Unlock()
+	}
+	return result
+}
+
+// startHealthCheck pings every shard from its own goroutine, so a hanging shard or busy async pool
+// does not delay pings of the others. A shard is not pinged again while its last ping runs.
+func (table *Table) startHealthCheck() {
+	if table.health.Interval <= 0 {
+		return
+	}
+	ctx := table.background()
+	go func() {
+		ticker := time.NewTicker(table.health.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, shard := range table.shards() {
+				if !shard.pinging.CompareAndSwap(false, true) {
+					continue
+				}
+				go func(shard *Shard) {
+					defer shard.pinging.Store(false)
+					shard.ping(ctx)
+				}(shard)
+			}
+		}
+	}()
+}
+
+// background returns context of the background checks of the table, it is done after StopHealthCheck
+func (table *Table) background() context.Context {
+	if table.stopHealth == nil {
+		table.backgroundCtx, table.stopHealth = context.WithCancel(context.Background())
+	}
+	return table.backgroundCtx
+}
+
+// StopHealthCheck stops pinging the shards and checking their replicas, circuit breakers keep working
+func (table *Table) StopHealthCheck() {
+	if table.stopHealth != nil {
+		table.stopHealth()
+	}
+}
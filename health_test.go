@@ -0,0 +1,134 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// expiringHook runs the first failures statements with an expired context, they fail like a hanging shard
+type expiringHook struct {
+	failures int32
+	calls    atomic.Int32
+	executed atomic.Int32
+}
+
+func (h *expiringHook) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	if h.calls.Add(1) <= h.failures {
+		ctx, cancel := context.WithDeadline(ctx, time.Now())
+		cancel()
+		return ctx, nil
+	}
+	return ctx, nil
+}
+func (h *expiringHook) After(ctx context.Context, event *QueryEvent) {
+	if !event.Start.IsZero() {
+		h.executed.Add(1)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	hook := &expiringHook{failures: 2}
+	options := HealthOptions{Interval: time.Hour, FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond, ProbeTimeout: time.Hour}
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields, WithHealthCheck(options))
+	table.hooks = []Hook{hook}
+	shard := table.shard(int64(1))
+	put := func() error {
+		return table.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(1)}})
+	}
+
+	if err := put(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("put with an expired context: %v", err)
+	}
+	if err := put(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second put: %v, want a timeout", err)
+	}
+	if err := put(); !errors.Is(err, ErrShardUnavailable) {
+		t.Fatalf("put to an unhealthy shard: %v, want ErrShardUnavailable", err)
+	}
+	if calls := hook.executed.Load(); calls != 2 {
+		t.Errorf("%d statements executed, the unhealthy shard must fail fast", calls)
+	}
+	for _, health := range table.Health() {
+		if health.Shard == shard.num && (health.State != ShardUnhealthy || !errors.Is(health.LastError, context.DeadlineExceeded)) {
+			t.Errorf("health of the failed shard %v %v", health.State, health.LastError)
+		}
+		if health.Shard != shard.num && health.State != ShardHealthy {
+			t.Errorf("shard %d is %s", health.Shard, health.State)
+		}
+	}
+
+	// after OpenTimeout one statement probes the shard, others fail fast while it runs
+	time.Sleep(options.OpenTimeout)
+	if err := shard.allow(); err != nil {
+		t.Fatalf("probe is not allowed: %v", err)
+	}
+	if err := shard.allow(); !errors.Is(err, ErrShardUnavailable) {
+		t.Fatalf("statement during a probe: %v, want ErrShardUnavailable", err)
+	}
+	if table.Health()[shard.num].State != ShardProbing {
+		t.Errorf("shard is %s during a probe", table.Health()[shard.num].State)
+	}
+	shard.record(nil)
+	if err := put(); err != nil {
+		t.Fatalf("put after a successful probe: %v", err)
+	}
+	if state := table.Health()[shard.num].State; state != ShardHealthy {
+		t.Errorf("shard is %s after a successful probe", state)
+	}
+}
+
+func TestHealthPing(t *testing.T) {
+	db := openSQLite(t)
+	options := HealthOptions{Interval: time.Hour, Timeout: time.Second, FailureThreshold: 1, OpenTimeout: time.Hour}
+	table := newSQLiteTable(t, db, "items", 1, itemFields, WithHealthCheck(options))
+	shard := table.GetShard(0)
+	shard.ping(context.Background())
+	health := table.Health()[0]
+	if health.State != ShardHealthy || health.LastCheck.IsZero() || health.LastError != nil {
+		t.Fatalf("health after a ping %+v", health)
+	}
+
+	db.Close()
+	shard.ping(context.Background())
+	health = table.Health()[0]
+	if health.State != ShardUnhealthy || health.LastError == nil {
+		t.Fatalf("health after a failed ping %+v", health)
+	}
+	// an unhealthy shard is not pinged before OpenTimeout
+	checked := health.LastCheck
+	shard.ping(context.Background())
+	if !table.Health()[0].LastCheck.Equal(checked) {
+		t.Error("unhealthy shard is pinged before OpenTimeout")
+	}
+}
+
+func TestBreakerFailures(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields,
+		WithHealthCheck(HealthOptions{Interval: time.Hour, FailureThreshold: 2, OpenTimeout: time.Hour}))
+	shard := table.GetShard(0)
+	// only failures in a row open the breaker, an error of a reachable database resets them
+	shard.record(ErrConnection)
+	shard.record(ErrDuplicateKey)
+	shard.record(context.DeadlineExceeded)
+	if err := shard.allow(); err != nil {
+		t.Fatalf("breaker is open after failures separated by a success: %v", err)
+	}
+	// a canceled statement is neither
+	shard.record(context.Canceled)
+	shard.record(ErrConnection)
+	if err := shard.allow(); !errors.Is(err, ErrShardUnavailable) {
+		t.Fatalf("breaker after 2 failures in a row: %v, want ErrShardUnavailable", err)
+	}
+
+	// without health checking the breaker is disabled
+	shard = newSQLiteTable(t, openSQLite(t), "items", 1, itemFields).GetShard(0)
+	for i := 0; i < 5; i++ {
+		shard.record(ErrConnection)
+	}
+	if err := shard.allow(); err != nil {
+		t.Errorf("disabled breaker: %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+type QueryKind int
+
+const (
+	// QueryExec is a statement executed by Exec, e.g. insert or update
+	QueryExec QueryKind = iota
+	// QueryRows is a statement returning rows executed by Query
+	QueryRows
+)
+
+func (kind QueryKind) String() string {
+	if kind == QueryRows {
+		return "query"
+	}
+	return "exec"
+}
+
+// Operation is the method of a table that executed a statement
+type Operation string
+
+const (
+	OpGet    Operation = "get"
+	OpPut    Operation = "put"
+	OpSet    Operation = "set"
+	OpAdd    Operation = "add"
+	OpRemove Operation = "remove"
+	OpSelect Operation = "select"
+	// OpExec is a raw statement of Exec or Query
+	OpExec Operation = "exec"
+)
+
+type operationKey struct{}
+
+// withOperation marks statements executed with ctx as statements of op
+func withOperation(ctx context.Context, op Operation) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+func operationOf(ctx context.Context) Operation {
+	if op, ok := ctx.Value(operationKey{}).(Operation); ok {
+		return op
+	}
+	return OpExec
+}
+
+type argColumnsKey struct{}
+
+// withColumns passes the columns of args of stmt to the QueryEvent of stmt
+func withColumns(ctx context.Context, stmt *statement) context.Context {
+	return context.WithValue(ctx, argColumnsKey{}, stmt.columns)
+}
+
+// QueryEvent is a statement executed on a shard, hooks receive it before and after the statement
+type QueryEvent struct {
+	Table string
+	Shard uint
+	Kind  QueryKind
+	// Operation is the method that executed the statement
+	Operation Operation
+	// Op is the first keyword of the statement in lower case, e.g. insert or select
+	Op string
+	// Query is the statement sent to the driver, Before may rewrite it and Args
+	Query string
+	Args  []interface{}
+	// Replica is true if the statement is executed on a read replica of the shard
+	Replica bool
+	// Tx is true if the statement is executed in a transaction
+	Tx    bool
+	Start time.Time
+	// Duration of the statement, rows of QueryRows are read after it
+	Duration time.Duration
+	// RowsAffected by QueryExec, -1 for QueryRows or if it is unknown
+	RowsAffected int64
+	// RowsReturned by QueryRows, it is set before RowsHook.RowsRead, -1 until the rows are read
+	RowsReturned int64
+	// Err is the error of the statement, it is set before After
+	Err error
+
+	table *Table
+	// columns are the columns of Args, nil for raw statements
+	columns []string
+}
+
+// Redacted is logged instead of values of sensitive fields
+const Redacted = "[REDACTED]"
+
+// RedactedArgs returns Args with values of sensitive fields replaced by Redacted. If the table has
+// sensitive fields, args of raw statements and args that are not column values are redacted too.
+func (event *QueryEvent) RedactedArgs() []interface{} {
+	result := make([]interface{}, len(event.Args))
+	copy(result, event.Args)
+	if !event.table.hasSensitiveFields() {
+		return result
+	}
+	for i := range result {
+		if i >= len(event.columns) || event.columns[i] == "" || event.table.isSensitive(event.columns[i]) {
+			result[i] = Redacted
+		}
+	}
+	return result
+}
+
+// Hook observes and modifies statements of tables. Before hooks are called in order of registration,
+// global hooks first, After hooks are called in reverse order.
+type Hook interface {
+	// Before is called before the statement, the returned context is used by the statement and After.
+	// An error cancels the statement, it is returned wrapped in QueryError.
+	Before(ctx context.Context, event *QueryEvent) (context.Context, error)
+	// After is called after the statement with its result in event, it is called for every hook whose
+	// Before was called
+	After(ctx context.Context, event *QueryEvent)
+}
+
+// RowsHook is a Hook that is notified when rows returned by a statement are read by Get, GradualSelect,
+// FullSelect or SelectAll, rows of raw Query are read by the caller and are not reported
+type RowsHook interface {
+	Hook
+	// RowsRead is called after After when the rows are read or closed, event.RowsReturned is set
+	RowsRead(ctx context.Context, event *QueryEvent)
+}
+
+// HookFuncs is a Hook of functions, nil functions are skipped
+type HookFuncs struct {
+	BeforeFunc func(ctx context.Context, event *QueryEvent) (context.Context, error)
+	AfterFunc  func(ctx context.Context, event *QueryEvent)
+}
+
+func (hook HookFuncs) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	if hook.BeforeFunc == nil {
+		return ctx, nil
+	}
+	return hook.BeforeFunc(ctx, event)
+}
+func (hook HookFuncs) After(ctx context.Context, event *QueryEvent) {
+	if hook.AfterFunc != nil {
+		hook.AfterFunc(ctx, event)
+	}
+}
+
+var (
+	hooksMx     sync.RWMutex
+	globalHooks []Hook
+)
+
+// AddHook registers hook for statements of every table
+func AddHook(hook Hook) {
+	hooksMx.Lock()
+	defer hooksMx.Unlock()
+	hooks := make([]Hook, len(globalHooks), len(globalHooks)+1)
+	copy(hooks, globalHooks)
+	globalHooks = append(hooks, hook)
+}
+
+// WithHooks registers hooks for statements of the table, they are called after global hooks
+func WithHooks(hooks ...Hook) TableOption {
+	return func(table *Table) {
+		table.hooks = append(table.hooks, hooks...)
+	}
+}
+
+// queryHooks returns global hooks followed by hooks of the table
+func (table *Table) queryHooks() []Hook {
+	hooksMx.RLock()
+	global := globalHooks
+	hooksMx.RUnlock()
+	if len(table.hooks) == 0 {
+		return global
+	}
+	if len(global) == 0 {
+		return table.hooks
+	}
+	hooks := make([]Hook, 0, len(global)+len(table.hooks))
+	return append(append(hooks, global...), table.hooks...)
+}
+
+// queryCall is an executed statement, rows reports the rows read from its result to the hooks
+// and ends its spans
+type queryCall struct {
+	ctx   context.Context
+	event *QueryEvent
+	hooks []Hook
+	span  Span
+	scan  Span
+}
+
+func (call *queryCall) rows(rows int64) {
+	call.event.RowsReturned = rows
+	for i := len(call.hooks) - 1; i >= 0; i-- {
+		if hook, ok := call.hooks[i].(RowsHook); ok {
+			hook.RowsRead(call.ctx, call.event)
+		}
+	}
+	if call.scan != nil {
+		call.scan.SetAttributes(Attribute{"db.rows_returned", rows})
+		call.scan.End()
+		call.span.SetAttributes(Attribute{"db.rows_returned", rows})
+		call.span.End()
+		call.scan = nil
+	}
+}
+
+// execute runs statement of kind on ex by f with hooks of the table and the circuit breaker of the shard.
+// If read is set the caller reads the returned rows and reports them by call.rows.
+func (shard *Shard) execute(ctx context.Context, ex executor, kind QueryKind, query string, args []interface{}, read bool, f func(ctx context.Context, event *QueryEvent) error) (*queryCall, error) {
+	if shard.retired.Load() {
+		return nil, ErrShardRetired
+	}
+	query = shard.prepareQuery(query)
+	_, isDB := ex.(*sql.DB)
+	event := &QueryEvent{
+		Table:        shard.table.name,
+		Shard:        shard.num,
+		Kind:         kind,
+		Operation:    operationOf(ctx),
+		Op:           queryOp(query),
+		Query:        query,
+		Args:         args,
+		Replica:      shard.isReplica(ex),
+		Tx:           !isDB,
+		RowsAffected: -1,
+		RowsReturned: -1,
+		table:        shard.table,
+	}
+	event.columns, _ = ctx.Value(argColumnsKey{}).([]string)
+	currentTracer := tracer
+	var span Span = noopSpan{}
+	if _, noop := currentTracer.(NoopTracer); !noop {
+		ctx, span = currentTracer.Start(ctx, "eplidr."+string(event.Operation),
+			Attribute{"eplidr.table", event.Table},
+			Attribute{"eplidr.shard", int64(event.Shard)},
+			Attribute{"eplidr.operation", string(event.Operation)},
+			Attribute{"eplidr.replica", event.Replica},
+			Attribute{"db.operation", event.Op},
+			Attribute{"db.statement", fingerprint(query)},
+		)
+	}
+	hooks := shard.table.queryHooks()
+	called := 0
+	var err error
+	for ; called < len(hooks) && err == nil; called++ {
+		var next context.Context
+		next, err = hooks[called].Before(ctx, event)
+		if next != nil {
+			ctx = next
+		}
+	}
+	if err == nil && !event.Replica {
+		err = shard.allow()
+	}
+	if err == nil {
+		queryCtx, querySpan := currentTracer.Start(ctx, "eplidr.query")
+		event.Start = time.Now()
+		err = f(queryCtx, event)
+		event.Duration = time.Since(event.Start)
+		if err != nil {
+			querySpan.RecordError(err)
+		}
+		querySpan.End()
+		if !event.Replica {
+			shard.record(err)
+		}
+	}
+	event.Err = shard.queryError(event.Operation, err)
+	for i := called - 1; i >= 0; i-- {
+		hooks[i].After(ctx, event)
+	}
+	call := &queryCall{ctx: ctx, event: event, hooks: hooks[:called], span: span}
+	switch {
+	case event.Err != nil:
+		span.RecordError(event.Err)
+		span.End()
+	case read:
+		_, call.scan = currentTracer.Start(ctx, "eplidr.scan")
+	default:
+		if event.RowsAffected >= 0 {
+			span.SetAttributes(Attribute{"db.rows_affected", event.RowsAffected})
+		}
+		span.End()
+	}
+	return call, event.Err
+}
@@ -0,0 +1,179 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type hookContextKey struct{}
+
+// orderHook appends its calls to calls, the events of other tables are skipped
+type orderHook struct {
+	name  string
+	table string
+	mx    *sync.Mutex
+	calls *[]string
+	err   error
+}
+
+func (h orderHook) add(call string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	*h.calls = append(*h.calls, call)
+}
+
+func (h orderHook) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	if event.Table != h.table {
+		return ctx, nil
+	}
+	h.add("before " + h.name)
+	return ctx, h.err
+}
+func (h orderHook) After(ctx context.Context, event *QueryEvent) {
+	if event.Table == h.table {
+		h.add("after " + h.name)
+	}
+}
+
+// eventsHook keeps the events of the statements after they are executed or read
+type eventsHook struct {
+	mx     sync.Mutex
+	events []QueryEvent
+	read   []QueryEvent
+}
+
+func (h *eventsHook) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	return context.WithValue(ctx, hookContextKey{}, event.Operation), nil
+}
+func (h *eventsHook) After(ctx context.Context, event *QueryEvent) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if ctx.Value(hookContextKey{}) != event.Operation {
+		event.Err = errors.New("context of Before is not passed to After")
+	}
+	h.events = append(h.events, *event)
+}
+func (h *eventsHook) RowsRead(ctx context.Context, event *QueryEvent) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.read = append(h.read, *event)
+}
+func (h *eventsHook) take() ([]QueryEvent, []QueryEvent) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	events, read := h.events, h.read
+	h.events, h.read = nil, nil
+	return events, read
+}
+
+func TestHookOrder(t *testing.T) {
+	var mx sync.Mutex
+	var calls []string
+	hook := func(name string) orderHook {
+		return orderHook{name: name, table: "hooked", mx: &mx, calls: &calls}
+	}
+	AddHook(hook("global"))
+	table := newSQLiteTable(t, openSQLite(t), "hooked", 1, itemFields, WithHooks(hook("first"), hook("second")))
+	calls = nil
+	putItems(t, table, 1)
+	want := []string{"before global", "before first", "before second", "after second", "after first", "after global"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls %v, want %v", calls, want)
+	}
+
+	// an error of Before cancels the statement, After of the hooks called before it is called
+	failure := errors.New("refused")
+	failing := hook("failing")
+	failing.err = failure
+	table.hooks = []Hook{hook("first"), failing, hook("last")}
+	calls = nil
+	err := table.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(1)}})
+	var queryErr *QueryError
+	if !errors.Is(err, failure) || !errors.As(err, &queryErr) || queryErr.Op != OpPut {
+		t.Errorf("put refused by a hook: %v", err)
+	}
+	want = []string{"before global", "before first", "before failing", "after failing", "after first", "after global"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls %v, want %v", calls, want)
+	}
+	table.hooks = nil
+	var status int64
+	if err, found := table.Get(int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"status", &status}}); err != nil || found {
+		t.Errorf("row of a refused put: %v %v", found, err)
+	}
+}
+
+func TestHookEvents(t *testing.T) {
+	hook := &eventsHook{}
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields, WithHooks(hook))
+	putItems(t, table, 4)
+	hook.take()
+
+	if err := table.Set(int64(1), Ne("status", int64(9)), Columns{{"status", int64(5)}}); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := hook.take()
+	if len(events) != 1 {
+		t.Fatalf("%d events of a set", len(events))
+	}
+	event := events[0]
+	if event.Operation != OpSet || event.Op != "update" || event.Kind != QueryExec || event.Table != "items" ||
+		event.Shard != table.GetShardNum(int64(1)) || event.Tx || event.Err != nil {
+		t.Errorf("event of set %+v", event)
+	}
+	if event.RowsAffected != 2 || event.Start.IsZero() || !reflect.DeepEqual(event.Args, []interface{}{int64(5), int64(9)}) {
+		t.Errorf("event of set: %d rows, args %v", event.RowsAffected, event.Args)
+	}
+
+	result, err := table.FullSelect(int64(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, read := hook.take()
+	if len(events) != 1 || events[0].Operation != OpSelect || events[0].Kind != QueryRows || events[0].RowsAffected != -1 {
+		t.Fatalf("events of a select %+v", events)
+	}
+	if len(read) != 1 || read[0].RowsReturned != 2 {
+		t.Errorf("read rows %+v, want 2 rows", read)
+	}
+	if ids := selectedIDs(t, result); len(ids) != 2 {
+		t.Errorf("selected %v", ids)
+	}
+
+	err = table.InTx(context.Background(), int64(1), func(tx *Tx) error {
+		return tx.Remove(Keys{{"id", int64(1)}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ = hook.take()
+	if len(events) != 1 || !events[0].Tx || events[0].Operation != OpRemove || events[0].RowsAffected != 1 {
+		t.Errorf("events of a transaction %+v", events)
+	}
+}
+
+func TestHookRewrite(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields)
+	putItems(t, table, 3)
+	table.hooks = []Hook{HookFuncs{BeforeFunc: func(ctx context.Context, event *QueryEvent) (context.Context, error) {
+		if event.Operation == OpRemove {
+			event.Query = `DELETE FROM "items0" WHERE id = ?;`
+			event.Args = []interface{}{int64(2)}
+		}
+		return ctx, nil
+	}}}
+	if err := table.Remove(int64(0), Keys{{"id", int64(0)}}); err != nil {
+		t.Fatal(err)
+	}
+	table.hooks = nil
+	result, err := table.FullSelect(int64(0), nil, SelectOptions{OrderBy: []OrderBy{{Column: "id"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := selectedIDs(t, result); !reflect.DeepEqual(ids, []int64{0, 1}) {
+		t.Errorf("rows after a rewritten remove %v, want 0 and 1", ids)
+	}
+}
@@ -1,6 +1,15 @@
 package eplidr
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
 type Logger interface {
 	Debug(v ...any)
@@ -29,3 +38,83 @@ func (l *DefaultLogger) Error(v ...any) {
 func (l *DefaultLogger) Warn(v ...any) {
 	log.Println(v...)
 }
+
+// LogLevel has the values of slog.Level, slog.Level(level) converts it
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (level LogLevel) String() string {
+	switch {
+	case level >= LevelError:
+		return "ERROR"
+	case level >= LevelWarn:
+		return "WARN"
+	case level >= LevelInfo:
+		return "INFO"
+	}
+	return "DEBUG"
+}
+
+// StructuredLogger logs msg with fields given as alternating keys and values like slog.Logger.Log
+type StructuredLogger interface {
+	Log(ctx context.Context, level LogLevel, msg string, args ...any)
+}
+
+// LogFunc is a StructuredLogger of a function, e.g. of slog:
+//
+//	eplidr.LogFunc(func(ctx context.Context, level eplidr.LogLevel, msg string, args ...any) {
+//		slog.Log(ctx, slog.Level(level), msg, args...)
+//	})
+type LogFunc func(ctx context.Context, level LogLevel, msg string, args ...any)
+
+func (f LogFunc) Log(ctx context.Context, level LogLevel, msg string, args ...any) {
+	f(ctx, level, msg, args...)
+}
+
+// TextLogger writes records of level and above as key=value lines
+type TextLogger struct {
+	mx    sync.Mutex
+	out   io.Writer
+	level LogLevel
+}
+
+func NewTextLogger(out io.Writer, level LogLevel) *TextLogger {
+	return &TextLogger{out: out, level: level}
+}
+
+func (l *TextLogger) Log(ctx context.Context, level LogLevel, msg string, args ...any) {
+	if level < l.level {
+		return
+	}
+	var line strings.Builder
+	line.WriteString("time=")
+	line.WriteString(time.Now().Format(time.RFC3339Nano))
+	line.WriteString(" level=")
+	line.WriteString(level.String())
+	line.WriteString(" msg=")
+	line.WriteString(strconv.Quote(msg))
+	for i := 0; i < len(args); i += 2 {
+		key, value := fmt.Sprint(args[i]), any("!MISSING")
+		if i+1 < len(args) {
+			value = args[i+1]
+		}
+		line.WriteString(" ")
+		line.WriteString(key)
+		line.WriteString("=")
+		text := fmt.Sprint(value)
+		if strings.ContainsAny(text, " \"=\n") || text == "" {
+			text = strconv.Quote(text)
+		}
+		line.WriteString(text)
+	}
+	line.WriteString("\n")
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	_, _ = io.WriteString(l.out, line.String())
+}
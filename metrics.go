@@ -0,0 +1,289 @@
+package eplidr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type MetricType int
+
+const (
+	CounterMetric MetricType = iota
+	GaugeMetric
+	HistogramMetric
+)
+
+func (t MetricType) String() string {
+	switch t {
+	case GaugeMetric:
+		return "gauge"
+	case HistogramMetric:
+		return "histogram"
+	}
+	return "counter"
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Bucket is a cumulative histogram bucket, Count is the number of observations not greater than UpperBound
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Metric is a sample of a metric family. Value is set for counters and gauges, Buckets, Count and Sum
+// for histograms.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels []Label
+	Value  float64
+
+	Buckets []Bucket
+	Count   uint64
+	Sum     float64
+}
+
+// Collector sends its metrics to ch like prometheus.Collector does, samples of a family are sent together
+type Collector interface {
+	Collect(ch chan<- Metric)
+}
+
+// DefaultLatencyBuckets are upper bounds of statement duration histograms in seconds
+var DefaultLatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is a Hook counting statements, errors, rows and durations per table, shard and Operation.
+// Register it by AddHook or WithHooks, it serves the Prometheus text format over HTTP.
+type Metrics struct {
+	buckets []float64
+
+	mx         sync.Mutex
+	statements map[metricsKey]*statementMetrics
+}
+
+type metricsKey struct {
+	table     string
+	shard     uint
+	operation Operation
+}
+
+type statementMetrics struct {
+	count        uint64
+	errors       map[ErrorCode]uint64
+	rowsAffected uint64
+	rowsReturned uint64
+	// observed is the number of durations, statements failed before they were sent have none
+	observed    uint64
+	durations   []uint64
+	durationSum float64
+}
+
+// NewMetrics returns Metrics with duration histograms of buckets, DefaultLatencyBuckets if none are given
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets:    buckets,
+		statements: make(map[metricsKey]*statementMetrics),
+	}
+}
+
+func (m *Metrics) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (m *Metrics) After(ctx context.Context, event *QueryEvent) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	stats := m.statement(event)
+	stats.count++
+	if event.Err != nil {
+		stats.errors[errorCode(event.Err)]++
+	}
+	if event.RowsAffected > 0 {
+		stats.rowsAffected += uint64(event.RowsAffected)
+	}
+	if event.Start.IsZero() {
+		// the statement failed before it was sent
+		return
+	}
+	seconds := event.Duration.Seconds()
+	stats.observed++
+	stats.durationSum += seconds
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			stats.durations[i]++
+		}
+	}
+}
+
+func (m *Metrics) RowsRead(ctx context.Context, event *QueryEvent) {
+	if event.RowsReturned <= 0 {
+		return
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.statement(event).rowsReturned += uint64(event.RowsReturned)
+}
+
+func (m *Metrics) statement(event *QueryEvent) *statementMetrics {
+	key := metricsKey{table: event.Table, shard: event.Shard, operation: event.Operation}
+	stats, ok := m.statements[key]
+	if !ok {
+		stats = &statementMetrics{
+			errors:    make(map[ErrorCode]uint64),
+			durations: make([]uint64, len(m.buckets)),
+		}
+		m.statements[key] = stats
+	}
+	return stats
+}
+
+// Collect sends the statement metrics and the queue depth of the pool running async operations
+func (m *Metrics) Collect(ch chan<- Metric) {
+	for _, metric := range m.snapshot() {
+		ch <- metric
+	}
+}
+
+func (m *Metrics) snapshot() []Metric {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	keys := make([]metricsKey, 0, len(m.statements))
+	for key := range m.statements {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].table != keys[b].table {
+			return keys[a].table < keys[b].table
+		}
+		if keys[a].shard != keys[b].shard {
+			return keys[a].shard < keys[b].shard
+		}
+		return keys[a].operation < keys[b].operation
+	})
+	var statements, errors, affected, returned, durations []Metric
+	for _, key := range keys {
+		stats := m.statements[key]
+		labels := []Label{
+			{"table", key.table},
+			{"shard", strconv.FormatUint(uint64(key.shard), 10)},
+			{"operation", string(key.operation)},
+		}
+		statements = append(statements, Metric{Name: "eplidr_statements_total", Help: "Statements executed on shards.",
+			Type: CounterMetric, Labels: labels, Value: float64(stats.count)})
+		codes := make([]ErrorCode, 0, len(stats.errors))
+		for code := range stats.errors {
+			codes = append(codes, code)
+		}
+		sort.Slice(codes, func(a, b int) bool { return codes[a] < codes[b] })
+		for _, code := range codes {
+			errors = append(errors, Metric{Name: "eplidr_statement_errors_total", Help: "Failed statements by error code.",
+				Type: CounterMetric, Labels: append(labels[:3:3], Label{"code", code.String()}), Value: float64(stats.errors[code])})
+		}
+		affected = append(affected, Metric{Name: "eplidr_rows_affected_total", Help: "Rows affected by statements.",
+			Type: CounterMetric, Labels: labels, Value: float64(stats.rowsAffected)})
+		returned = append(returned, Metric{Name: "eplidr_rows_returned_total", Help: "Rows read from results of statements.",
+			Type: CounterMetric, Labels: labels, Value: float64(stats.rowsReturned)})
+		buckets := make([]Bucket, len(m.buckets))
+		for i, bound := range m.buckets {
+			buckets[i] = Bucket{UpperBound: bound, Count: stats.durations[i]}
+		}
+		durations = append(durations, Metric{Name: "eplidr_statement_duration_seconds", Help: "Duration of statements.",
+			Type: HistogramMetric, Labels: labels, Buckets: buckets, Count: stats.observed, Sum: stats.durationSum})
+	}
+	var result []Metric
+	for _, family := range [][]Metric{statements, errors, affected, returned, durations} {
+		result = append(result, family...)
+	}
+	return append(result,
+		Metric{Name: "eplidr_pool_queued_tasks", Help: "Tasks waiting for a worker of the async pool.",
+			Type: GaugeMetric, Value: float64(poolQueued.Load())},
+		Metric{Name: "eplidr_pool_running_tasks", Help: "Tasks running in the async pool.",
+			Type: GaugeMetric, Value: float64(poolRunning.Load())},
+	)
+}
+
+// WriteText writes metrics of collector in the Prometheus text exposition format
+func WriteText(w io.Writer, collector Collector) error {
+	ch := make(chan Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	out := bufio.NewWriter(w)
+	family := ""
+	for metric := range ch {
+		if metric.Name != family {
+			family = metric.Name
+			if metric.Help != "" {
+				fmt.Fprintf(out, "# HELP %s %s\n", metric.Name, escapeHelp(metric.Help))
+			}
+			fmt.Fprintf(out, "# TYPE %s %s\n", metric.Name, metric.Type)
+		}
+		if metric.Type != HistogramMetric {
+			fmt.Fprintf(out, "%s%s %s\n", metric.Name, formatLabels(metric.Labels), formatFloat(metric.Value))
+			continue
+		}
+		for _, bucket := range metric.Buckets {
+			labels := append(metric.Labels[:len(metric.Labels):len(metric.Labels)], Label{"le", formatFloat(bucket.UpperBound)})
+			fmt.Fprintf(out, "%s_bucket%s %d\n", metric.Name, formatLabels(labels), bucket.Count)
+		}
+		labels := append(metric.Labels[:len(metric.Labels):len(metric.Labels)], Label{"le", "+Inf"})
+		fmt.Fprintf(out, "%s_bucket%s %d\n", metric.Name, formatLabels(labels), metric.Count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", metric.Name, formatLabels(metric.Labels), formatFloat(metric.Sum))
+		fmt.Fprintf(out, "%s_count%s %d\n", metric.Name, formatLabels(metric.Labels), metric.Count)
+	}
+	return out.Flush()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err := WriteText(w, m)
+	if err != nil {
+		logger.Error("writing metrics: ", err.Error())
+	}
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = label.Name + `="` + labelEscaper.Replace(label.Value) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
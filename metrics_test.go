@@ -0,0 +1,131 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// metricValue returns the value of the counter name with labels of snapshot of m
+func metricValue(t *testing.T, m *Metrics, name string, labels ...Label) float64 {
+	t.Helper()
+	for _, metric := range m.snapshot() {
+		if metric.Name == name && labelsEqual(metric.Labels, labels) {
+			return metric.Value
+		}
+	}
+	t.Fatalf("no metric %s%s", name, formatLabels(labels))
+	return 0
+}
+
+func labelsEqual(a, b []Label) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields, WithHooks(metrics))
+	putItems(t, table, 3)
+	if err := table.Set(int64(0), Ne("status", int64(2)), Columns{{"status", int64(0)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put(int64(0), Columns{{"id", int64(0)}, {"status", int64(0)}}); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("duplicate put: %v", err)
+	}
+	result, err := table.FullSelect(int64(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectedIDs(t, result)
+
+	labels := func(operation Operation) []Label {
+		return []Label{{"table", "items"}, {"shard", "0"}, {"operation", string(operation)}}
+	}
+	tests := []struct {
+		name      string
+		operation Operation
+		want      float64
+	}{
+		{"eplidr_statements_total", OpPut, 4},
+		{"eplidr_rows_affected_total", OpPut, 3},
+		{"eplidr_statements_total", OpSet, 1},
+		{"eplidr_rows_affected_total", OpSet, 2},
+		{"eplidr_rows_returned_total", OpSelect, 3},
+	}
+	for _, test := range tests {
+		if got := metricValue(t, metrics, test.name, labels(test.operation)...); got != test.want {
+			t.Errorf("%s of %s is %v, want %v", test.name, test.operation, got, test.want)
+		}
+	}
+	if got := metricValue(t, metrics, "eplidr_statement_errors_total", append(labels(OpPut), Label{"code", CodeDuplicateKey.String()})...); got != 1 {
+		t.Errorf("duplicate key errors %v, want 1", got)
+	}
+	for _, metric := range metrics.snapshot() {
+		if metric.Name == "eplidr_statement_duration_seconds" && labelsEqual(metric.Labels, labels(OpPut)) {
+			if metric.Count != 4 || metric.Buckets[len(metric.Buckets)-1].Count != 4 {
+				t.Errorf("put durations: %d observed, %+v", metric.Count, metric.Buckets)
+			}
+		}
+	}
+}
+
+func TestMetricsText(t *testing.T) {
+	metrics := NewMetrics(1, 0.1)
+	event := &QueryEvent{Table: `a"b`, Shard: 1, Operation: OpGet, RowsAffected: -1, Start: time.Now(), Duration: 500 * time.Millisecond}
+	metrics.After(context.Background(), event)
+	event.Duration = 2 * time.Second
+	event.Err = ErrLockTimeout
+	metrics.After(context.Background(), event)
+	// a statement refused before it is sent has no duration
+	event.Start = time.Time{}
+	metrics.After(context.Background(), event)
+	event.RowsReturned = 5
+	metrics.RowsRead(context.Background(), event)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", contentType)
+	}
+	labels := `table="a\"b",shard="1",operation="get"`
+	want := `# HELP eplidr_statements_total Statements executed on shards.
+# TYPE eplidr_statements_total counter
+eplidr_statements_total{` + labels + `} 3
+# HELP eplidr_statement_errors_total Failed statements by error code.
+# TYPE eplidr_statement_errors_total counter
+eplidr_statement_errors_total{` + labels + `,code="lock_timeout"} 2
+# HELP eplidr_rows_affected_total Rows affected by statements.
+# TYPE eplidr_rows_affected_total counter
+eplidr_rows_affected_total{` + labels + `} 0
+# HELP eplidr_rows_returned_total Rows read from results of statements.
+# TYPE eplidr_rows_returned_total counter
+eplidr_rows_returned_total{` + labels + `} 5
+# HELP eplidr_statement_duration_seconds Duration of statements.
+# TYPE eplidr_statement_duration_seconds histogram
+eplidr_statement_duration_seconds_bucket{` + labels + `,le="0.1"} 0
+eplidr_statement_duration_seconds_bucket{` + labels + `,le="1"} 1
+eplidr_statement_duration_seconds_bucket{` + labels + `,le="+Inf"} 2
+eplidr_statement_duration_seconds_sum{` + labels + `} 2.5
+eplidr_statement_duration_seconds_count{` + labels + `} 2
+# HELP eplidr_pool_queued_tasks Tasks waiting for a worker of the async pool.
+# TYPE eplidr_pool_queued_tasks gauge
+eplidr_pool_queued_tasks 0
+# HELP eplidr_pool_running_tasks Tasks running in the async pool.
+# TYPE eplidr_pool_running_tasks gauge
+eplidr_pool_running_tasks 0
+`
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("text exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
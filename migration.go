@@ -0,0 +1,213 @@
+package eplidr
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ColumnDescription is a column of an existing shard table as reported by DESCRIBE
+type ColumnDescription struct {
+	Name string
+	// Type is normalized: lower case, without integer display width
+	Type     string
+	Nullable bool
+	Default  sql.NullString
+}
+
+// TableDescription is the current schema of one shard table
+type TableDescription struct {
+	Columns map[FieldName]ColumnDescription
+	// Indexes maps index name to its columns in index order, primary key is not included
+	Indexes        map[string][]string
+	PrimaryKeyName string
+	PrimaryKey     []string
+}
+
+func (d *TableDescription) getColumn(name string) (ColumnDescription, bool) {
+	column, ok := d.Columns[FieldName(strings.ToLower(name))]
+	return column, ok
+}
+
+func (d *TableDescription) hasIndex(name string) bool {
+	for index := range d.Indexes {
+		if strings.EqualFold(index, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *TableDescription) isPrimaryKey(keys []string) bool {
+	if len(d.PrimaryKey) != len(keys) {
+		return false
+	}
+	for i := range keys {
+		if !strings.EqualFold(d.PrimaryKey[i], keys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MigrationStatement is a statement that brings one shard table to the declared TableFields
+type MigrationStatement struct {
+	Shard uint
+	Query string
+	// Drop is set for statements dropping columns missing from TableFields, Init and Migrate
+	// apply them only if the table has WithDropColumns
+	Drop bool
+}
+
+// WithDropColumns lets Init and Migrate drop columns that are not declared in TableFields.
+// Without it they are only reported by PlanMigration, a binary with older fields starting during
+// a rolling deploy would drop columns added by the new one.
+func WithDropColumns() TableOption {
+	return func(table *Table) {
+		table.dropColumns = true
+	}
+}
+
+func normalizeDefault(v string) string {
+	v = strings.Trim(strings.TrimSpace(v), "'\"")
+	switch strings.ToLower(v) {
+	case "true":
+		return "1"
+	case "false":
+		return "0"
+	}
+	return v
+}
+
+// init creates shard table or migrates the existing one
+func (shard *Shard) init() error {
+	exists, err := shard.exists()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return shard.create()
+	}
+	plan, err := shard.planMigration()
+	if err != nil {
+		return err
+	}
+	return shard.table.applyMigration(plan)
+}
+
+func (shard *Shard) create() error {
+	dialect := shard.table.dialect
+	fieldsString := ""
+	var postSQLs []string
+	for _, field := range shard.table.fields {
+		fieldsString += field.QueryInit(dialect, shard.name) + ", "
+		queryAfter := field.QueryAfter(dialect, shard.name)
+		if queryAfter != "" {
+			postSQLs = append(postSQLs, queryAfter+";")
+		}
+	}
+	fieldsString = fieldsString[:len(fieldsString)-2]
+	sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", dialect.QuoteIdentifier(shard.name), fieldsString)
+	_, err := shard.Exec(sql)
+	if err != nil {
+		return err
+	}
+	for _, postSQL := range postSQLs {
+		logger.Debug(postSQL)
+		_, err = shard.Exec(postSQL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (shard *Shard) describe() (*TableDescription, error) {
+	return shard.table.dialect.DescribeTable(shard.driver, shard.name)
+}
+
+func (shard *Shard) exists() (bool, error) {
+	query, args := shard.table.dialect.TableExists(shard.name)
+	rows, err := shard.Query(query, args...)
+	if err != nil {
+		return false, err
+	}
+	found := rows.Next()
+	return found, rows.Close()
+}
+
+// planMigration returns ALTER statements for an existing shard table
+func (shard *Shard) planMigration() ([]MigrationStatement, error) {
+	description, err := shard.describe()
+	if err != nil {
+		return nil, err
+	}
+	name := shard.name
+	var plan []MigrationStatement
+	for _, field := range shard.table.fields {
+		for _, query := range field.QueryAlter(shard.table.dialect, name, description) {
+			plan = append(plan, MigrationStatement{Shard: shard.num, Query: query})
+		}
+	}
+	var removed []string
+	for key, column := range description.Columns {
+		if shard.table.getField(string(key)) == nil {
+			removed = append(removed, column.Name)
+		}
+	}
+	sort.Strings(removed)
+	for _, column := range removed {
+		plan = append(plan, MigrationStatement{Shard: shard.num, Drop: true, Query: fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s",
+			shard.table.dialect.QuoteIdentifier(name), shard.table.dialect.QuoteIdentifier(column))})
+	}
+	return plan, nil
+}
+
+// PlanMigration describes every existing shard table and returns the statements
+// needed to bring it to the declared TableFields, without executing them.
+// Shards whose table does not exist yet are skipped, Init creates them.
+// Drops of undeclared columns are included even without WithDropColumns.
+func (table *Table) PlanMigration() ([]MigrationStatement, error) {
+	var plan []MigrationStatement
+	for shardId := 0; shardId < len(table.Shards); shardId++ {
+		shard := table.Shards[shardId]
+		exists, err := shard.exists()
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		statements, err := shard.planMigration()
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, statements...)
+	}
+	return plan, nil
+}
+
+// Migrate applies PlanMigration to all shards, columns are dropped only with WithDropColumns
+func (table *Table) Migrate() error {
+	plan, err := table.PlanMigration()
+	if err != nil {
+		return err
+	}
+	return table.applyMigration(plan)
+}
+
+func (table *Table) applyMigration(plan []MigrationStatement) error {
+	for _, migration := range plan {
+		if migration.Drop && !table.dropColumns {
+			logger.Warn("column of ", table.GetName(migration.Shard), " is not declared, it is kept: ", migration.Query)
+			continue
+		}
+		logger.Debug(migration.Query)
+		_, err := table.GetShard(migration.Shard).Exec(migration.Query + ";")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package eplidr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func migrationQueries(t *testing.T, table *Table) []string {
+	t.Helper()
+	plan, err := table.PlanMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	for _, statement := range plan {
+		if statement.Drop {
+			queries = append(queries, "drop: "+statement.Query)
+		} else {
+			queries = append(queries, statement.Query)
+		}
+	}
+	return queries
+}
+
+func TestPlanMigration(t *testing.T) {
+	db := openSQLite(t)
+	table := newSQLiteTable(t, db, "items", 1, itemFields)
+	if queries := migrationQueries(t, table); len(queries) != 0 {
+		t.Fatalf("created table has migrations %v", queries)
+	}
+	fields := TableFields{
+		itemFields[0],
+		itemFields[1],
+		DefaultTableField{Name: "status", Type: TypeInt64},
+		DefaultTableField{Name: "created", Type: TypeInt64, DefaultValue: 0},
+		DefaultTableField{Name: "note", Type: GetSizedType(BasicTypeVarChar, 32), DefaultValue: "it's"},
+	}
+	table = newSQLiteTable(t, db, "items", 1, fields)
+	want := []string{`drop: ALTER TABLE "items0" DROP COLUMN "data"`}
+	if queries := migrationQueries(t, table); !reflect.DeepEqual(queries, want) {
+		t.Errorf("after Init: %v, want %v", queries, want)
+	}
+	description, err := SQLite.DescribeTable(db, "items0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := description.getColumn("created"); !ok {
+		t.Error("created is not added")
+	}
+	if err := table.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	var note string
+	if err := db.QueryRow(`SELECT "note" FROM "items0" WHERE "id" = 1`).Scan(&note); err != nil {
+		t.Fatal(err)
+	}
+	if note != "it's" {
+		t.Errorf("note default = %q, want %q", note, "it's")
+	}
+	if description.hasIndex(SQLite.IndexName("items0", "status")) {
+		t.Error("index of status is not dropped")
+	}
+	if _, ok := description.getColumn("data"); !ok {
+		t.Error("data is dropped without WithDropColumns")
+	}
+	table = newSQLiteTable(t, db, "items", 1, fields, WithDropColumns())
+	if queries := migrationQueries(t, table); len(queries) != 0 {
+		t.Errorf("after Init with WithDropColumns: %v", queries)
+	}
+}
@@ -0,0 +1,320 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MySQL is the default dialect
+var MySQL Dialect = MySQLDialect{}
+
+type MySQLDialect struct{}
+
+func (d MySQLDialect) Name() string {
+	return "mysql"
+}
+
+func (d MySQLDialect) QuoteIdentifier(name string) string {
+	return quoteWith("`", name)
+}
+
+// QuoteString escapes backslashes too, they are escape characters in MySQL string literals
+func (d MySQLDialect) QuoteString(s string) string {
+	return quoteWith("'", strings.ReplaceAll(s, `\`, `\\`))
+}
+
+// BinaryCollation is false, default collations are case insensitive
+func (d MySQLDialect) BinaryCollation() bool {
+	return false
+}
+
+func (d MySQLDialect) QuoteBytes(b []byte) string {
+	return "X'" + hex.EncodeToString(b) + "'"
+}
+
+func (d MySQLDialect) Rebind(query string) string {
+	return query
+}
+
+func (d MySQLDialect) ColumnType(t Type) string {
+	return t.Query()
+}
+
+func (d MySQLDialect) SameType(t Type, described string) bool {
+	return normalizeColumnType(t.Query()) == normalizeColumnType(described)
+}
+
+func (d MySQLDialect) EncodeValue(t Type, v interface{}) (string, interface{}) {
+	if t == TypeUUID {
+		return "UUID_TO_BIN(?, true)", uuidArg(v)
+	}
+	switch t.GetBasicType() {
+	case BasicTypeVarByte, BasicTypeBinary:
+		return "UNHEX(?)", hexArg(v)
+	}
+	return "?", normalizeArg(v)
+}
+
+func (d MySQLDialect) DecodeColumn(t Type, column string) string {
+	if t == TypeUUID {
+		return fmt.Sprintf("BIN_TO_UUID(%s, true)", column)
+	}
+	return column
+}
+
+// UUIDSortKey returns id as UUID_TO_BIN(id, true) stores it, time_hi and time_mid are moved before time_low
+func (d MySQLDialect) UUIDSortKey(id uuid.UUID) []byte {
+	key := make([]byte, 0, len(id))
+	key = append(key, id[6:8]...)
+	key = append(key, id[4:6]...)
+	key = append(key, id[0:4]...)
+	return append(key, id[8:]...)
+}
+
+func (d MySQLDialect) Upsert(keys []string, columns []string) string {
+	var updates []string
+	for _, column := range columns {
+		updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", d.QuoteIdentifier(column), d.QuoteIdentifier(column)))
+	}
+	if len(keys) == 0 {
+		// Without primary key rows can not conflict, plain INSERT is kept
+		return ""
+	}
+	if len(updates) == 0 {
+		// Nothing to update, keep the statement valid and the row untouched
+		for _, key := range keys {
+			updates = append(updates, fmt.Sprintf("%s = %s", d.QuoteIdentifier(key), d.QuoteIdentifier(key)))
+		}
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+func (d MySQLDialect) TableExists(table string) (string, []interface{}) {
+	return "SELECT 1 FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;", []interface{}{table}
+}
+
+func (d MySQLDialect) DescribeTable(db *sql.DB, table string) (*TableDescription, error) {
+	description := &TableDescription{
+		Columns: make(map[FieldName]ColumnDescription),
+		Indexes: make(map[string][]string),
+	}
+	rows, err := db.Query(fmt.Sprintf("DESCRIBE %s;", d.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var field, columnType, null, key, extra sql.NullString
+		var column ColumnDescription
+		err = rows.Scan(&field, &columnType, &null, &key, &column.Default, &extra)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column.Name = field.String
+		column.Type = normalizeColumnType(columnType.String)
+		column.Nullable = null.String == "YES"
+		description.Columns[FieldName(strings.ToLower(column.Name))] = column
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(fmt.Sprintf("SHOW INDEX FROM %s;", d.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, err
+	}
+	names, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	indexes := make(map[string][]indexColumn)
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(names))
+		pointers := make([]interface{}, len(names))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = rows.Scan(pointers...)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var keyName string
+		var column indexColumn
+		for i, name := range names {
+			switch strings.ToLower(name) {
+			case "key_name":
+				keyName = string(values[i])
+			case "column_name":
+				column.name = string(values[i])
+			case "seq_in_index":
+				column.seq, _ = strconv.Atoi(string(values[i]))
+			}
+		}
+		indexes[keyName] = append(indexes[keyName], column)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for keyName, columns := range indexes {
+		if keyName == "PRIMARY" {
+			description.PrimaryKeyName = keyName
+			description.PrimaryKey = sortIndexColumns(columns)
+		} else {
+			description.Indexes[keyName] = sortIndexColumns(columns)
+		}
+	}
+	return description, nil
+}
+
+func (d MySQLDialect) IndexName(table string, column string) string {
+	return "I" + column
+}
+
+func (d MySQLDialect) DropIndex(table string, index string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", d.QuoteIdentifier(index), d.QuoteIdentifier(table))
+}
+
+func (d MySQLDialect) ModifyColumn(table string, field DefaultTableField) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", d.QuoteIdentifier(table), field.definition(d, ""))}
+}
+
+func (d MySQLDialect) AlterPrimaryKey(table string, description *TableDescription, name string, keys []string) []string {
+	query := fmt.Sprintf("ALTER TABLE %s ", d.QuoteIdentifier(table))
+	if len(description.PrimaryKey) != 0 {
+		query += "DROP PRIMARY KEY, "
+	}
+	if name != "" {
+		query += fmt.Sprintf("ADD CONSTRAINT %s ", d.QuoteIdentifier(name))
+	} else {
+		query += "ADD "
+	}
+	return []string{query + fmt.Sprintf("PRIMARY KEY (%s)", columnNames(d, keys))}
+}
+
+type indexColumn struct {
+	seq  int
+	name string
+}
+
+func sortIndexColumns(columns []indexColumn) []string {
+	sort.Slice(columns, func(i, j int) bool { return columns[i].seq < columns[j].seq })
+	var names []string
+	for _, column := range columns {
+		names = append(names, column.name)
+	}
+	return names
+}
+
+var integerDisplayWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+
+func normalizeColumnType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	switch t {
+	case "bool", "boolean":
+		return "tinyint(1)"
+	}
+	t = strings.Replace(t, "integer", "int", 1)
+	if !strings.HasPrefix(t, "tinyint(1)") {
+		t = integerDisplayWidth.ReplaceAllString(t, "$1")
+	}
+	return t
+}
+
+func (d MySQLDialect) Limit(limit int, offset int) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0:
+		// OFFSET requires LIMIT, the maximum is used as documented
+		return fmt.Sprintf(" LIMIT 18446744073709551615 OFFSET %d", offset)
+	}
+	return ""
+}
+
+func (d MySQLDialect) ForUpdate() string {
+	return " FOR UPDATE"
+}
+
+// RenameTables returns one RENAME TABLE statement, it renames all tables atomically
+func (d MySQLDialect) RenameTables(renames []TableRename) []string {
+	var pairs []string
+	for _, rename := range renames {
+		pairs = append(pairs, d.QuoteIdentifier(rename.From)+" TO "+d.QuoteIdentifier(rename.To))
+	}
+	return []string{"RENAME TABLE " + strings.Join(pairs, ", ")}
+}
+
+func (d MySQLDialect) ReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS;")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		// not a replica
+		return 0, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	err = rows.Scan(pointers...)
+	if err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errors.New("eplidr: replication is not running")
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		return time.Duration(seconds) * time.Second, err
+	}
+	return 0, errors.New("eplidr: replica status has no lag")
+}
+
+var mysqlErrorCodes = map[uint16]ErrorCode{
+	1062: CodeDuplicateKey,
+	1586: CodeDuplicateKey,
+	1213: CodeDeadlock,
+	1205: CodeLockTimeout,
+	3572: CodeLockTimeout,
+	1054: CodeUnknownColumn,
+	1040: CodeConnection,
+	1053: CodeConnection,
+}
+
+// ErrorCode classifies *mysql.MySQLError by its error number
+func (d MySQLDialect) ErrorCode(err error) ErrorCode {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErrorCodes[mysqlErr.Number]
+	}
+	if errors.Is(err, mysql.ErrInvalidConn) {
+		return CodeConnection
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,136 @@
+package eplidr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Keyset pagination: a cursor holds the order of the select and the values of its columns in the last
+// returned row, the next page selects rows ordered after these values. Order columns should not be nullable.
+
+var ErrInvalidCursor = errors.New("eplidr: invalid cursor")
+
+type cursorToken struct {
+	Order  []string `json:"o"`
+	Values string   `json:"v"`
+}
+
+// orderSignature is a comparable form of order, descending columns are prefixed with -
+func orderSignature(order []OrderBy) []string {
+	signature := make([]string, len(order))
+	for i, column := range order {
+		signature[i] = strings.ToLower(column.Column)
+		if column.Desc {
+			signature[i] = "-" + signature[i]
+		}
+	}
+	return signature
+}
+
+func encodeCursor(order []OrderBy, values []interface{}) (string, error) {
+	encoded, err := encodeCursorValues(values)
+	if err != nil {
+		return "", err
+	}
+	bytes, err := json.Marshal(cursorToken{Order: orderSignature(order), Values: encoded})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// after returns the condition matching rows ordered after the After cursor, nil if it is not set
+func (options SelectOptions) after(table *Table) (Condition, error) {
+	if options.After == "" {
+		return nil, nil
+	}
+	bytes, err := base64.RawURLEncoding.DecodeString(options.After)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var token cursorToken
+	if json.Unmarshal(bytes, &token) != nil {
+		return nil, ErrInvalidCursor
+	}
+	values, err := decodeCursorValues(token.Values)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	order := options.order(table)
+	signature := orderSignature(order)
+	if len(token.Order) != len(signature) || len(values) != len(order) {
+		return nil, errors.New("eplidr: cursor was returned by a select with another order")
+	}
+	for i := range signature {
+		if token.Order[i] != signature[i] {
+			return nil, errors.New("eplidr: cursor was returned by a select with another order")
+		}
+	}
+	// (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ...
+	var alternatives []Condition
+	for i, column := range order {
+		conditions := make([]Condition, 0, i+1)
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, Eq(order[j].Column, values[j]))
+		}
+		if column.Desc {
+			conditions = append(conditions, Lt(column.Column, values[i]))
+		} else {
+			conditions = append(conditions, Gt(column.Column, values[i]))
+		}
+		alternatives = append(alternatives, And(conditions...))
+	}
+	return Or(alternatives...), nil
+}
+
+// cursor returns the cursor of row, get returns the value of a column in it
+func cursor(order []OrderBy, get func(name string) interface{}) string {
+	if len(order) == 0 {
+		return ""
+	}
+	values := make([]interface{}, len(order))
+	for i, column := range order {
+		values[i] = get(column.Column)
+	}
+	token, err := encodeCursor(order, values)
+	if err != nil {
+		logger.Error(err.Error())
+		return ""
+	}
+	return token
+}
+
+// Cursor returns the cursor of the last row to be passed as SelectOptions.After for the next page.
+// It is empty if there are no rows or the select had no SelectOptions.
+func (res *FullSelectResult) Cursor() string {
+	if len(res.cache) == 0 {
+		return ""
+	}
+	row := res.cache[len(res.cache)-1]
+	return cursor(res.order, func(name string) interface{} {
+		for i, field := range res.fields {
+			if strings.EqualFold(field.GetName(), name) {
+				return row[i]
+			}
+		}
+		return nil
+	})
+}
+
+// Cursor returns the cursor of the current row, rows after it are selected with it as SelectOptions.After.
+// It is empty if the select had no SelectOptions.
+func (res *GradualSelectResult) Cursor() string {
+	if len(res.cache) == 0 {
+		return ""
+	}
+	return cursor(res.order, func(name string) interface{} {
+		for field, value := range res.cache {
+			if strings.EqualFold(field, name) {
+				return value
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package eplidr
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSelectAllPages(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 3, itemFields)
+	putItems(t, table, 10)
+	options := SelectOptions{OrderBy: []OrderBy{{Column: "status"}}, Limit: 3}
+	var ids []int64
+	for page := 0; page < 10; page++ {
+		result, err := table.SelectAll(nil, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor := result.Cursor()
+		pageIDs := selectedIDs(t, result)
+		if len(pageIDs) == 0 {
+			break
+		}
+		ids = append(ids, pageIDs...)
+		options.After = cursor
+	}
+	if want := []int64{0, 3, 6, 9, 1, 4, 7, 2, 5, 8}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("pages %v, want %v", ids, want)
+	}
+}
+
+func TestSelectAllUUIDOrder(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "users", 3, TableFields{
+		DefaultTableField{Name: "id", Type: TypeUUID, PrimaryKey: true},
+	})
+	var want []string
+	for i := 0; i < 20; i++ {
+		id := uuid.New()
+		err := table.Put(id, Columns{{"id", id}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, id.String())
+	}
+	sort.Strings(want)
+	result, err := table.SelectAll(nil, SelectOptions{OrderBy: []OrderBy{{Column: "id"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for result.Next() {
+		id, err := result.GetUUID("id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCompareUUIDs(t *testing.T) {
+	// a has the lower time_low, b the lower time_hi
+	a := uuid.MustParse("00000001-0000-0002-0000-000000000000")
+	b := uuid.MustParse("00000002-0000-0001-0000-000000000000")
+	if compareValues(SQLite, a, b) >= 0 || compareValues(PostgreSQL, a, b) >= 0 {
+		t.Error("canonical order: a must be before b")
+	}
+	// UUID_TO_BIN(id, true) stores time_hi first
+	if compareValues(MySQL, a, b) <= 0 {
+		t.Error("MySQL order: b must be before a")
+	}
+	if got := compareValues(MySQL, nil, a); got != -1 {
+		t.Errorf("NULL compared to %d, want -1", got)
+	}
+}
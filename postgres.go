@@ -0,0 +1,286 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// PostgreSQL dialect, UUID is stored in native uuid columns and binary types in bytea
+var PostgreSQL Dialect = PostgreSQLDialect{}
+
+type PostgreSQLDialect struct{}
+
+func (d PostgreSQLDialect) Name() string {
+	return "postgres"
+}
+
+func (d PostgreSQLDialect) QuoteIdentifier(name string) string {
+	return quoteWith(`"`, name)
+}
+
+func (d PostgreSQLDialect) QuoteString(s string) string {
+	return quoteWith("'", s)
+}
+
+// BinaryCollation is false, strings are ordered by the locale of the database
+func (d PostgreSQLDialect) BinaryCollation() bool {
+	return false
+}
+
+func (d PostgreSQLDialect) QuoteBytes(b []byte) string {
+	return "'\\x" + hex.EncodeToString(b) + "'::bytea"
+}
+
+func (d PostgreSQLDialect) Rebind(query string) string {
+	return rebindNumbered(query, "$")
+}
+
+func (d PostgreSQLDialect) ColumnType(t Type) string {
+	if t == TypeUUID {
+		return "UUID"
+	}
+	switch t.GetBasicType() {
+	case BasicTypeUint64:
+		return "NUMERIC(20)"
+	case BasicTypeInt64:
+		return "BIGINT"
+	case BasicTypeInt32:
+		return "INTEGER"
+	case BasicTypeUint32:
+		return "BIGINT"
+	case BasicTypeFloat:
+		return "DOUBLE PRECISION"
+	case BasicTypeBool:
+		return "BOOLEAN"
+	case BasicTypeBinary, BasicTypeVarByte:
+		return "BYTEA"
+	case BasicTypeVarChar:
+		if sized, ok := sizedType(t); ok {
+			return fmt.Sprintf("VARCHAR(%d)", sized.Size)
+		}
+		return "TEXT"
+	}
+	return ""
+}
+
+func (d PostgreSQLDialect) SameType(t Type, described string) bool {
+	return strings.ToLower(d.ColumnType(t)) == described
+}
+
+func (d PostgreSQLDialect) EncodeValue(t Type, v interface{}) (string, interface{}) {
+	if t == TypeUUID {
+		return "?", uuidArg(v)
+	}
+	switch t.GetBasicType() {
+	case BasicTypeVarByte, BasicTypeBinary:
+		return "?", bytesArg(v)
+	}
+	return "?", normalizeArg(v)
+}
+
+func (d PostgreSQLDialect) DecodeColumn(t Type, column string) string {
+	if t == TypeUUID {
+		return fmt.Sprintf("CAST(%s AS TEXT)", column)
+	}
+	return column
+}
+
+func (d PostgreSQLDialect) UUIDSortKey(id uuid.UUID) []byte {
+	return id[:]
+}
+
+func (d PostgreSQLDialect) Upsert(keys []string, columns []string) string {
+	return upsertOnConflict(d, keys, columns)
+}
+
+func upsertOnConflict(d Dialect, keys []string, columns []string) string {
+	if len(keys) == 0 {
+		// Without primary key rows can not conflict, plain INSERT is kept
+		return ""
+	}
+	if len(columns) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", columnNames(d, keys))
+	}
+	var updates []string
+	for _, column := range columns {
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", d.QuoteIdentifier(column), d.QuoteIdentifier(column)))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", columnNames(d, keys), strings.Join(updates, ", "))
+}
+
+func (d PostgreSQLDialect) TableExists(table string) (string, []interface{}) {
+	return "SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?;", []interface{}{table}
+}
+
+func (d PostgreSQLDialect) DescribeTable(db *sql.DB, table string) (*TableDescription, error) {
+	description := &TableDescription{
+		Columns: make(map[FieldName]ColumnDescription),
+		Indexes: make(map[string][]string),
+	}
+	rows, err := db.Query(d.Rebind(`SELECT column_name, data_type, character_maximum_length, numeric_precision, is_nullable, column_default
+FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?;`), table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, dataType, nullable string
+		var length, precision sql.NullInt64
+		var column ColumnDescription
+		err = rows.Scan(&name, &dataType, &length, &precision, &nullable, &column.Default)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column.Name = name
+		switch dataType {
+		case "character varying":
+			column.Type = fmt.Sprintf("varchar(%d)", length.Int64)
+		case "numeric":
+			column.Type = fmt.Sprintf("numeric(%d)", precision.Int64)
+		default:
+			column.Type = dataType
+		}
+		column.Nullable = nullable == "YES"
+		if column.Default.Valid {
+			// 'value'::character varying
+			if i := strings.Index(column.Default.String, "::"); i != -1 {
+				column.Default.String = column.Default.String[:i]
+			}
+		}
+		description.Columns[FieldName(strings.ToLower(name))] = column
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(d.Rebind(`SELECT i.relname, a.attname, ix.indisprimary, array_position(ix.indkey::int2[], a.attnum)
+FROM pg_class t
+JOIN pg_index ix ON t.oid = ix.indrelid
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey)
+WHERE t.relname = ? AND t.relnamespace = current_schema()::regnamespace;`), table)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string][]indexColumn)
+	primary := ""
+	for rows.Next() {
+		var index string
+		var isPrimary bool
+		var column indexColumn
+		err = rows.Scan(&index, &column.name, &isPrimary, &column.seq)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if isPrimary {
+			primary = index
+		}
+		indexes[index] = append(indexes[index], column)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for index, columns := range indexes {
+		if index == primary {
+			description.PrimaryKeyName = index
+			description.PrimaryKey = sortIndexColumns(columns)
+		} else {
+			description.Indexes[index] = sortIndexColumns(columns)
+		}
+	}
+	return description, nil
+}
+
+// IndexName is prefixed with table, index names are unique per schema
+func (d PostgreSQLDialect) IndexName(table string, column string) string {
+	return table + "_I" + column
+}
+
+func (d PostgreSQLDialect) DropIndex(table string, index string) string {
+	return fmt.Sprintf("DROP INDEX %s", d.QuoteIdentifier(index))
+}
+
+func (d PostgreSQLDialect) ModifyColumn(table string, field DefaultTableField) []string {
+	prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", d.QuoteIdentifier(table), d.QuoteIdentifier(field.Name))
+	columnType := d.ColumnType(field.Type)
+	queries := []string{prefix + fmt.Sprintf("TYPE %s USING %s::%s", columnType, d.QuoteIdentifier(field.Name), columnType)}
+	if field.Nullable {
+		queries = append(queries, prefix+"DROP NOT NULL")
+	} else {
+		queries = append(queries, prefix+"SET NOT NULL")
+	}
+	if field.DefaultValue != nil {
+		queries = append(queries, prefix+"SET DEFAULT "+defaultLiteral(d, field.DefaultValue))
+	} else {
+		queries = append(queries, prefix+"DROP DEFAULT")
+	}
+	return queries
+}
+
+func (d PostgreSQLDialect) AlterPrimaryKey(table string, description *TableDescription, name string, keys []string) []string {
+	query := fmt.Sprintf("ALTER TABLE %s ", d.QuoteIdentifier(table))
+	if description.PrimaryKeyName != "" {
+		query += fmt.Sprintf("DROP CONSTRAINT %s, ", d.QuoteIdentifier(description.PrimaryKeyName))
+	}
+	return []string{query + fmt.Sprintf("ADD PRIMARY KEY (%s)", columnNames(d, keys))}
+}
+
+func (d PostgreSQLDialect) Limit(limit int, offset int) string {
+	result := ""
+	if limit > 0 {
+		result += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		result += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return result
+}
+
+func (d PostgreSQLDialect) ForUpdate() string {
+	return " FOR UPDATE"
+}
+
+func (d PostgreSQLDialect) RenameTables(renames []TableRename) []string {
+	return renameEach(d, renames)
+}
+
+func (d PostgreSQLDialect) ReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := db.QueryRowContext(ctx, "SELECT CASE WHEN pg_is_in_recovery() THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) ELSE 0 END;").Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+var sqlStateCodes = map[string]ErrorCode{
+	"23505": CodeDuplicateKey,
+	"40P01": CodeDeadlock,
+	"40001": CodeDeadlock,
+	"55P03": CodeLockTimeout,
+	"42703": CodeUnknownColumn,
+}
+
+// ErrorCode classifies errors by their SQLSTATE, pgx and lib/pq errors provide it
+func (d PostgreSQLDialect) ErrorCode(err error) ErrorCode {
+	var state interface{ SQLState() string }
+	if !errors.As(err, &state) {
+		return CodeUnknown
+	}
+	if code, ok := sqlStateCodes[state.SQLState()]; ok {
+		return code
+	}
+	if strings.HasPrefix(state.SQLState(), "08") {
+		return CodeConnection
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,166 @@
+package eplidr
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryLogOptions configure QueryLogger
+type QueryLogOptions struct {
+	// Logger receives the records, a TextLogger writing to stderr is used if it is nil
+	Logger StructuredLogger
+	// SlowThreshold is the duration after which a statement is logged at LevelWarn, 0 disables it
+	SlowThreshold time.Duration
+	// LogStatements logs every statement at LevelDebug
+	LogStatements bool
+	// LogArgs adds args of statements to the records, values of sensitive fields are redacted
+	LogArgs bool
+	// ErrorInterval is how often the same error of the same statement is logged, the records in between
+	// are counted and reported by the next one. 0 logs every error.
+	ErrorInterval time.Duration
+}
+
+var DefaultQueryLogOptions = QueryLogOptions{
+	SlowThreshold: 500 * time.Millisecond,
+	ErrorInterval: 10 * time.Second,
+}
+
+// QueryLogger is a Hook logging failed and slow statements with structured fields. Statements are logged
+// as fingerprints, values are never part of them.
+type QueryLogger struct {
+	options QueryLogOptions
+
+	mx sync.Mutex
+	// errors are the last logged errors by statement fingerprint and error code
+	errors map[errorLogKey]*errorLogState
+}
+
+type errorLogKey struct {
+	statement string
+	code      ErrorCode
+}
+
+type errorLogState struct {
+	logged     time.Time
+	suppressed int
+}
+
+func NewQueryLogger(options QueryLogOptions) *QueryLogger {
+	if options.Logger == nil {
+		options.Logger = NewTextLogger(os.Stderr, LevelDebug)
+	}
+	return &QueryLogger{
+		options: options,
+		errors:  make(map[errorLogKey]*errorLogState),
+	}
+}
+
+func (l *QueryLogger) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (l *QueryLogger) After(ctx context.Context, event *QueryEvent) {
+	slow := l.options.SlowThreshold > 0 && event.Duration >= l.options.SlowThreshold
+	if event.Err == nil && !slow && !l.options.LogStatements {
+		return
+	}
+	statement := fingerprint(event.Query)
+	fields := []any{
+		"table", event.Table,
+		"shard", event.Shard,
+		"operation", string(event.Operation),
+		"statement", statement,
+		"duration", event.Duration,
+	}
+	if event.RowsAffected >= 0 {
+		fields = append(fields, "rows_affected", event.RowsAffected)
+	}
+	if event.Replica {
+		fields = append(fields, "replica", true)
+	}
+	if l.options.LogArgs {
+		fields = append(fields, "args", event.RedactedArgs())
+	}
+	switch {
+	case event.Err != nil:
+		code := errorCode(event.Err)
+		suppressed, ok := l.allowError(errorLogKey{statement: statement, code: code})
+		if !ok {
+			return
+		}
+		fields = append(fields, "code", code.String(), "error", sanitizeError(event.Err))
+		if suppressed > 0 {
+			fields = append(fields, "suppressed", suppressed)
+		}
+		l.options.Logger.Log(ctx, LevelError, "statement failed", fields...)
+	case slow:
+		l.options.Logger.Log(ctx, LevelWarn, "slow statement", fields...)
+	default:
+		l.options.Logger.Log(ctx, LevelDebug, "statement", fields...)
+	}
+}
+
+var (
+	fingerprintStrings      = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	fingerprintNumbers      = regexp.MustCompile(`\b\d+(?:\.\d+)?\b|\$\d+`)
+	fingerprintPlaceholders = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+	fingerprintRows         = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+	fingerprintSpaces       = regexp.MustCompile(`\s+`)
+)
+
+// fingerprint returns query with values replaced by ? and lists of values collapsed, statements differing
+// only by values have the same fingerprint
+func fingerprint(query string) string {
+	query = fingerprintStrings.ReplaceAllString(query, "?")
+	query = fingerprintNumbers.ReplaceAllString(query, "?")
+	query = fingerprintPlaceholders.ReplaceAllString(query, "?")
+	query = fingerprintRows.ReplaceAllString(query, "(?)")
+	return strings.TrimSpace(fingerprintSpaces.ReplaceAllString(query, " "))
+}
+
+// sanitizeError returns the message of err without quoted literals, drivers quote the values that failed,
+// e.g. MySQL "Duplicate entry 'alice@example.com' for key ..."
+func sanitizeError(err error) string {
+	return fingerprintStrings.ReplaceAllString(err.Error(), "?")
+}
+
+// allowError reports whether an error of key may be logged and how many were suppressed since the last one
+func (l *QueryLogger) allowError(key errorLogKey) (int, bool) {
+	if l.options.ErrorInterval <= 0 {
+		return 0, true
+	}
+	now := time.Now()
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	state, ok := l.errors[key]
+	if ok && now.Sub(state.logged) < l.options.ErrorInterval {
+		state.suppressed++
+		return 0, false
+	}
+	if !ok {
+		if len(l.errors) >= maxErrorLogKeys {
+			l.forgetErrors(now)
+		}
+		state = &errorLogState{}
+		l.errors[key] = state
+	}
+	suppressed := state.suppressed
+	state.logged = now
+	state.suppressed = 0
+	return suppressed, true
+}
+
+// maxErrorLogKeys limits the remembered errors, errors older than ErrorInterval are forgotten after it
+const maxErrorLogKeys = 1024
+
+func (l *QueryLogger) forgetErrors(now time.Time) {
+	for key, state := range l.errors {
+		if now.Sub(state.logged) >= l.options.ErrorInterval {
+			delete(l.errors, key)
+		}
+	}
+}
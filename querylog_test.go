@@ -0,0 +1,143 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type logRecord struct {
+	level  LogLevel
+	msg    string
+	fields map[string]any
+}
+
+// recordingLogger keeps the records it receives
+type recordingLogger struct {
+	mx      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level LogLevel, msg string, args ...any) {
+	fields := make(map[string]any, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[args[i].(string)] = args[i+1]
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) take() []logRecord {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	records := l.records
+	l.records = nil
+	return records
+}
+
+// failingHook fails every statement with err
+type failingHook struct {
+	err error
+}
+
+func (h failingHook) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	return ctx, h.err
+}
+func (h failingHook) After(ctx context.Context, event *QueryEvent) {}
+
+var sensitiveFields = append(TableFields{
+	DefaultTableField{Name: "email", Type: GetSizedType(BasicTypeVarChar, 64), Nullable: true, Sensitive: true},
+}, itemFields...)
+
+func TestQueryLoggerRedaction(t *testing.T) {
+	logger := &recordingLogger{}
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, sensitiveFields,
+		WithHooks(NewQueryLogger(QueryLogOptions{Logger: logger, LogStatements: true, LogArgs: true})))
+	logger.take()
+	err := table.Put(int64(1), Columns{{"id", int64(1)}, {"email", "alice@example.com"}, {"status", int64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := logger.take()
+	if len(records) != 1 {
+		t.Fatalf("%d records of a put, want 1", len(records))
+	}
+	record := records[0]
+	if record.level != LevelDebug || record.fields["operation"] != "put" || record.fields["table"] != "items" {
+		t.Errorf("record %+v", record)
+	}
+	args := record.fields["args"].([]interface{})
+	if len(args) != 3 || args[0] != int64(1) || args[1] != Redacted || args[2] != int64(1) {
+		t.Errorf("args %v, want the email redacted", args)
+	}
+	if statement := record.fields["statement"].(string); strings.Contains(statement, "alice") {
+		t.Errorf("statement %q contains a value", statement)
+	}
+}
+
+func TestQueryLoggerErrors(t *testing.T) {
+	logger := &recordingLogger{}
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, sensitiveFields)
+	failure := errors.New("Error 1062 (23000): Duplicate entry 'alice@example.com' for key 'items0.email'")
+	table.hooks = []Hook{
+		NewQueryLogger(QueryLogOptions{Logger: logger, ErrorInterval: 100 * time.Millisecond}),
+		failingHook{err: failure},
+	}
+	put := func() {
+		err := table.Put(int64(1), Columns{{"id", int64(1)}, {"email", "alice@example.com"}, {"status", int64(1)}})
+		if !errors.Is(err, failure) {
+			t.Fatalf("put: %v, want the hook error", err)
+		}
+	}
+	put()
+	put()
+	records := logger.take()
+	if len(records) != 1 {
+		t.Fatalf("%d records of a repeated error, want 1", len(records))
+	}
+	message := records[0].fields["error"].(string)
+	if records[0].level != LevelError || strings.Contains(message, "alice") || !strings.Contains(message, "Duplicate entry ?") {
+		t.Errorf("error record %v %q, want the literal stripped", records[0].level, message)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	put()
+	records = logger.take()
+	if len(records) != 1 || records[0].fields["suppressed"] != 1 {
+		t.Fatalf("records after the interval %+v, want one reporting 1 suppressed", records)
+	}
+}
+
+func TestQueryLoggerSlow(t *testing.T) {
+	logger := &recordingLogger{}
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields,
+		WithHooks(NewQueryLogger(QueryLogOptions{Logger: logger, SlowThreshold: time.Nanosecond})))
+	logger.take()
+	if _, err := table.Exec("SELECT 1 FROM {table} WHERE name = 'secret';", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	records := logger.take()
+	if len(records) != 1 || records[0].level != LevelWarn || records[0].msg != "slow statement" {
+		t.Fatalf("records %+v, want a slow statement", records)
+	}
+	if statement := records[0].fields["statement"]; statement != `SELECT ? FROM "items0" WHERE name = ?;` {
+		t.Errorf("statement %q", statement)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := map[string]string{
+		"INSERT INTO t (a, b) VALUES (?, ?), (?, ?), (?, ?);": "INSERT INTO t (a, b) VALUES (?);",
+		"SELECT * FROM t WHERE a IN (1, 2, 3) AND b = 'x''y'": "SELECT * FROM t WHERE a IN (?) AND b = ?",
+		"UPDATE t\n  SET a = $1  WHERE b = 2.5":               "UPDATE t SET a = ? WHERE b = ?",
+	}
+	for query, want := range tests {
+		if got := fingerprint(query); got != want {
+			t.Errorf("fingerprint(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardDrivers are the primary and the read replicas of a shard. NewTable accepts []ShardDrivers with
+// drivers of every shard or ShardDrivers used by all shards.
+// Get, GradualSelect, FullSelect and SelectAll read from replicas, writes, raw statements and Tx use the primary.
+type ShardDrivers struct {
+	Primary  *sql.DB
+	Replicas []*sql.DB
+}
+
+type ReplicaBalancer int
+
+const (
+	// RoundRobin reads from replicas in turn
+	RoundRobin ReplicaBalancer = iota
+	// LeastLatency reads from the replica with the lowest latency
+	LeastLatency
+)
+
+// ReplicaOptions configure reads from replicas. A replica that fails with a connection error or lags
+// more than MaxLag is not read until it recovers, reads fall back to the primary if no replica is available.
+type ReplicaOptions struct {
+	Balancer ReplicaBalancer
+	// MaxLag is the replication lag after which a replica is not read, 0 disables lag checks
+	MaxLag time.Duration
+	// CheckInterval is the interval of latency and lag checks of replicas, 0 disables the checks
+	CheckInterval time.Duration
+	// FailureBackoff is how long a replica that failed a read is not read
+	FailureBackoff time.Duration
+}
+
+var DefaultReplicaOptions = ReplicaOptions{
+	Balancer:       RoundRobin,
+	MaxLag:         5 * time.Second,
+	CheckInterval:  5 * time.Second,
+	FailureBackoff: 10 * time.Second,
+}
+
+// WithReplicas sets how replicas of the shards are read, DefaultReplicaOptions are used without it
+func WithReplicas(options ReplicaOptions) TableOption {
+	return func(table *Table) {
+		table.replication = options
+	}
+}
+
+type readYourWritesKey struct{}
+
+// ReadYourWrites returns ctx whose reads use the primary, they see the writes made before them
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func readsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return primary
+}
+
+type replica struct {
+	db *sql.DB
+	// latency is the moving average of read and ping durations in nanoseconds
+	latency atomic.Int64
+
+	mx sync.Mutex
+	// unavailableUntil is set after a failure or excessive lag
+	unavailableUntil time.Time
+	lag              time.Duration
+	lastError        error
+}
+
+func (r *replica) available(now time.Time) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return !now.Before(r.unavailableUntil)
+}
+
+func (r *replica) observe(latency time.Duration) {
+	previous := r.latency.Load()
+	if previous == 0 {
+		r.latency.Store(int64(latency))
+		return
+	}
+	r.latency.Store(previous + (int64(latency)-previous)/5)
+}
+
+func (r *replica) fail(err error, backoff time.Duration) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.lastError = err
+	r.unavailableUntil = time.Now().Add(backoff)
+}
+
+// pickReplica returns the replica reads of ctx use, nil if they use the primary
+func (shard *Shard) pickReplica(ctx context.Context) *replica {
+	if len(shard.replicas) == 0 || readsPrimary(ctx) {
+		return nil
+	}
+	now := time.Now()
+	switch shard.table.replication.Balancer {
+	case LeastLatency:
+		var best *replica
+		for _, r := range shard.replicas {
+			if r.available(now) && (best == nil || r.latency.Load() < best.latency.Load()) {
+				best = r
+			}
+		}
+		return best
+	default:
+		start := shard.nextReplica.Add(1)
+		for i := 0; i < len(shard.replicas); i++ {
+			r := shard.replicas[(int(start)+i)%len(shard.replicas)]
+			if r.available(now) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// read runs f with a replica, it runs f with the primary if there is no available replica or it failed
+func (shard *Shard) read(ctx context.Context, f func(ex executor) error) error {
+	r := shard.pickReplica(ctx)
+	if r == nil {
+		return f(shard.driver)
+	}
+	start := time.Now()
+	err := f(r.db)
+	if err == nil || errorCode(err) != CodeConnection {
+		r.observe(time.Since(start))
+		return err
+	}
+	logger.Warn("replica of shard ", shard.name, " failed, reading from primary: ", err.Error())
+	r.fail(err, shard.table.replication.FailureBackoff)
+	return f(shard.driver)
+}
+
+// isReplica reports whether ex is a replica of the shard, the circuit breaker of the shard is of the primary
+func (shard *Shard) isReplica(ex executor) bool {
+	for _, r := range shard.replicas {
+		if executor(r.db) == ex {
+			return true
+		}
+	}
+	return false
+}
+
+// check measures latency and lag of the replica, a lagging replica is not read until the next check
+func (r *replica) check(ctx context.Context, dialect Dialect, options ReplicaOptions) {
+	ctx, cancel := context.WithTimeout(ctx, options.CheckInterval)
+	defer cancel()
+	start := time.Now()
+	err := r.db.PingContext(ctx)
+	if err == nil {
+		r.observe(time.Since(start))
+	}
+	var lag time.Duration
+	if err == nil && options.MaxLag > 0 {
+		lag, err = dialect.ReplicaLag(ctx, r.db)
+	}
+	if ctx.Err() != nil && err != nil {
+		return
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.lag = lag
+	switch {
+	case err != nil:
+		r.lastError = err
+		r.unavailableUntil = time.Now().Add(options.CheckInterval)
+	case options.MaxLag > 0 && lag > options.MaxLag:
+		r.unavailableUntil = time.Now().Add(options.CheckInterval)
+	default:
+		r.unavailableUntil = time.Time{}
+	}
+}
+
+func (table *Table) startReplicaCheck() {
+	if table.replication.CheckInterval <= 0 {
+		return
+	}
+	hasReplicas := false
+	for _, shard := range table.shards() {
+		hasReplicas = hasReplicas || len(shard.replicas) != 0
+	}
+	if !hasReplicas {
+		return
+	}
+	ctx := table.background()
+	go func() {
+		ticker := time.NewTicker(table.replication.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			var tasks []func()
+			for _, shard := range table.shards() {
+				for _, r := range shard.replicas {
+					r := r
+					tasks = append(tasks, func() {
+						r.check(ctx, table.dialect, table.replication)
+					})
+				}
+			}
+			fanOut(tasks...)
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// newReplicatedSQLiteTable creates table items of 2 shards in primary and a stale copy of it in the replica,
+// row 1 has status 1 in the replica and 2 in the primary
+func newReplicatedSQLiteTable(t *testing.T, options ...TableOption) (*Table, *sql.DB) {
+	t.Helper()
+	primary, replicaDB := openSQLite(t), openSQLite(t)
+	stale := newSQLiteTable(t, replicaDB, "items", 2, itemFields)
+	if err := stale.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	options = append([]TableOption{WithDialect(SQLite), WithReplicas(ReplicaOptions{FailureBackoff: time.Second})}, options...)
+	table, err := NewTable("items", 2, itemFields, ShardDrivers{Primary: primary, Replicas: []*sql.DB{replicaDB}}, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(table.StopHealthCheck)
+	if err = table.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(2)}}); err != nil {
+		t.Fatal(err)
+	}
+	return table, replicaDB
+}
+
+func TestReplicaReads(t *testing.T) {
+	table, _ := newReplicatedSQLiteTable(t)
+	var status int64
+	err, found := table.Get(int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"status", &status}})
+	if err != nil || !found || status != 1 {
+		t.Errorf("read from replica: %d %v %v, want the stale status 1", status, found, err)
+	}
+	err, found = table.GetContext(ReadYourWrites(context.Background()), int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"status", &status}})
+	if err != nil || !found || status != 2 {
+		t.Errorf("read your writes: %d %v %v, want 2", status, found, err)
+	}
+	if _, err = table.Exec("UPDATE {table} SET status = 3;", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	// the raw write went to the primary, the replica still has the old row
+	err, _ = table.Get(int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"status", &status}})
+	if err != nil || status != 1 {
+		t.Errorf("replica after a write to the primary: %d %v, want 1", status, err)
+	}
+}
+
+func TestReplicaCacheFillsFromPrimary(t *testing.T) {
+	table, _ := newReplicatedSQLiteTable(t, WithCache(CacheOptions{Size: 10, TTL: time.Minute}))
+	// the cache loads rows from the primary, a stale replica row is never cached
+	for i := 0; i < 2; i++ {
+		if status, found := cachedStatus(t, table, 1); !found || status != 2 {
+			t.Errorf("cached get %d: %d %v, want 2", i, status, found)
+		}
+	}
+}
+
+func TestReshardKeepsReplicas(t *testing.T) {
+	table, replicaDB := newReplicatedSQLiteTable(t)
+	before := table.shards()[0].replicas[0]
+	table.shards()[0].breaker.failures = 2
+	reshard, err := table.NewResharder(ReshardOptions{ShardsCount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, shard := range table.shards() {
+		if len(shard.replicas) != 1 || shard.replicas[0] != before || shard.replicas[0].db != replicaDB {
+			t.Fatalf("shard %d has replicas %v after cutover, want the replica of the old shards", shard.num, shard.replicas)
+		}
+		if shard.breaker.failures != 2 {
+			t.Errorf("shard %d breaker failures %d after cutover, want the 2 of the old shard of its primary", shard.num, shard.breaker.failures)
+		}
+	}
+	// the replica has no new shard tables, the primary is read
+	var status int64
+	err, found := table.GetContext(ReadYourWrites(context.Background()), int64(1), Keys{{"id", int64(1)}}, SelectColumns{{"status", &status}})
+	if err != nil || !found || status != 2 {
+		t.Errorf("row 1 after cutover: %d %v %v, want 2", status, found, err)
+	}
+}
@@ -0,0 +1,1313 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReshardOptions configure moving a Table to a new number of shards
+type ReshardOptions struct {
+	ShardsCount uint
+	// Router of the new shards, the table router is used if nil. It is required if the table uses
+	// BucketRouter, its bucket map is for the current shards.
+	Router ShardRouter
+	// Drivers of the new shards (*sql.DB, []*sql.DB, ShardDrivers or []ShardDrivers), if nil the driver
+	// of the current shards is used, it must be the same for all of them. A primary without replicas
+	// gets the replicas of the current shards using it.
+	Drivers Drivers
+	// BatchSize is the number of rows copied per statement, 1000 by default
+	BatchSize int
+	// ShardKeyColumns are the columns the shard key is built from, primary key by default
+	ShardKeyColumns []string
+	// ShardKey builds the shard key from the values of ShardKeyColumns.
+	// By default the values are concatenated as strings.
+	ShardKey func(values []interface{}) interface{}
+	// LeaseTimeout is how long an attached process writes without renewing its lease in the state table,
+	// 10 seconds by default. The state is polled 4 times per LeaseTimeout.
+	LeaseTimeout time.Duration
+}
+
+// ReshardReport compares the rows expected on a new shard with the rows copied to it
+type ReshardReport struct {
+	Shard            uint
+	ExpectedRows     uint64
+	Rows             uint64
+	ExpectedChecksum uint64
+	Checksum         uint64
+}
+
+func (r ReshardReport) Ok() bool {
+	return r.ExpectedRows == r.Rows && r.ExpectedChecksum == r.Checksum
+}
+
+const (
+	reshardPhaseCopy    = "copy"
+	reshardPhaseCutover = "cutover"
+	reshardPhaseDone    = "done"
+)
+
+var (
+	// ErrShardRetired is returned by statements of a Shard replaced by resharding cutover
+	ErrShardRetired = errors.New("eplidr: shard was replaced by resharding cutover")
+	// ErrReshardFenced is returned by writes of a process whose resharding lease expired, the state
+	// table could not be reached to renew it
+	ErrReshardFenced = errors.New("eplidr: reshard: lease expired, writes are fenced")
+	// ErrReshardCutover is returned by Table.Begin while resharding waits for the open transactions to end
+	ErrReshardCutover = errors.New("eplidr: reshard: table is blocked for cutover, transactions can not begin")
+)
+
+// Resharder moves rows of a Table to a new set of shard tables named {name}_new{i}.
+// While it is attached, Put/PutOrUpdate/Set/Add/Remove of the Table and of its transactions are also
+// applied to the new shards, writes of transactions after commit. Raw Exec and Shard methods are not mirrored.
+// Progress is stored in table {name}_reshard0, so a resharding interrupted by a crash
+// is resumed by creating a Resharder with the same options and calling Run again.
+// All processes writing to the table must Attach a Resharder until cutover. Attached processes
+// renew a lease in the state table, writes fail with ErrReshardFenced while it is expired. Cutover
+// waits until the other attached processes block their table or their leases expire, and they switch
+// to the new shards when it is done. Clocks of the processes are assumed to be synchronized.
+type Resharder struct {
+	table   *Table
+	options ReshardOptions
+	sources []*Shard
+	// shards are written through their primaries, they get replicas of drivers at cutover
+	shards  []*Shard
+	drivers []ShardDrivers
+	state   *SingleKeyTable
+	// sourceRouter and sourceCount route rows to the source shards
+	sourceRouter ShardRouter
+	sourceCount  uint
+
+	columns    []string
+	primaryKey []int
+	// shardKey are select expressions of ShardKeyColumns decoded like Get does
+	shardKey []string
+
+	// copyMx is held by writes of this process while they are applied and mirrored, and exclusively by
+	// batches of Copy, Verify and Resync, so a batch never interleaves with a mirrored write
+	copyMx sync.RWMutex
+
+	mirrorErrors atomic.Int64
+
+	// id of the process in the state table, lease is the unix nano time its lease expires
+	id    string
+	lease atomic.Int64
+	// cutting is set while this process cuts over, its poller does not fence the table
+	cutting atomic.Bool
+}
+
+func (table *Table) NewResharder(options ReshardOptions) (*Resharder, error) {
+	if options.ShardsCount == 0 {
+		return nil, errors.New("eplidr: reshard: ShardsCount must be positive")
+	}
+	table.mx.RLock()
+	sources, sourceRouter, sourceCount := table.Shards, table.router, table.shardsCount
+	table.mx.RUnlock()
+	if buckets, ok := sourceRouter.(*BucketRouter); ok {
+		// the bucket map of the table router is for the current shards, it keeps routing to them
+		if options.Router == nil {
+			return nil, errors.New("eplidr: reshard: table " + table.name + " uses BucketRouter, ReshardOptions.Router is required")
+		}
+		if router, ok := options.Router.(*BucketRouter); ok && router == buckets {
+			return nil, errors.New("eplidr: reshard: ReshardOptions.Router must be a new BucketRouter, the table router is used until cutover")
+		}
+	}
+	if options.Router == nil {
+		options.Router = sourceRouter
+	}
+	err := validateRouter(options.Router, options.ShardsCount)
+	if err != nil {
+		return nil, err
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 1000
+	}
+	primaryKeys := table.primaryKeys()
+	if len(primaryKeys) == 0 {
+		return nil, errors.New("eplidr: reshard: table " + table.name + " has no primary key")
+	}
+	if len(options.ShardKeyColumns) == 0 {
+		options.ShardKeyColumns = primaryKeys
+	}
+	if options.ShardKey == nil {
+		options.ShardKey = concatShardKey
+	}
+	if options.LeaseTimeout <= 0 {
+		options.LeaseTimeout = 10 * time.Second
+	}
+	drivers, err := reshardDrivers(options.Drivers, sources, options.ShardsCount)
+	if err != nil {
+		return nil, err
+	}
+	r := &Resharder{
+		table:        table,
+		options:      options,
+		sources:      sources,
+		sourceRouter: sourceRouter,
+		sourceCount:  sourceCount,
+		columns:      table.getColumnNames(),
+		id:           uuid.NewString(),
+		drivers:      drivers,
+	}
+	for _, key := range primaryKeys {
+		index := r.columnIndex(key)
+		if index == -1 {
+			return nil, errors.New("eplidr: reshard: unknown primary key column " + key)
+		}
+		r.primaryKey = append(r.primaryKey, index)
+	}
+	for _, name := range options.ShardKeyColumns {
+		field := table.getField(name)
+		if field == nil {
+			return nil, errors.New("eplidr: reshard: unknown shard key column " + name)
+		}
+		r.shardKey = append(r.shardKey, table.dialect.DecodeColumn(field.GetType(), table.dialect.QuoteIdentifier(name)))
+	}
+	for i := uint(0); i < options.ShardsCount; i++ {
+		r.shards = append(r.shards, &Shard{
+			table:  table,
+			driver: drivers[i].Primary,
+			num:    i,
+			name:   fmt.Sprintf("%s_new%d", table.name, i),
+		})
+	}
+	r.state, err = NewSingleKeyTable(table.name+"_reshard", "name", 1, TableFields{
+		DefaultTableField{Name: "name", Type: GetSizedType(BasicTypeVarChar, 64), PrimaryKey: true},
+		DefaultTableField{Name: "value", Type: GetSizedType(BasicTypeVarChar, 4096)},
+	}, sources[0].driver, WithDialect(table.dialect))
+	if err != nil {
+		return nil, err
+	}
+	phase, _, err := r.state.GetString("phase", "value")
+	if err != nil {
+		return nil, err
+	}
+	count, _, err := r.state.GetString("shards", "value")
+	if err != nil {
+		return nil, err
+	}
+	if (phase == reshardPhaseCopy || phase == reshardPhaseCutover) && count != strconv.FormatUint(uint64(options.ShardsCount), 10) {
+		return nil, fmt.Errorf("eplidr: reshard: resharding of %s to %s shards is in progress", table.name, count)
+	}
+	return r, nil
+}
+
+func reshardDrivers(drivers Drivers, sources []*Shard, count uint) ([]ShardDrivers, error) {
+	result := make([]ShardDrivers, count)
+	switch drivers := drivers.(type) {
+	case nil:
+		for _, source := range sources {
+			if source.driver != sources[0].driver {
+				return nil, errors.New("eplidr: reshard: shards use different drivers, ReshardOptions.Drivers is required")
+			}
+		}
+		for i := range result {
+			result[i].Primary = sources[0].driver
+		}
+	case *sql.DB:
+		for i := range result {
+			result[i].Primary = drivers
+		}
+	case []*sql.DB:
+		if uint(len(drivers)) != count {
+			return nil, errors.New("eplidr: reshard: len(Drivers) != ShardsCount")
+		}
+		for i, driver := range drivers {
+			result[i].Primary = driver
+		}
+	case ShardDrivers:
+		for i := range result {
+			result[i] = drivers
+		}
+	case []ShardDrivers:
+		if uint(len(drivers)) != count {
+			return nil, errors.New("eplidr: reshard: len(Drivers) != ShardsCount")
+		}
+		copy(result, drivers)
+	default:
+		return nil, fmt.Errorf("eplidr: reshard: unsupported drivers %T", drivers)
+	}
+	for i := range result {
+		if result[i].Primary == nil {
+			return nil, fmt.Errorf("eplidr: reshard: shard %d has no primary driver", i)
+		}
+		if len(result[i].Replicas) != 0 {
+			continue
+		}
+		if source := sourceWithDriver(sources, result[i].Primary); source != nil {
+			for _, r := range source.replicas {
+				result[i].Replicas = append(result[i].Replicas, r.db)
+			}
+		}
+	}
+	return result, nil
+}
+
+// sourceWithDriver returns the first of sources using primary driver, nil if there is none
+func sourceWithDriver(sources []*Shard, driver *sql.DB) *Shard {
+	for _, source := range sources {
+		if source.driver == driver {
+			return source
+		}
+	}
+	return nil
+}
+
+func concatShardKey(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return rawKeyValue(values[0])
+	}
+	key := ""
+	for _, value := range values {
+		key += fmt.Sprintf("%v", rawKeyValue(value))
+	}
+	return key
+}
+
+// rawKeyValue converts text returned by drivers as []byte to string
+func rawKeyValue(v interface{}) interface{} {
+	if bytes, ok := v.([]byte); ok {
+		return string(bytes)
+	}
+	return v
+}
+
+func (r *Resharder) columnIndex(name string) int {
+	for i, column := range r.columns {
+		if strings.EqualFold(column, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Run creates the new shards, copies the rows, verifies them and cuts over.
+// It resumes the copy from the stored progress.
+func (r *Resharder) Run() error {
+	err := r.Start()
+	if err != nil {
+		return err
+	}
+	err = r.Copy()
+	if err != nil {
+		return err
+	}
+	return r.Cutover()
+}
+
+// Start creates the new shard tables and attaches the resharder to the table.
+// An interrupted cutover is not started again, Cutover finishes it.
+func (r *Resharder) Start() error {
+	phase, _, err := r.state.GetString("phase", "value")
+	if err != nil || phase == reshardPhaseCutover {
+		return err
+	}
+	for _, shard := range r.shards {
+		err := shard.init()
+		if err != nil {
+			return err
+		}
+	}
+	err = r.setState("shards", strconv.FormatUint(uint64(r.options.ShardsCount), 10))
+	if err != nil {
+		return err
+	}
+	err = r.setState("phase", reshardPhaseCopy)
+	if err != nil {
+		return err
+	}
+	return r.Attach()
+}
+
+// Attach enables writes mirroring to the new shards, every process writing to the table must attach.
+// The state table is polled until cutover, the polling stops with Table.StopHealthCheck.
+func (r *Resharder) Attach() error {
+	phase, _, err := r.state.GetString("phase", "value")
+	if err != nil {
+		return err
+	}
+	if phase != reshardPhaseCopy {
+		return errors.New("eplidr: reshard: resharding of " + r.table.name + " is not started")
+	}
+	err = r.renew()
+	if err != nil {
+		return err
+	}
+	// transactions begun before are not mirrored, they are waited for
+	unlock := r.table.lockWrites()
+	r.table.reshard = r
+	unlock()
+	go r.poll(r.table.background())
+	return nil
+}
+
+func (r *Resharder) pollInterval() time.Duration {
+	return r.options.LeaseTimeout / 4
+}
+
+// renew extends the lease of this process
+func (r *Resharder) renew() error {
+	expiry := time.Now().Add(r.options.LeaseTimeout).UnixNano()
+	err := r.setState("attached"+r.id, strconv.FormatInt(expiry, 10))
+	if err != nil {
+		return err
+	}
+	r.lease.Store(expiry)
+	return nil
+}
+
+// leased reports whether writes of this process may be applied
+func (r *Resharder) leased() bool {
+	return time.Now().UnixNano() < r.lease.Load()
+}
+
+func (r *Resharder) attached() bool {
+	r.table.mx.RLock()
+	defer r.table.mx.RUnlock()
+	return r.table.reshard == r
+}
+
+// poll renews the lease and follows the phase: the table is blocked during the cutover of another
+// process and switched to the new shards after it
+func (r *Resharder) poll(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if r.cutting.Load() {
+			continue
+		}
+		if !r.attached() {
+			return
+		}
+		err := r.renew()
+		if err != nil {
+			logger.Error("reshard ", r.table.name, ": lease is not renewed: ", err.Error())
+			continue
+		}
+		phase, _, err := r.state.GetString("phase", "value")
+		if err != nil {
+			logger.Error("reshard ", r.table.name, ": ", err.Error())
+			continue
+		}
+		switch phase {
+		case reshardPhaseCutover:
+			if r.fence(ctx, ticker) {
+				return
+			}
+		case reshardPhaseDone:
+			unlock := r.table.lockWrites()
+			if r.table.reshard == r {
+				r.switchTable()
+			}
+			unlock()
+			return
+		}
+	}
+}
+
+// fence blocks the table while another process cuts over and reports whether the resharding ended
+func (r *Resharder) fence(ctx context.Context, ticker *time.Ticker) bool {
+	defer r.table.lockWrites()()
+	if r.table.reshard != r {
+		return true
+	}
+	err := r.setState("fenced"+r.id, "1")
+	if err != nil {
+		logger.Error("reshard ", r.table.name, ": ", err.Error())
+		return false
+	}
+	logger.Info("reshard ", r.table.name, ": table is blocked for the cutover of another process")
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-ticker.C:
+		}
+		phase, _, err := r.state.GetString("phase", "value")
+		if err != nil {
+			logger.Error("reshard ", r.table.name, ": ", err.Error())
+			continue
+		}
+		switch phase {
+		case reshardPhaseDone:
+			r.switchTable()
+			return true
+		case reshardPhaseCopy:
+			// the cutover failed and was rolled back
+			return false
+		}
+	}
+}
+
+// Copy copies rows of every source shard not copied yet
+func (r *Resharder) Copy() error {
+	for _, source := range r.sources {
+		done, _, err := r.state.GetString(fmt.Sprintf("done%d", source.num), "value")
+		if err != nil {
+			return err
+		}
+		if done == "1" {
+			continue
+		}
+		encoded, _, err := r.state.GetString(fmt.Sprintf("cursor%d", source.num), "value")
+		if err != nil {
+			return err
+		}
+		cursor, err := decodeCursorValues(encoded)
+		if err != nil {
+			return err
+		}
+		for {
+			rows, err := r.copyBatch(source, cursor)
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				break
+			}
+			cursor = r.cursorOf(rows[len(rows)-1])
+			encoded, err = encodeCursorValues(cursor)
+			if err != nil {
+				return err
+			}
+			err = r.setState(fmt.Sprintf("cursor%d", source.num), encoded)
+			if err != nil {
+				return err
+			}
+			logger.Debug("reshard ", r.table.name, ": shard ", source.num, " copied ", len(rows), " rows")
+		}
+		err = r.setState(fmt.Sprintf("done%d", source.num), "1")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBatch returns raw rows after cursor ordered by primary key and their shard keys
+func (r *Resharder) readBatch(shard *Shard, cursor []interface{}) ([][]interface{}, []interface{}, error) {
+	dialect := r.table.dialect
+	return r.selectRows(shard, func(stmt *statement) {
+		if len(cursor) != 0 {
+			stmt.write("WHERE (", columnNames(dialect, r.keyColumns()), ") > (")
+			for i, value := range cursor {
+				if i != 0 {
+					stmt.write(", ")
+				}
+				stmt.arg(value)
+			}
+			stmt.write(")")
+		}
+		stmt.write(" ORDER BY ", columnNames(dialect, r.keyColumns()), " LIMIT ").arg(int64(r.options.BatchSize))
+	})
+}
+
+// selectRows returns raw rows of shard filtered by the clauses written by where and their shard keys
+func (r *Resharder) selectRows(shard *Shard, where func(stmt *statement)) ([][]interface{}, []interface{}, error) {
+	dialect := r.table.dialect
+	stmt := newStatement(dialect, "SELECT ", columnNames(dialect, r.columns))
+	for _, expression := range r.shardKey {
+		stmt.write(", ", expression)
+	}
+	stmt.write(" FROM {table} ")
+	where(stmt)
+	stmt.write(";")
+	rows, err := shard.Query(stmt.String(), stmt.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var result [][]interface{}
+	var keys []interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(r.columns)+len(r.shardKey))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, values[:len(r.columns)])
+		keys = append(keys, r.options.ShardKey(values[len(r.columns):]))
+	}
+	return result, keys, rows.Err()
+}
+
+// selectKeys returns raw rows of shard with primary keys of rows and their shard keys
+func (r *Resharder) selectKeys(shard *Shard, rows [][]interface{}) ([][]interface{}, []interface{}, error) {
+	var result [][]interface{}
+	var keys []interface{}
+	for _, chunk := range r.chunks(rows) {
+		selected, selectedKeys, err := r.selectRows(shard, func(stmt *statement) {
+			stmt.write("WHERE ")
+			r.writeKeys(stmt, chunk)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, selected...)
+		keys = append(keys, selectedKeys...)
+	}
+	return result, keys, nil
+}
+
+// upsertRows writes raw rows to shard replacing the rows with the same primary key
+func (r *Resharder) upsertRows(shard *Shard, rows [][]interface{}) error {
+	for _, chunk := range r.chunks(rows) {
+		_, err := shard.execStatement(context.Background(), r.insertStatement(chunk, true), true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRows deletes rows with primary keys of raw rows from shard
+func (r *Resharder) deleteRows(shard *Shard, rows [][]interface{}) error {
+	for _, chunk := range r.chunks(rows) {
+		stmt := newStatement(r.table.dialect, "DELETE FROM {table} WHERE ")
+		r.writeKeys(stmt, chunk)
+		_, err := shard.execStatement(context.Background(), stmt.write(";"), true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunks splits rows into BatchSize parts
+func (r *Resharder) chunks(rows [][]interface{}) [][][]interface{} {
+	var chunks [][][]interface{}
+	for start := 0; start < len(rows); start += r.options.BatchSize {
+		end := start + r.options.BatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunks = append(chunks, rows[start:end])
+	}
+	return chunks
+}
+
+// writeKeys appends a condition matching the primary keys of raw rows
+func (r *Resharder) writeKeys(stmt *statement, rows [][]interface{}) {
+	stmt.write("(", columnNames(r.table.dialect, r.keyColumns()), ") IN (")
+	for i, row := range rows {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.write("(")
+		for j, index := range r.primaryKey {
+			if j != 0 {
+				stmt.write(", ")
+			}
+			stmt.arg(row[index])
+		}
+		stmt.write(")")
+	}
+	stmt.write(")")
+}
+
+func (r *Resharder) keyColumns() []string {
+	var columns []string
+	for _, index := range r.primaryKey {
+		columns = append(columns, r.columns[index])
+	}
+	return columns
+}
+
+// rowKey identifies a raw row by its primary key
+func (r *Resharder) rowKey(row []interface{}) string {
+	var key strings.Builder
+	for _, index := range r.primaryKey {
+		fmt.Fprintf(&key, "%v\x00", rawKeyValue(row[index]))
+	}
+	return key.String()
+}
+
+func (r *Resharder) cursorOf(row []interface{}) []interface{} {
+	var cursor []interface{}
+	for _, index := range r.primaryKey {
+		cursor = append(cursor, row[index])
+	}
+	return cursor
+}
+
+// route returns the new shard of shardKey
+func (r *Resharder) route(shardKey interface{}) *Shard {
+	return r.shards[r.options.Router.Route(shardKey, r.options.ShardsCount)]
+}
+
+// sourceOf returns the source shard of shardKey
+func (r *Resharder) sourceOf(shardKey interface{}) *Shard {
+	return r.sources[r.sourceRouter.Route(shardKey, r.sourceCount)]
+}
+
+// copyBatch inserts raw rows of source after cursor to their new shards and returns them, rows already
+// written by mirroring are kept
+func (r *Resharder) copyBatch(source *Shard, cursor []interface{}) ([][]interface{}, error) {
+	r.copyMx.Lock()
+	defer r.copyMx.Unlock()
+	rows, keys, err := r.readBatch(source, cursor)
+	if err != nil {
+		return nil, err
+	}
+	byShard := make(map[*Shard][][]interface{})
+	for i, row := range rows {
+		shard := r.route(keys[i])
+		byShard[shard] = append(byShard[shard], row)
+	}
+	for shard, rows := range byShard {
+		_, err := shard.execStatement(context.Background(), r.insertStatement(rows, false), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func (r *Resharder) insertStatement(rows [][]interface{}, overwrite bool) *statement {
+	dialect := r.table.dialect
+	stmt := newStatement(dialect, "INSERT INTO {table} (", columnNames(dialect, r.columns), ") VALUES ")
+	for i, row := range rows {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.write("(")
+		for j, value := range row {
+			if j != 0 {
+				stmt.write(", ")
+			}
+			stmt.arg(value)
+		}
+		stmt.write(")")
+	}
+	var primaryKey, updates []string
+	for i, column := range r.columns {
+		isKey := false
+		for _, index := range r.primaryKey {
+			if index == i {
+				isKey = true
+			}
+		}
+		if isKey {
+			primaryKey = append(primaryKey, column)
+		} else if overwrite {
+			updates = append(updates, column)
+		}
+	}
+	return stmt.write(dialect.Upsert(primaryKey, updates), ";")
+}
+
+// Mirroring is not bound to the context of the original write, it is already applied to the source shard
+
+// mirrorPut copies the row written by Put or PutOrUpdate from source, values of an update may be partial
+// so the whole row is read by its primary key
+func (r *Resharder) mirrorPut(source *Shard, values Columns) error {
+	return r.mirrorPuts(source, []Columns{values})
+}
+
+// mirrorPuts copies the rows written with values of rows from source, BatchSize rows are read per statement
+func (r *Resharder) mirrorPuts(source *Shard, rows []Columns) error {
+	for start := 0; start < len(rows); start += r.options.BatchSize {
+		end := start + r.options.BatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		var where []Condition
+		for _, values := range rows[start:end] {
+			keys, err := r.putKeys(values)
+			if err != nil {
+				return err
+			}
+			where = append(where, keys)
+		}
+		selected, shardKeys, err := r.selectRows(source, func(stmt *statement) {
+			writeWhere(r.table, stmt, Or(where...))
+		})
+		if err != nil {
+			return err
+		}
+		upserts := make(map[*Shard][][]interface{})
+		for i, row := range selected {
+			shard := r.route(shardKeys[i])
+			upserts[shard] = append(upserts[shard], row)
+		}
+		for shard, rows := range upserts {
+			err = r.upsertRows(shard, rows)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putKeys returns the primary key of the row written with values
+func (r *Resharder) putKeys(values Columns) (Keys, error) {
+	var keys Keys
+	for _, column := range r.keyColumns() {
+		found := false
+		for _, value := range values {
+			if strings.EqualFold(value.Name, column) {
+				keys = append(keys, Key{Name: column, Value: value.Value})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("eplidr: reshard: write without primary key column " + column + " can not be mirrored")
+		}
+	}
+	return keys, nil
+}
+
+// prepareRows selects the rows of source matching where before Set, Add or Remove changes them and returns
+// the mirroring of the write. Rows are mirrored by their primary keys, so rows that stop matching where
+// are mirrored too.
+func (r *Resharder) prepareRows(source *Shard, where Condition) (func() error, error) {
+	before, beforeKeys, err := r.selectRows(source, func(stmt *statement) {
+		writeWhere(r.table, stmt, where)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return r.mirrorRows(source, where, before, beforeKeys)
+	}, nil
+}
+
+// mirrorRows copies the current state of rows matching where and of rows selected before the write
+// from source, rows that no longer exist or moved to another new shard are deleted
+func (r *Resharder) mirrorRows(source *Shard, where Condition, before [][]interface{}, beforeKeys []interface{}) error {
+	rows, keys, err := r.selectRows(source, func(stmt *statement) {
+		writeWhere(r.table, stmt, where)
+	})
+	if err != nil {
+		return err
+	}
+	current := make(map[string]*Shard, len(rows)+len(before))
+	for i, row := range rows {
+		current[r.rowKey(row)] = r.route(keys[i])
+	}
+	var missing [][]interface{}
+	for _, row := range before {
+		if _, ok := current[r.rowKey(row)]; !ok {
+			missing = append(missing, row)
+		}
+	}
+	if len(missing) != 0 {
+		selected, selectedKeys, err := r.selectKeys(source, missing)
+		if err != nil {
+			return err
+		}
+		for i, row := range selected {
+			current[r.rowKey(row)] = r.route(selectedKeys[i])
+		}
+		rows = append(rows, selected...)
+	}
+	upserts := make(map[*Shard][][]interface{})
+	for _, row := range rows {
+		shard := current[r.rowKey(row)]
+		upserts[shard] = append(upserts[shard], row)
+	}
+	deletes := make(map[*Shard][][]interface{})
+	for i, row := range before {
+		shard := r.route(beforeKeys[i])
+		if current[r.rowKey(row)] != shard {
+			deletes[shard] = append(deletes[shard], row)
+		}
+	}
+	for shard, rows := range deletes {
+		err = r.deleteRows(shard, rows)
+		if err != nil {
+			return err
+		}
+	}
+	for shard, rows := range upserts {
+		err = r.upsertRows(shard, rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Resharder) mirrorFailed(err error) {
+	r.mirrorErrors.Add(1)
+	logger.Error("reshard ", r.table.name, ": mirroring write failed: ", err.Error())
+}
+
+// Verify compares row counts and checksums of every new shard with the rows of the source shards routed to it.
+// Rows are compared batch by batch with writes of this process blocked for the batch, so the table is
+// not locked and writes mirrored during the verification do not cause mismatches.
+func (r *Resharder) Verify() ([]ReshardReport, error) {
+	return r.reconcile(nil, false)
+}
+
+// Resync repairs new shards after a failed verification or mirrored write: rows missing or different
+// from the source shards are copied again and rows that are not on the source shards are deleted.
+// All new shards are repaired if no shards are given.
+func (r *Resharder) Resync(shards ...uint) error {
+	if len(shards) == 0 {
+		_, err := r.reconcile(nil, true)
+		return err
+	}
+	for _, num := range shards {
+		if num >= uint(len(r.shards)) {
+			return fmt.Errorf("eplidr: reshard: new shard %d does not exist", num)
+		}
+		_, err := r.reconcile(r.shards[num], true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcile compares the new shards, or only target if it is set, with the source shards. With repair
+// the differences are fixed, the reports describe the state before the repair.
+func (r *Resharder) reconcile(target *Shard, repair bool) ([]ReshardReport, error) {
+	reports := make([]ReshardReport, len(r.shards))
+	for i := range reports {
+		reports[i].Shard = uint(i)
+	}
+	// rows of the source shards are looked up on the new shards
+	for _, source := range r.sources {
+		err := r.reconcileBatches(source, func(rows [][]interface{}, keys []interface{}) error {
+			byShard := make(map[*Shard][][]interface{})
+			for i, row := range rows {
+				shard := r.route(keys[i])
+				if target == nil || shard == target {
+					byShard[shard] = append(byShard[shard], row)
+				}
+			}
+			for shard, rows := range byShard {
+				copies, _, err := r.selectKeys(shard, rows)
+				if err != nil {
+					return err
+				}
+				checksums := make(map[string]uint64, len(copies))
+				for _, row := range copies {
+					checksums[r.rowKey(row)] = rowChecksum(row)
+				}
+				report := &reports[shard.num]
+				var changed [][]interface{}
+				for _, row := range rows {
+					expected := rowChecksum(row)
+					report.ExpectedRows++
+					report.ExpectedChecksum += expected
+					checksum, ok := checksums[r.rowKey(row)]
+					if ok {
+						report.Rows++
+						report.Checksum += checksum
+					}
+					if !ok || checksum != expected {
+						changed = append(changed, row)
+					}
+				}
+				if repair && len(changed) != 0 {
+					err = r.upsertRows(shard, changed)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// rows of the new shards that are not on the source shards or belong to another new shard
+	for _, shard := range r.shards {
+		if target != nil && shard != target {
+			continue
+		}
+		shard := shard
+		report := &reports[shard.num]
+		err := r.reconcileBatches(shard, func(rows [][]interface{}, keys []interface{}) error {
+			bySource := make(map[*Shard][][]interface{})
+			var extra [][]interface{}
+			for i, row := range rows {
+				if r.route(keys[i]) != shard {
+					extra = append(extra, row)
+					continue
+				}
+				source := r.sourceOf(keys[i])
+				bySource[source] = append(bySource[source], row)
+			}
+			for source, rows := range bySource {
+				originals, _, err := r.selectKeys(source, rows)
+				if err != nil {
+					return err
+				}
+				exists := make(map[string]bool, len(originals))
+				for _, row := range originals {
+					exists[r.rowKey(row)] = true
+				}
+				for _, row := range rows {
+					if !exists[r.rowKey(row)] {
+						extra = append(extra, row)
+					}
+				}
+			}
+			for _, row := range extra {
+				report.Rows++
+				report.Checksum += rowChecksum(row)
+			}
+			if repair && len(extra) != 0 {
+				return r.deleteRows(shard, extra)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// reconcileBatches calls f for batches of rows of shard in primary key order, mirrored writes of this
+// process are blocked while f runs
+func (r *Resharder) reconcileBatches(shard *Shard, f func(rows [][]interface{}, keys []interface{}) error) error {
+	var cursor []interface{}
+	for {
+		done, err := func() (bool, error) {
+			r.copyMx.Lock()
+			defer r.copyMx.Unlock()
+			rows, keys, err := r.readBatch(shard, cursor)
+			if err != nil || len(rows) == 0 {
+				return true, err
+			}
+			cursor = r.cursorOf(rows[len(rows)-1])
+			return false, f(rows, keys)
+		}()
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// rowChecksum hashes a row, checksums of shards are sums of their rows so the order of rows does not matter
+func rowChecksum(row []interface{}) uint64 {
+	hash := fnv.New64a()
+	for _, value := range row {
+		fmt.Fprintf(hash, "%v|", rawKeyValue(value))
+	}
+	return hash.Sum64()
+}
+
+// Cutover verifies the new shards, renames the old shard tables to {name}_old{unix}_{i}, the new ones
+// to {name}{i} and switches the table to them. The table is locked only for the renames, after the writes
+// in progress are mirrored. The tables of a driver are renamed atomically, the cutover phase is stored
+// before the renames, so Cutover of a Resharder created after a crash finishes them. If a write fails to
+// mirror during the verification, Cutover fails, call Resync and Cutover again.
+func (r *Resharder) Cutover() error {
+	phase, _, err := r.state.GetString("phase", "value")
+	if err != nil {
+		return err
+	}
+	if phase == reshardPhaseCutover {
+		return r.finishCutover()
+	}
+	mirrorErrors := r.mirrorErrors.Load()
+	reports, err := r.Verify()
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		if !report.Ok() {
+			return fmt.Errorf("eplidr: reshard: shard %d verification failed: %d/%d rows, checksum %d/%d, call Resync(%d)",
+				report.Shard, report.Rows, report.ExpectedRows, report.Checksum, report.ExpectedChecksum, report.Shard)
+		}
+	}
+	r.cutting.Store(true)
+	defer r.cutting.Store(false)
+	// writes and transactions hold the read locks until they are mirrored, so the new shards are caught up
+	// once they are taken
+	defer r.table.lockWrites()()
+	if failed := r.mirrorErrors.Load() - mirrorErrors; failed != 0 {
+		return fmt.Errorf("eplidr: reshard: %d writes failed to mirror during verification, call Resync", failed)
+	}
+	suffix := strconv.FormatInt(time.Now().Unix(), 10)
+	err = r.setState("suffix", suffix)
+	if err != nil {
+		return err
+	}
+	err = r.setState("phase", reshardPhaseCutover)
+	if err != nil {
+		return err
+	}
+	err = r.waitFenced()
+	if err != nil {
+		return r.abortCutover(err)
+	}
+	drivers, renames := r.renames(suffix)
+	for i, db := range drivers {
+		err = r.renameTables(db, renames[db])
+		if err == nil {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			rollbackErr := r.renameTables(drivers[j], reverseRenames(renames[drivers[j]]))
+			if rollbackErr != nil {
+				logger.Error("reshard ", r.table.name, ": rollback of rename failed: ", rollbackErr.Error())
+				return fmt.Errorf("eplidr: reshard: cutover is incomplete, call Cutover to finish it: %w", err)
+			}
+		}
+		return r.abortCutover(err)
+	}
+	r.finish()
+	return nil
+}
+
+// finishCutover renames the tables of the drivers an interrupted cutover did not rename
+func (r *Resharder) finishCutover() error {
+	defer r.table.lockWrites()()
+	suffix, _, err := r.state.GetString("suffix", "value")
+	if err != nil {
+		return err
+	}
+	drivers, renames := r.renames(suffix)
+	for _, db := range drivers {
+		pending := true
+		for _, rename := range renames[db] {
+			exists, err := tableExists(r.table.dialect, db, rename.From)
+			if err != nil {
+				return err
+			}
+			pending = pending && exists
+		}
+		if !pending {
+			continue
+		}
+		err = r.renameTables(db, renames[db])
+		if err != nil {
+			return err
+		}
+	}
+	r.finish()
+	return nil
+}
+
+// finish switches the table to the new shards and stores the end of the resharding, writes are locked
+func (r *Resharder) finish() {
+	r.switchTable()
+	err := r.setState("phase", reshardPhaseDone)
+	if err != nil {
+		logger.Error("reshard ", r.table.name, ": cutover is done but state was not saved: ", err.Error())
+	}
+	r.clearProgress()
+}
+
+// abortCutover returns to the copy phase after a cutover failed before the tables were renamed
+func (r *Resharder) abortCutover(err error) error {
+	stateErr := r.setState("phase", reshardPhaseCopy)
+	if stateErr != nil {
+		return fmt.Errorf("eplidr: reshard: cutover failed: %w, phase is not restored: %v", err, stateErr)
+	}
+	r.clearFences()
+	return err
+}
+
+// waitFenced waits until every other attached process blocked its table or its lease expired.
+// A lease is considered expired a poll interval after its expiry, a write started before it ends.
+func (r *Resharder) waitFenced() error {
+	for {
+		result, err := r.state.Table.SelectAll(Like("name", "attached%"))
+		if err != nil {
+			return err
+		}
+		waiting := 0
+		now := time.Now()
+		for result.Next() {
+			id := strings.TrimPrefix(result.GetString("name"), "attached")
+			expiry, err := strconv.ParseInt(result.GetString("value"), 10, 64)
+			if id == r.id || err != nil || now.After(time.Unix(0, expiry).Add(r.pollInterval())) {
+				continue
+			}
+			fenced, _, err := r.state.GetString("fenced"+id, "value")
+			if err != nil {
+				return err
+			}
+			if fenced != "1" {
+				waiting++
+			}
+		}
+		if waiting == 0 {
+			return nil
+		}
+		logger.Debug("reshard ", r.table.name, ": waiting for ", waiting, " attached processes")
+		time.Sleep(r.pollInterval())
+	}
+}
+
+// renames returns the renames of the cutover grouped by the driver they are executed on
+func (r *Resharder) renames(suffix string) ([]*sql.DB, map[*sql.DB][]TableRename) {
+	var drivers []*sql.DB
+	renames := make(map[*sql.DB][]TableRename)
+	add := func(db *sql.DB, rename TableRename) {
+		if _, ok := renames[db]; !ok {
+			drivers = append(drivers, db)
+		}
+		renames[db] = append(renames[db], rename)
+	}
+	// old tables are renamed first, the new ones take their names
+	for _, source := range r.sources {
+		add(source.driver, TableRename{source.name, fmt.Sprintf("%s_old%s_%d", r.table.name, suffix, source.num)})
+	}
+	for _, shard := range r.shards {
+		add(shard.driver, TableRename{shard.name, r.table.GetName(shard.num)})
+	}
+	return drivers, renames
+}
+
+func reverseRenames(renames []TableRename) []TableRename {
+	reversed := make([]TableRename, len(renames))
+	for i, rename := range renames {
+		reversed[len(renames)-1-i] = TableRename{From: rename.To, To: rename.From}
+	}
+	return reversed
+}
+
+// renameTables renames tables of db and the indexes whose names depend on table name in one transaction
+func (r *Resharder) renameTables(db *sql.DB, renames []TableRename) error {
+	dialect := r.table.dialect
+	statements := dialect.RenameTables(renames)
+	for _, rename := range renames {
+		for _, field := range r.table.fields {
+			field, ok := field.(DefaultTableField)
+			if !ok || !field.Index || dialect.IndexName(rename.From, field.Name) == dialect.IndexName(rename.To, field.Name) {
+				continue
+			}
+			statements = append(statements, dialect.DropIndex(rename.To, dialect.IndexName(rename.From, field.Name)), field.QueryAfter(dialect, rename.To))
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(strings.TrimSuffix(statement, ";") + ";")
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				logger.Error("reshard ", r.table.name, ": ", rollbackErr.Error())
+			}
+			return fmt.Errorf("eplidr: reshard: %s: %w", statement, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func tableExists(dialect Dialect, db *sql.DB, name string) (bool, error) {
+	query, args := dialect.TableExists(name)
+	rows, err := db.Query(dialect.Rebind(query), args...)
+	if err != nil {
+		return false, err
+	}
+	found := rows.Next()
+	return found, rows.Close()
+}
+
+// switchTable replaces the shards of the table with the renamed new shards, writes are locked.
+// Shard values are not renamed, statements of the replaced ones fail with ErrShardRetired.
+func (r *Resharder) switchTable() {
+	hadReplicas := false
+	for _, source := range r.sources {
+		hadReplicas = hadReplicas || len(source.replicas) != 0
+	}
+	hasReplicas := false
+	shards := make([]*Shard, len(r.shards))
+	for i, shard := range r.shards {
+		shards[i] = &Shard{
+			table:  r.table,
+			driver: shard.driver,
+			num:    shard.num,
+			name:   r.table.GetName(shard.num),
+		}
+		// a replica or a primary used by a current shard keeps its state
+		source := sourceWithDriver(r.sources, shard.driver)
+		if source != nil {
+			shards[i].breaker.copyFrom(&source.breaker)
+		}
+		for _, db := range r.drivers[i].Replicas {
+			shards[i].replicas = append(shards[i].replicas, r.replicaOf(db))
+		}
+		hasReplicas = hasReplicas || len(shards[i].replicas) != 0
+		shard.retired.Store(true)
+	}
+	for _, source := range r.sources {
+		source.retired.Store(true)
+	}
+	r.table.Shards = shards
+	r.table.shardsCount = r.options.ShardsCount
+	r.table.router = r.options.Router
+	attachRouter(r.table.router)
+	r.table.reshard = nil
+	if hasReplicas && !hadReplicas {
+		// it reads the shards once they are unlocked
+		go r.table.startReplicaCheck()
+	}
+	logger.Info("reshard ", r.table.name, ": switched to ", len(shards), " shards")
+}
+
+// replicaOf returns the replica of a current shard reading db, or a new one
+func (r *Resharder) replicaOf(db *sql.DB) *replica {
+	for _, source := range r.sources {
+		for _, existing := range source.replicas {
+			if existing.db == db {
+				return existing
+			}
+		}
+	}
+	return &replica{db: db}
+}
+
+// MirrorErrors returns the number of writes that were not mirrored to the new shards
+func (r *Resharder) MirrorErrors() int64 {
+	return r.mirrorErrors.Load()
+}
+
+func (r *Resharder) setState(name string, value string) error {
+	return r.state.Table.PutOrUpdate(name, Columns{{"name", name}, {"value", value}})
+}
+
+func (r *Resharder) clearProgress() {
+	for _, source := range r.sources {
+		for _, name := range []string{"cursor", "done"} {
+			err := r.state.Remove(fmt.Sprintf("%s%d", name, source.num))
+			if err != nil {
+				logger.Error("reshard ", r.table.name, ": ", err.Error())
+			}
+		}
+	}
+	for _, name := range []string{"attached%", "fenced%", "suffix"} {
+		err := r.state.Table.Remove(name, Like("name", name))
+		if err != nil {
+			logger.Error("reshard ", r.table.name, ": ", err.Error())
+		}
+	}
+}
+
+func (r *Resharder) clearFences() {
+	err := r.state.Table.Remove("fenced", Like("name", "fenced%"))
+	if err != nil {
+		logger.Error("reshard ", r.table.name, ": ", err.Error())
+	}
+}
@@ -0,0 +1,294 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReshard(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	putItems(t, table, 50)
+	err := table.Set(int64(4), Keys{{"id", int64(4)}}, Columns{{"name", "renamed"}, {"data", []byte{4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reshard, err := table.NewResharder(ReshardOptions{ShardsCount: 3, Router: ModuloRouter{Hash: StandardGetShardFunc}, BatchSize: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reshard.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a partial update of a row that is not copied yet is mirrored with the columns it does not write
+	err = table.PutOrUpdate(int64(4), Columns{{"id", int64(4)}, {"status", int64(9)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reshard.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// writes after the copy are mirrored to the new shards
+	for i := 0; i < 50; i += 5 {
+		err = table.Set(int64(i), Keys{{"id", int64(i)}}, Columns{{"status", int64(7)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = table.Remove(int64(3), Keys{{"id", int64(3)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = table.PutOrUpdateMany([]Row{{int64(6), Columns{{"id", int64(6)}, {"status", int64(8)}}}, {int64(60), Columns{{"id", int64(60)}, {"status", int64(1)}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := reshard.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		if !report.Ok() {
+			t.Fatalf("shard %d is not verified: %+v", report.Shard, report)
+		}
+	}
+
+	// a new shard missing rows and having a stray one fails the cutover until it is resynced
+	_, err = reshard.shards[1].Exec("DELETE FROM {table};")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reshard.shards[0].Exec(`INSERT INTO {table} ("id", "status") VALUES (1000, 5);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Cutover(); err == nil {
+		t.Fatal("cutover of mismatching shards succeeded")
+	}
+	err = reshard.Resync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reshard.Cutover()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.shards()) != 3 {
+		t.Fatalf("%d shards after cutover, want 3", len(table.shards()))
+	}
+	if status, found := cachedStatus(t, table, 10); !found || status != 7 {
+		t.Errorf("row 10: %d %v, want 7", status, found)
+	}
+	if _, found := cachedStatus(t, table, 3); found {
+		t.Error("removed row 3 is found")
+	}
+	if _, found := cachedStatus(t, table, 1000); found {
+		t.Error("stray row is found")
+	}
+	result, err := table.SelectAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.cache) != 50 {
+		t.Errorf("%d rows after cutover, want 50", len(result.cache))
+	}
+}
+
+func TestReshardCutoverProcesses(t *testing.T) {
+	db := openSQLite(t)
+	table := newSQLiteTable(t, db, "items", 2, itemFields)
+	putItems(t, table, 20)
+	options := ReshardOptions{ShardsCount: 3, Router: ModuloRouter{Hash: StandardGetShardFunc}, LeaseTimeout: 200 * time.Millisecond}
+	reshard, err := table.NewResharder(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Copy(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process writing to the table
+	other := newSQLiteTable(t, db, "items", 2, itemFields)
+	otherReshard, err := other.NewResharder(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = otherReshard.Attach(); err != nil {
+		t.Fatal(err)
+	}
+	if err = other.Set(int64(5), Keys{{"id", int64(5)}}, Columns{{"status", int64(9)}}); err != nil {
+		t.Fatal(err)
+	}
+	stale := other.shards()[0]
+
+	// a process that stopped polling is fenced when its lease expires
+	stopped := newSQLiteTable(t, db, "items", 2, itemFields)
+	stoppedReshard, err := stopped.NewResharder(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stoppedReshard.Attach(); err != nil {
+		t.Fatal(err)
+	}
+	stopped.StopHealthCheck()
+	stoppedReshard.lease.Store(0)
+	if err = stopped.Set(int64(6), Keys{{"id", int64(6)}}, Columns{{"status", int64(9)}}); !errors.Is(err, ErrReshardFenced) {
+		t.Errorf("write with expired lease: %v, want ErrReshardFenced", err)
+	}
+
+	if err = reshard.Cutover(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(other.shards()) != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(other.shards()) != 3 {
+		t.Fatal("attached process did not switch to the new shards")
+	}
+	if _, err = stale.Exec("DELETE FROM {table};"); !errors.Is(err, ErrShardRetired) {
+		t.Errorf("statement of a replaced shard: %v, want ErrShardRetired", err)
+	}
+	if status, found := cachedStatus(t, table, 5); !found || status != 9 {
+		t.Errorf("row 5: %d %v, want 9", status, found)
+	}
+	if err = other.Set(int64(7), Keys{{"id", int64(7)}}, Columns{{"status", int64(8)}}); err != nil {
+		t.Fatal(err)
+	}
+	if status, found := cachedStatus(t, table, 7); !found || status != 8 {
+		t.Errorf("row 7 written after the switch: %d %v, want 8", status, found)
+	}
+}
+
+func TestReshardCutoverResume(t *testing.T) {
+	db := openSQLite(t)
+	table := newSQLiteTable(t, db, "items", 2, itemFields)
+	putItems(t, table, 20)
+	options := ReshardOptions{ShardsCount: 3, Router: ModuloRouter{Hash: StandardGetShardFunc}, LeaseTimeout: 200 * time.Millisecond}
+	reshard, err := table.NewResharder(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Copy(); err != nil {
+		t.Fatal(err)
+	}
+	// the process crashes after storing the cutover phase
+	if err = reshard.setState("suffix", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.setState("phase", reshardPhaseCutover); err != nil {
+		t.Fatal(err)
+	}
+	table.StopHealthCheck()
+
+	restarted := newSQLiteTable(t, db, "items", 2, itemFields)
+	resumed, err := restarted.NewResharder(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resumed.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(restarted.shards()) != 3 {
+		t.Fatalf("%d shards after resumed cutover, want 3", len(restarted.shards()))
+	}
+	result, err := restarted.SelectAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.cache) != 20 {
+		t.Errorf("%d rows after resumed cutover, want 20", len(result.cache))
+	}
+	for _, name := range []string{"items_old1_0", "items_old1_1", "items2"} {
+		if exists, err := tableExists(SQLite, db, name); err != nil || !exists {
+			t.Errorf("table %s: %v %v", name, exists, err)
+		}
+	}
+	if exists, _ := tableExists(SQLite, db, "items_new0"); exists {
+		t.Error("items_new0 is not renamed")
+	}
+}
+
+func TestReshardTx(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	putItems(t, table, 20)
+	reshard, err := table.NewResharder(ReshardOptions{ShardsCount: 3, Router: ModuloRouter{Hash: StandardGetShardFunc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = reshard.Copy(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// writes of transactions are mirrored after commit
+	err = table.InTx(ctx, int64(5), func(tx *Tx) error {
+		if err := tx.SingleSet(Keys{{"id", int64(5)}}, Column{Name: "status", Value: int64(9)}); err != nil {
+			return err
+		}
+		if err := tx.Put(Columns{{"id", int64(100)}, {"status", int64(2)}}); err != nil {
+			return err
+		}
+		return tx.Remove(Keys{{"id", int64(3)}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := reshard.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		if !report.Ok() {
+			t.Fatalf("shard %d is not verified after a transaction: %+v", report.Shard, report)
+		}
+	}
+
+	// cutover waits for open transactions and new ones can not begin meanwhile
+	open, err := table.Begin(ctx, int64(8), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutover := make(chan error, 1)
+	go func() {
+		cutover <- reshard.Cutover()
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !table.draining.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err = table.Begin(ctx, int64(9), nil); !errors.Is(err, ErrReshardCutover) {
+		t.Errorf("Begin during cutover: %v, want ErrReshardCutover", err)
+	}
+	if err = open.SingleSet(Keys{{"id", int64(8)}}, Column{Name: "status", Value: int64(7)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = open.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-cutover; err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int64]int64{5: 9, 8: 7, 100: 2} {
+		if status, found := cachedStatus(t, table, id); !found || status != want {
+			t.Errorf("row %d: %d %v, want %d", id, status, found, want)
+		}
+	}
+	if _, found := cachedStatus(t, table, 3); found {
+		t.Error("row 3 removed in a transaction is found")
+	}
+}
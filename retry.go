@@ -0,0 +1,101 @@
+package eplidr
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy retries statements of a Table that fail with a transient error.
+// A deadlock or lock wait timeout rolls the statement back, so every statement is retried after them.
+// After a connection failure the statement may have been applied, so only idempotent ones are retried:
+// selects, Put, PutOrUpdate, Set and Remove, but not Add or raw Exec and Query.
+// Statements of a Tx are not retried one by one, InTx retries the whole transaction.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one, 0 or 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt, it is doubled for every next one up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the random part of the delay, 0.2 makes it vary by 20% both ways
+	Jitter float64
+	// Retriable are the codes of retried errors
+	Retriable []ErrorCode
+	// RetryNonIdempotent retries every statement after a connection failure too
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy retries deadlocks, lock wait timeouts and connection failures 3 times
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Jitter:         0.2,
+	Retriable:      []ErrorCode{CodeDeadlock, CodeLockTimeout, CodeConnection},
+}
+
+// WithRetryPolicy sets retry policy of the table, statements are not retried by default
+func WithRetryPolicy(policy RetryPolicy) TableOption {
+	return func(table *Table) {
+		table.retry = policy
+	}
+}
+
+// retriable reports whether err of a statement may be retried, idempotent statements may be applied twice
+func (policy RetryPolicy) retriable(err error, idempotent bool) bool {
+	code := errorCode(err)
+	if code == CodeConnection && !idempotent && !policy.RetryNonIdempotent {
+		return false
+	}
+	for _, retriable := range policy.Retriable {
+		if retriable == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before attempt, the first attempt is 0
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	if policy.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + policy.Jitter*(rand.Float64()*2-1)))
+	}
+	return delay
+}
+
+// do calls f until it succeeds, fails with an error that is not retriable or attempts are exhausted
+func (policy RetryPolicy) do(ctx context.Context, idempotent bool, f func() error) error {
+	err := f()
+	for attempt := 1; attempt < policy.MaxAttempts && err != nil && policy.retriable(err, idempotent); attempt++ {
+		logger.Debug("retrying after ", err.Error())
+		if !policy.wait(ctx, attempt) {
+			return err
+		}
+		err = f()
+	}
+	return err
+}
+
+// wait sleeps before attempt, it returns false if ctx is done first
+func (policy RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(policy.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// retry calls f with the retry policy of the table
+func (shard *Shard) retry(ctx context.Context, idempotent bool, f func() error) error {
+	return shard.table.retry.do(ctx, idempotent, f)
+}
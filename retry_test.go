@@ -0,0 +1,117 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyHook fails the first failures statements with err
+type flakyHook struct {
+	err      error
+	failures int32
+	calls    atomic.Int32
+}
+
+func (h *flakyHook) Before(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	if h.calls.Add(1) <= h.failures {
+		return ctx, h.err
+	}
+	return ctx, nil
+}
+func (h *flakyHook) After(ctx context.Context, event *QueryEvent) {}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempt, want := range []time.Duration{1: 10, 2: 20, 3: 40, 4: 50, 5: 50} {
+		if attempt == 0 {
+			continue
+		}
+		if got := policy.backoff(attempt); got != want*time.Millisecond {
+			t.Errorf("backoff of attempt %d is %s, want %s", attempt, got, want*time.Millisecond)
+		}
+	}
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(2); got < 16*time.Millisecond || got > 24*time.Millisecond {
+			t.Fatalf("backoff with jitter %s, want 20ms ± 20%%", got)
+		}
+	}
+}
+
+func TestRetriable(t *testing.T) {
+	connection := &QueryError{Code: CodeConnection, Err: errors.New("broken pipe")}
+	tests := []struct {
+		err        error
+		idempotent bool
+		retryAll   bool
+		want       bool
+	}{
+		{ErrDeadlock, false, false, true},
+		{ErrLockTimeout, true, false, true},
+		{connection, true, false, true},
+		// an Add may have been applied before the connection failed
+		{connection, false, false, false},
+		{connection, false, true, true},
+		{ErrDuplicateKey, true, false, false},
+		{errors.New("failure"), true, false, false},
+	}
+	for _, test := range tests {
+		policy := DefaultRetryPolicy
+		policy.RetryNonIdempotent = test.retryAll
+		if got := policy.retriable(test.err, test.idempotent); got != test.want {
+			t.Errorf("retriable(%v, idempotent %v, non-idempotent retried %v) = %v, want %v",
+				test.err, test.idempotent, test.retryAll, got, test.want)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Retriable: []ErrorCode{CodeDeadlock}}
+	hook := &flakyHook{err: ErrDeadlock, failures: 2}
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields, WithRetryPolicy(policy), WithHooks(hook))
+	hook.calls.Store(0)
+	if err := table.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(1)}}); err != nil {
+		t.Fatalf("put after 2 deadlocks: %v", err)
+	}
+	if calls := hook.calls.Load(); calls != 3 {
+		t.Errorf("%d attempts, want 3", calls)
+	}
+
+	// attempts are exhausted
+	hook.calls.Store(0)
+	hook.failures = 3
+	if err := table.Put(int64(2), Columns{{"id", int64(2)}, {"status", int64(1)}}); !errors.Is(err, ErrDeadlock) {
+		t.Errorf("put after 3 deadlocks: %v, want ErrDeadlock", err)
+	}
+	if calls := hook.calls.Load(); calls != 3 {
+		t.Errorf("%d attempts, want 3", calls)
+	}
+
+	// connection failures of Add are not retried
+	hook.calls.Store(0)
+	hook.err, hook.failures = ErrConnection, 1
+	policy.Retriable = append(policy.Retriable, CodeConnection)
+	table.retry = policy
+	if err := table.Add(int64(1), Keys{{"id", int64(1)}}, Columns{{"status", int64(1)}}); !errors.Is(err, ErrConnection) {
+		t.Errorf("add after a connection failure: %v, want ErrConnection", err)
+	}
+	if calls := hook.calls.Load(); calls != 1 {
+		t.Errorf("add is attempted %d times, want once", calls)
+	}
+
+	// the wait ends with the context
+	hook.calls.Store(0)
+	hook.err, hook.failures = ErrDeadlock, 3
+	table.retry.InitialBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := table.PutContext(ctx, int64(3), Columns{{"id", int64(3)}, {"status", int64(1)}}); !errors.Is(err, ErrDeadlock) {
+		t.Errorf("put with a cancelled context: %v, want ErrDeadlock", err)
+	}
+	if calls := hook.calls.Load(); calls != 1 {
+		t.Errorf("%d attempts before the context is done, want 1", calls)
+	}
+}
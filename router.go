@@ -0,0 +1,171 @@
+package eplidr
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// ShardRouter maps a shard key to a shard number in [0, shardsCount)
+type ShardRouter interface {
+	Route(key interface{}, shardsCount uint) uint
+}
+
+// RouterValidator is a ShardRouter that can route to fixed shards, Validate reports an error if it
+// routes to a shard out of [0, shardsCount). NewTable and NewResharder validate such routers.
+type RouterValidator interface {
+	ShardRouter
+	Validate(shardsCount uint) error
+}
+
+// WithRouter sets shard router of table, ModuloRouter with StandardGetShardFunc is used by default
+func WithRouter(router ShardRouter) TableOption {
+	return func(table *Table) {
+		table.router = router
+	}
+}
+
+func validateRouter(router ShardRouter, shardsCount uint) error {
+	if router == nil {
+		return errors.New("eplidr: shard router is nil")
+	}
+	if validator, ok := router.(RouterValidator); ok {
+		return validator.Validate(shardsCount)
+	}
+	return nil
+}
+
+// ModuloRouter is Hash(key) % shardsCount. Changing shards count remaps almost every key.
+type ModuloRouter struct {
+	Hash func(interface{}) uint
+}
+
+func (r ModuloRouter) Route(key interface{}, shardsCount uint) uint {
+	return r.Hash(key) % shardsCount
+}
+
+// JumpHashRouter is jump consistent hash (Lamping, Veach), growing from n to n+1 shards
+// moves only 1/(n+1) of the keys, all of them to the new shard.
+type JumpHashRouter struct {
+	Hash func(interface{}) uint64
+}
+
+func NewJumpHashRouter() JumpHashRouter {
+	return JumpHashRouter{Hash: StandardHash64}
+}
+
+func (r JumpHashRouter) Route(key interface{}, shardsCount uint) uint {
+	return uint(jumpHash(r.Hash(key), int64(shardsCount)))
+}
+
+func jumpHash(key uint64, buckets int64) int64 {
+	var b, j int64 = -1, 0
+	for j < buckets {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return b
+}
+
+// BucketRouter hashes keys into a fixed number of virtual buckets and maps every bucket to a shard.
+// The number of buckets never changes, growing is done by moving buckets to new shards.
+type BucketRouter struct {
+	Hash func(interface{}) uint
+
+	mx      sync.RWMutex
+	buckets []uint
+	// shardsCount is the smallest shards count the router was validated with, 0 before validation
+	shardsCount uint
+	// attached is set once a table routes with the router
+	attached bool
+}
+
+// NewBucketRouter spreads bucketsCount buckets over shardsCount shards round-robin
+func NewBucketRouter(bucketsCount uint, shardsCount uint) *BucketRouter {
+	buckets := make([]uint, bucketsCount)
+	for i := range buckets {
+		buckets[i] = uint(i) % shardsCount
+	}
+	return NewBucketRouterFromMap(buckets)
+}
+
+// NewBucketRouterFromMap uses buckets[bucket] = shard as the bucket map
+func NewBucketRouterFromMap(buckets []uint) *BucketRouter {
+	return &BucketRouter{
+		Hash:    StandardGetShardFunc,
+		buckets: buckets,
+	}
+}
+
+func (r *BucketRouter) Route(key interface{}, shardsCount uint) uint {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	return r.buckets[r.Bucket(key)]
+}
+
+// Validate reports an error if a bucket is mapped to a shard out of [0, shardsCount)
+func (r *BucketRouter) Validate(shardsCount uint) error {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	if len(r.buckets) == 0 {
+		return errors.New("eplidr: bucket router has no buckets")
+	}
+	for bucket, shard := range r.buckets {
+		if shard >= shardsCount {
+			return fmt.Errorf("eplidr: bucket %d is mapped to shard %d, table has %d shards", bucket, shard, shardsCount)
+		}
+	}
+	if r.shardsCount == 0 || shardsCount < r.shardsCount {
+		r.shardsCount = shardsCount
+	}
+	return nil
+}
+
+// attachRouter marks the router as routing rows of a table, its buckets can not be moved anymore
+func attachRouter(router ShardRouter) {
+	if r, ok := router.(*BucketRouter); ok {
+		r.mx.Lock()
+		r.attached = true
+		r.mx.Unlock()
+	}
+}
+
+// Bucket returns virtual bucket of key
+func (r *BucketRouter) Bucket(key interface{}) uint {
+	return r.Hash(key) % uint(len(r.buckets))
+}
+
+// Move maps bucket to shard, shard must exist in the tables validating the router.
+// Buckets of a router used by a table can not be moved, the rows of the bucket would stay on the old shard:
+// copy the router with Map and NewBucketRouterFromMap, move buckets of the copy and pass it to a Resharder
+// in ReshardOptions.Router.
+func (r *BucketRouter) Move(bucket uint, shard uint) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.attached {
+		return errors.New("eplidr: bucket router is used by a table, buckets are moved by a Resharder")
+	}
+	if bucket >= uint(len(r.buckets)) {
+		return fmt.Errorf("eplidr: bucket %d out of %d buckets", bucket, len(r.buckets))
+	}
+	if r.shardsCount != 0 && shard >= r.shardsCount {
+		return fmt.Errorf("eplidr: bucket %d can not be moved to shard %d, table has %d shards", bucket, shard, r.shardsCount)
+	}
+	r.buckets[bucket] = shard
+	return nil
+}
+
+// Map returns a copy of the bucket map
+func (r *BucketRouter) Map() []uint {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	return append([]uint(nil), r.buckets...)
+}
+
+func StandardHash64(key interface{}) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(fmt.Sprintf("%v", key)))
+	return hash.Sum64()
+}
@@ -0,0 +1,59 @@
+package eplidr
+
+import (
+	"testing"
+)
+
+func TestJumpHashRouterGrowth(t *testing.T) {
+	router := NewJumpHashRouter()
+	moved := 0
+	for key := 0; key < 1000; key++ {
+		before, after := router.Route(key, 4), router.Route(key, 5)
+		if before >= 4 || after >= 5 {
+			t.Fatalf("key %d routed out of range: %d, %d", key, before, after)
+		}
+		if before != after {
+			if after != 4 {
+				t.Errorf("key %d moved from %d to old shard %d", key, before, after)
+			}
+			moved++
+		}
+	}
+	// about 1/5 of the keys move to the new shard
+	if moved < 100 || moved > 300 {
+		t.Errorf("%d of 1000 keys moved", moved)
+	}
+}
+
+func TestBucketRouter(t *testing.T) {
+	router := NewBucketRouter(8, 2)
+	if err := router.Validate(1); err == nil {
+		t.Error("bucket map of 2 shards is valid for 1 shard")
+	}
+	if err := router.Validate(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Move(8, 1); err == nil {
+		t.Error("bucket out of range is moved")
+	}
+	if err := router.Move(0, 2); err == nil {
+		t.Error("bucket is moved to shard out of range")
+	}
+	if err := router.Move(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	for key := 0; key < 100; key++ {
+		if shard := router.Route(key, 2); shard != router.Map()[router.Bucket(key)] {
+			t.Fatalf("key %d routed to %d, bucket %d is on %d", key, shard, router.Bucket(key), router.Map()[router.Bucket(key)])
+		}
+	}
+
+	newSQLiteTable(t, openSQLite(t), "items", 2, itemFields, WithRouter(router))
+	if err := router.Move(1, 0); err == nil {
+		t.Error("bucket of a router used by a table is moved")
+	}
+	moved := NewBucketRouterFromMap(router.Map())
+	if err := moved.Move(1, 0); err != nil {
+		t.Error(err)
+	}
+}
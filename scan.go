@@ -0,0 +1,203 @@
+package eplidr
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"strconv"
+)
+
+// Values of selected rows are scanned into these types, NULL is nil:
+//
+//	BasicTypeInt64 int64, BasicTypeInt32 int32, BasicTypeUint64 uint64, BasicTypeUint32 uint32,
+//	BasicTypeFloat float64, BasicTypeBool bool, BasicTypeVarChar string,
+//	TypeUUID uuid.UUID, TypeBigInt *big.Int, other binary types []byte
+
+// isBigIntType reports whether t stores big.Int bytes
+func isBigIntType(t Type) bool {
+	return t == TypeBigInt || t == TypeHugeInt || t == TypeHugeHugeInt
+}
+
+// selectColumn returns select expression of field, decoded columns are aliased to the field name
+func selectColumn(dialect Dialect, field TableField) string {
+	column := dialect.QuoteIdentifier(field.GetName())
+	if decoded := dialect.DecodeColumn(field.GetType(), column); decoded != column {
+		return fmt.Sprintf("%s AS %s", decoded, column)
+	}
+	return column
+}
+
+// nullUint64 is sql.NullInt64 for unsigned columns, their values may not fit int64
+type nullUint64 struct {
+	value uint64
+	valid bool
+}
+
+func (n *nullUint64) Scan(src interface{}) error {
+	n.value, n.valid = 0, src != nil
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case int64:
+		if src < 0 {
+			return fmt.Errorf("eplidr: can not scan negative %d into unsigned column", src)
+		}
+		n.value = uint64(src)
+		return nil
+	case []byte:
+		value, err := strconv.ParseUint(string(src), 10, 64)
+		n.value = value
+		return err
+	case string:
+		value, err := strconv.ParseUint(src, 10, 64)
+		n.value = value
+		return err
+	}
+	var value sql.NullInt64
+	err := value.Scan(src)
+	n.value = uint64(value.Int64)
+	return err
+}
+
+// rowScanner scans rows of fields, constraint fields must not be selected
+type rowScanner struct {
+	fields       TableFields
+	destinations []interface{}
+}
+
+func newRowScanner(fields TableFields) *rowScanner {
+	scanner := &rowScanner{
+		fields:       fields,
+		destinations: make([]interface{}, len(fields)),
+	}
+	for i, field := range fields {
+		switch field.GetType().GetBasicType() {
+		case BasicTypeInt64:
+			scanner.destinations[i] = new(sql.NullInt64)
+		case BasicTypeInt32:
+			scanner.destinations[i] = new(sql.NullInt32)
+		case BasicTypeUint64, BasicTypeUint32:
+			scanner.destinations[i] = new(nullUint64)
+		case BasicTypeFloat:
+			scanner.destinations[i] = new(sql.NullFloat64)
+		case BasicTypeBool:
+			scanner.destinations[i] = new(sql.NullBool)
+		case BasicTypeVarChar:
+			scanner.destinations[i] = new(sql.NullString)
+		default:
+			// binary types, also a text UUID returned by DecodeColumn
+			scanner.destinations[i] = new([]byte)
+		}
+	}
+	return scanner
+}
+
+// scan returns values of the current row of rows in the order of fields
+func (scanner *rowScanner) scan(rows *sql.Rows) ([]interface{}, error) {
+	err := rows.Scan(scanner.destinations...)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(scanner.fields))
+	for i, field := range scanner.fields {
+		switch destination := scanner.destinations[i].(type) {
+		case *sql.NullInt64:
+			if destination.Valid {
+				values[i] = destination.Int64
+			}
+		case *sql.NullInt32:
+			if destination.Valid {
+				values[i] = destination.Int32
+			}
+		case *nullUint64:
+			if destination.valid && field.GetType().GetBasicType() == BasicTypeUint32 {
+				values[i] = uint32(destination.value)
+			} else if destination.valid {
+				values[i] = destination.value
+			}
+		case *sql.NullFloat64:
+			if destination.Valid {
+				values[i] = destination.Float64
+			}
+		case *sql.NullBool:
+			if destination.Valid {
+				values[i] = destination.Bool
+			}
+		case *sql.NullString:
+			if destination.Valid {
+				values[i] = destination.String
+			}
+		case *[]byte:
+			if *destination == nil {
+				continue
+			}
+			bytes := append([]byte(nil), *destination...)
+			switch {
+			case field.GetType() == TypeUUID:
+				values[i], err = decodeUUID(bytes)
+				if err != nil {
+					return nil, fmt.Errorf("eplidr: column %s: %w", field.GetName(), err)
+				}
+			case isBigIntType(field.GetType()):
+				values[i] = new(big.Int).SetBytes(bytes)
+			default:
+				values[i] = bytes
+			}
+		}
+	}
+	return values, nil
+}
+
+// decodeUUID decodes binary or text UUID
+func decodeUUID(bytes []byte) (uuid.UUID, error) {
+	if len(bytes) == 16 {
+		return uuid.FromBytes(bytes)
+	}
+	return uuid.ParseBytes(bytes)
+}
+
+// selectResult is a result of select with the current row
+type selectResult interface {
+	value(name string) (interface{}, error)
+}
+
+// resultValue converts value of column name to T, NULL is the zero value of T
+func resultValue[T any](res selectResult, name string) (T, error) {
+	var result T
+	value, err := res.value(name)
+	if err != nil || value == nil {
+		return result, err
+	}
+	result, ok := value.(T)
+	if !ok {
+		return result, fmt.Errorf("eplidr: column %s is %T, not %T", name, value, result)
+	}
+	return result, nil
+}
+
+// resultInt64 converts value of an integer column name to int64
+func resultInt64(res selectResult, name string) (int64, error) {
+	value, err := res.value(name)
+	if err != nil || value == nil {
+		return 0, err
+	}
+	switch value := value.(type) {
+	case int64:
+		return value, nil
+	case int32:
+		return int64(value), nil
+	case uint32:
+		return int64(value), nil
+	case uint64:
+		if value > 1<<63-1 {
+			return 0, fmt.Errorf("eplidr: column %s value %d overflows int64", name, value)
+		}
+		return int64(value), nil
+	}
+	return 0, fmt.Errorf("eplidr: column %s is %T, not an integer", name, value)
+}
+
+func notSelected(name string) error {
+	return fmt.Errorf("%w %s, it is not selected", ErrUnknownColumn, name)
+}
@@ -0,0 +1,312 @@
+package eplidr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// ErrUnmergeableOrder is returned by SelectAll of several shards ordered by a column whose order
+// can not be reproduced when the rows are merged
+var ErrUnmergeableOrder = errors.New("eplidr: order can not be merged across shards")
+
+// OrderBy is a column of ORDER BY clause
+type OrderBy struct {
+	Column string
+	Desc   bool
+}
+
+// SelectOptions are optional ordering and paging of a select.
+// Primary key columns are appended to OrderBy when any option is set, so the order of rows is stable.
+type SelectOptions struct {
+	OrderBy []OrderBy
+	// Limit is the maximum number of rows, 0 means no limit
+	Limit int
+	// Offset is the number of skipped rows, After should be preferred for deep pages
+	Offset int
+	// After is the Cursor of the last row of the previous page, only rows after it are selected.
+	// The page must be selected with the same OrderBy.
+	After string
+	// Columns are the selected columns, all columns are selected if it is empty.
+	// Columns of the order are selected too, they are needed for merging and Cursor.
+	Columns []string
+}
+
+func mergeSelectOptions(options []SelectOptions) SelectOptions {
+	if len(options) == 0 {
+		return SelectOptions{}
+	}
+	return options[0]
+}
+
+func (options SelectOptions) isSet() bool {
+	return len(options.OrderBy) != 0 || options.Limit > 0 || options.Offset > 0 || options.After != ""
+}
+
+// order returns OrderBy followed by the primary key columns missing in it
+func (options SelectOptions) order(table *Table) []OrderBy {
+	if !options.isSet() {
+		return nil
+	}
+	order := append([]OrderBy(nil), options.OrderBy...)
+	for _, key := range table.primaryKeys() {
+		found := false
+		for _, column := range options.OrderBy {
+			if strings.EqualFold(column.Column, key) {
+				found = true
+			}
+		}
+		if !found {
+			order = append(order, OrderBy{Column: key})
+		}
+	}
+	return order
+}
+
+// fields returns the selected fields of table, constraints are never selected
+func (options SelectOptions) fields(table *Table) (TableFields, error) {
+	var result TableFields
+	if len(options.Columns) == 0 {
+		for _, field := range table.fields {
+			if field.GetType().GetBasicType() != BasicTypeNone {
+				result = append(result, field)
+			}
+		}
+		return result, nil
+	}
+	add := func(name string, required bool) error {
+		for _, field := range result {
+			if strings.EqualFold(field.GetName(), name) {
+				return nil
+			}
+		}
+		for _, field := range table.fields {
+			if strings.EqualFold(field.GetName(), name) && field.GetType().GetBasicType() != BasicTypeNone {
+				result = append(result, field)
+				return nil
+			}
+		}
+		if required {
+			return fmt.Errorf("%w %s of %s", ErrUnknownColumn, name, table.name)
+		}
+		return nil
+	}
+	for _, column := range options.Columns {
+		err := add(column, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, column := range options.order(table) {
+		err := add(column.Column, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// mergeable returns ErrUnmergeableOrder if the order is not compared by compareValues like the dialect
+// orders it: strings have the collation of the column and big integers are ordered by their bytes
+func (options SelectOptions) mergeable(table *Table) error {
+	for _, column := range options.order(table) {
+		field := table.getField(column.Column)
+		if field == nil {
+			continue
+		}
+		if isBigIntType(field.GetType()) {
+			return fmt.Errorf("%w: %s is ordered by bytes", ErrUnmergeableOrder, column.Column)
+		}
+		if field.GetType().GetBasicType() == BasicTypeVarChar && !table.dialect.BinaryCollation() {
+			return fmt.Errorf("%w: %s has the collation of %s", ErrUnmergeableOrder, column.Column, table.dialect.Name())
+		}
+	}
+	return nil
+}
+
+func (options SelectOptions) write(table *Table, stmt *statement) {
+	order := options.order(table)
+	if len(order) != 0 {
+		stmt.write(" ORDER BY ")
+		for i, column := range order {
+			if i != 0 {
+				stmt.write(", ")
+			}
+			stmt.ident(column.Column)
+			if column.Desc {
+				stmt.write(" DESC")
+			} else {
+				stmt.write(" ASC")
+			}
+		}
+	}
+	stmt.write(table.dialect.Limit(options.Limit, options.Offset))
+}
+
+// SelectAll runs the same select on every shard concurrently and merges the rows.
+// ORDER BY, LIMIT and After are pushed down to every shard and applied again after the merge,
+// every shard selects Limit + Offset rows. Tables of several shards can not be ordered by big integers,
+// or by strings unless the dialect has BinaryCollation, ErrUnmergeableOrder is returned.
+func (table *Table) SelectAll(where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	return table.SelectAllContext(context.Background(), where, options...)
+}
+
+// SelectAllContext is SelectAll, the selects of all shards are cancelled when ctx is done
+func (table *Table) SelectAllContext(ctx context.Context, where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	option := mergeSelectOptions(options)
+	shardOption := option
+	if option.Offset > 0 {
+		if option.Limit > 0 {
+			shardOption.Limit = option.Limit + option.Offset
+		}
+		shardOption.Offset = 0
+	}
+	fields, err := option.fields(table)
+	if err != nil {
+		return nil, err
+	}
+	shards := table.shards()
+	if len(shards) > 1 {
+		if err := option.mergeable(table); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]*FullSelectResult, len(shards))
+	errs := make([]error, len(shards))
+	tasks := make([]func(), len(shards))
+	for i := range shards {
+		i := i
+		tasks[i] = func() {
+			errs[i] = shards[i].retry(ctx, true, func() (err error) {
+				return shards[i].read(ctx, func(ex executor) (err error) {
+					results[i], err = shards[i].fullSelect(ctx, ex, where, shardOption)
+					return err
+				})
+			})
+		}
+	}
+	fanOut(tasks...)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mergeFullSelectResults(table, fields, results, option)
+}
+
+func mergeFullSelectResults(table *Table, fields TableFields, results []*FullSelectResult, options SelectOptions) (*FullSelectResult, error) {
+	order := options.order(table)
+	merged := &FullSelectResult{
+		fields:  fields,
+		pointer: -1,
+		order:   order,
+	}
+	for _, result := range results {
+		merged.cache = append(merged.cache, result.cache...)
+	}
+	if len(order) != 0 {
+		indexes := make([]int, len(order))
+		for i, order := range order {
+			indexes[i] = -1
+			for j, field := range fields {
+				if strings.EqualFold(field.GetName(), order.Column) {
+					indexes[i] = j
+				}
+			}
+			if indexes[i] == -1 {
+				return nil, fmt.Errorf("%w %s in order", ErrUnknownColumn, order.Column)
+			}
+		}
+		sort.SliceStable(merged.cache, func(a, b int) bool {
+			for i, order := range order {
+				c := compareValues(table.dialect, merged.cache[a][indexes[i]], merged.cache[b][indexes[i]])
+				if c == 0 {
+					continue
+				}
+				if order.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if options.Offset > 0 {
+		if len(merged.cache) > options.Offset {
+			merged.cache = merged.cache[options.Offset:]
+		} else {
+			merged.cache = nil
+		}
+	}
+	if options.Limit > 0 && len(merged.cache) > options.Limit {
+		merged.cache = merged.cache[:options.Limit]
+	}
+	return merged, nil
+}
+
+// compareValues compares two scanned values of the same column like ORDER BY of dialect, nil is less than any value
+func compareValues(dialect Dialect, a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch a := a.(type) {
+	case int:
+		return compareOrdered(int64(a), int64(b.(int)))
+	case int32:
+		return compareOrdered(int64(a), int64(b.(int32)))
+	case int64:
+		return compareOrdered(a, b.(int64))
+	case uint:
+		return compareOrdered(uint64(a), uint64(b.(uint)))
+	case uint32:
+		return compareOrdered(uint64(a), uint64(b.(uint32)))
+	case uint64:
+		return compareOrdered(a, b.(uint64))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		return compareOrdered(boolToInt(a), boolToInt(b.(bool)))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	case *big.Int:
+		return a.Cmp(b.(*big.Int))
+	case uuid.UUID:
+		return bytes.Compare(dialect.UUIDSortKey(a), dialect.UUIDSortKey(b.(uuid.UUID)))
+	}
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+type ordered interface {
+	~int64 | ~uint64 | ~float64
+}
+
+func compareOrdered[T ordered](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package eplidr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectAllOrder(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 3, itemFields)
+	putItems(t, table, 10)
+	// status desc, then id asc added to the order
+	result, err := table.SelectAll(nil, SelectOptions{OrderBy: []OrderBy{{Column: "status", Desc: true}}, Limit: 4, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := selectedIDs(t, result), []int64{8, 1, 4, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	result, err = table.SelectAll(Ne("status", 0), SelectOptions{OrderBy: []OrderBy{{Column: "id", Desc: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := selectedIDs(t, result), []int64{8, 7, 5, 4, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSelectAllStringOrder(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 3, itemFields)
+	for i, name := range []string{"b", "B", "a", "A", "c"} {
+		err := table.Put(int64(i), Columns{{"id", int64(i)}, {"name", name}, {"status", int64(0)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := table.SelectAll(nil, SelectOptions{OrderBy: []OrderBy{{Column: "name"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for result.Next() {
+		names = append(names, result.GetString("name"))
+	}
+	// BINARY collation of SQLite orders upper case first, like the merge
+	if want := []string{"A", "B", "a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	fields := append(TableFields{DefaultTableField{Name: "balance", Type: TypeBigInt}}, itemFields...)
+	tests := []struct {
+		dialect Dialect
+		column  string
+		err     error
+	}{
+		{MySQL, "name", ErrUnmergeableOrder},
+		{PostgreSQL, "name", ErrUnmergeableOrder},
+		{SQLite, "name", nil},
+		{SQLite, "balance", ErrUnmergeableOrder},
+		{MySQL, "status", nil},
+	}
+	for _, test := range tests {
+		options := SelectOptions{OrderBy: []OrderBy{{Column: test.column}}}
+		if err := options.mergeable(renderTable(test.dialect, fields)); !errors.Is(err, test.err) {
+			t.Errorf("%s order by %s: %v, want %v", test.dialect.Name(), test.column, err, test.err)
+		}
+	}
+}
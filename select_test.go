@@ -0,0 +1,156 @@
+package eplidr
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func fieldNames(fields TableFields) []string {
+	var names []string
+	for _, field := range fields {
+		names = append(names, field.GetName())
+	}
+	return names
+}
+
+func TestSelectColumns(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields)
+	putItems(t, table, 3)
+
+	result, err := table.FullSelect(int64(0), Eq("id", int64(1)), SelectOptions{Columns: []string{"status"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fieldNames(result.fields); !reflect.DeepEqual(got, []string{"status"}) {
+		t.Errorf("selected %v, want only status", got)
+	}
+	if !result.Next() || result.GetInt64("status") != 1 {
+		t.Fatalf("status of row 1 is %d", result.GetInt64("status"))
+	}
+	if _, err = result.GetBytes("name"); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("not selected column: %v, want ErrUnknownColumn", err)
+	}
+	if result.IsNull("name") || result.Get("name") != nil {
+		t.Error("not selected column is reported as NULL or has a value")
+	}
+
+	// columns of the order and the primary key are selected for the cursor
+	gradual, err := table.GradualSelect(int64(0), nil, SelectOptions{Columns: []string{"NAME"}, OrderBy: []OrderBy{{Column: "status", Desc: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gradual.Close()
+	if got := fieldNames(gradual.fields); !reflect.DeepEqual(got, []string{"name", "status", "id"}) {
+		t.Errorf("selected %v, want name, status and id", got)
+	}
+	var ids []int64
+	for {
+		next, err := gradual.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !next {
+			break
+		}
+		if gradual.GetString("name") != "item" {
+			t.Errorf("name %q", gradual.GetString("name"))
+		}
+		ids = append(ids, gradual.GetInt64("id"))
+	}
+	if want := []int64{2, 1, 0}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+
+	if _, err = table.FullSelect(int64(0), nil, SelectOptions{Columns: []string{"missing"}}); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("select of a missing column: %v, want ErrUnknownColumn", err)
+	}
+}
+
+var typedFields = TableFields{
+	DefaultTableField{Name: "id", Type: TypeInt64, PrimaryKey: true},
+	DefaultTableField{Name: "small", Type: TypeInt32, Nullable: true},
+	DefaultTableField{Name: "count", Type: TypeUint32, Nullable: true},
+	DefaultTableField{Name: "time", Type: TypeTimestamp, Nullable: true},
+	DefaultTableField{Name: "ratio", Type: TypeFloat, Nullable: true},
+	DefaultTableField{Name: "active", Type: TypeBool, Nullable: true},
+	DefaultTableField{Name: "uuid", Type: TypeUUID, Nullable: true},
+	DefaultTableField{Name: "balance", Type: TypeBigInt, Nullable: true},
+	DefaultTableField{Name: "data", Type: GetSizedType(BasicTypeVarByte, 16), Nullable: true},
+}
+
+func TestSelectTypes(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "typed", 1, typedFields)
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	balance, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	err := table.Put(int64(0), Columns{{"id", int64(1)}, {"small", int32(-5)}, {"count", uint32(7)}, {"time", uint64(1 << 40)},
+		{"ratio", 0.5}, {"active", true}, {"uuid", id}, {"balance", balance}, {"data", []byte{0, 1, 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = table.Put(int64(0), Columns{{"id", int64(2)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := table.FullSelect(int64(0), nil, SelectOptions{OrderBy: []OrderBy{{Column: "id"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Next() {
+		t.Fatal("no rows")
+	}
+	want := map[string]interface{}{
+		"id": int64(1), "small": int32(-5), "count": uint32(7), "time": uint64(1 << 40),
+		"ratio": 0.5, "active": true, "uuid": id, "data": []byte{0, 1, 2},
+	}
+	for name, value := range want {
+		if got := result.Get(name); !reflect.DeepEqual(got, value) {
+			t.Errorf("%s is %T %v, want %T %v", name, got, got, value, value)
+		}
+	}
+	if got, err := result.GetBigInt("balance"); err != nil || got.Cmp(balance) != 0 {
+		t.Errorf("balance %v %v, want %v", got, err, balance)
+	}
+	if got, err := result.GetInt32("small"); err != nil || got != -5 {
+		t.Errorf("GetInt32: %d %v", got, err)
+	}
+	if got := result.GetInt64("count"); got != 7 {
+		t.Errorf("GetInt64 of uint32 column: %d", got)
+	}
+	if _, err = result.GetUUID("data"); err == nil {
+		t.Error("GetUUID of a binary column succeeded")
+	}
+
+	// NULL is nil and the zero value of the getters
+	if !result.Next() {
+		t.Fatal("row 2 is not selected")
+	}
+	for _, field := range typedFields[1:] {
+		if !result.IsNull(field.GetName()) {
+			t.Errorf("%s of row 2 is %v, want NULL", field.GetName(), result.Get(field.GetName()))
+		}
+	}
+	if got, err := result.GetBigInt("balance"); err != nil || got != nil {
+		t.Errorf("NULL balance: %v %v", got, err)
+	}
+
+	gradual, err := table.GradualSelect(int64(0), Eq("id", int64(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gradual.Close()
+	if next, err := gradual.Next(); !next || err != nil {
+		t.Fatalf("GradualSelect: %v %v", next, err)
+	}
+	if got, err := gradual.GetUUID("uuid"); err != nil || got != id {
+		t.Errorf("GetUUID: %v %v", got, err)
+	}
+	if got, err := gradual.GetBytes("data"); err != nil || !reflect.DeepEqual(got, []byte{0, 1, 2}) {
+		t.Errorf("GetBytes: %v %v", got, err)
+	}
+	if got := gradual.GetUint64("time"); got != 1<<40 {
+		t.Errorf("GetUint64: %d", got)
+	}
+}
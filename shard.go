@@ -4,249 +4,186 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"github.com/oppositemc/nonimus"
 	"math/big"
 	"strings"
+	"sync/atomic"
 )
 
 type Shard struct {
 	table  *Table
 	driver *sql.DB
 	num    uint
+	// name of the shard table
+	name    string
+	breaker breaker
+	// pinging is set while the health check pings the shard
+	pinging atomic.Bool
+	// replicas are read instead of driver, nextReplica is the round-robin counter
+	replicas    []*replica
+	nextReplica atomic.Uint32
+	// retired is set when resharding cutover replaces the shard, its statements fail with ErrShardRetired
+	retired atomic.Bool
 }
 
 // GradualSelectResult is using for select when you do not want to save all the selected data
 type GradualSelectResult struct {
-	cache  map[string]interface{} // Pointers
-	fields TableFields
-	rows   *sql.Rows
+	cache   map[string]interface{}
+	fields  TableFields
+	rows    *sql.Rows
+	scanner *rowScanner
+	// order of the select, used by Cursor
+	order []OrderBy
+	// call reports the number of read rows to the hooks when the rows are read or closed
+	call *queryCall
+	read int64
 }
 
 func (res *GradualSelectResult) Next() (bool, error) {
-	ok := res.rows.Next()
-	if !ok {
-		return false, nil
-	}
-	var sgbdrn []interface{}
-	i := 0
-	for _, field := range res.fields {
-		var fieldDestPtr any
-		switch field.GetType().GetBasicType() {
-		case BasicTypeFloat:
-			{
-				fieldDestPtr = new(float64)
-			}
-		case BasicTypeBool:
-			{
-				fieldDestPtr = new(bool)
-			}
-		case BasicTypeVarChar:
-			{
-				fieldDestPtr = new(string)
-			}
-		case BasicTypeInt64:
-			{
-				fieldDestPtr = new(int64)
-			}
-		case BasicTypeInt32:
-			{
-				fieldDestPtr = new(int)
-			}
-		case BasicTypeUint64:
-			{
-				fieldDestPtr = new(uint64)
-			}
-		case BasicTypeUint32:
-			{
-				fieldDestPtr = new(uint)
-			}
-		case BasicTypeBinary:
-			{
-				fieldDestPtr = new([]byte)
-			}
-		case BasicTypeVarByte:
-			{
-				fieldDestPtr = new([]byte)
-			}
-		case BasicTypeNone:
-			{
-				logger.Debug("typeNone ", field.GetName())
-				continue
-			}
-		default:
-			panic("Error! No basic type found for " + field.GetName() + " type query: " + field.GetType().Query())
-		}
-		sgbdrn = append(sgbdrn, fieldDestPtr)
-		i++
+	if !res.rows.Next() {
+		res.done()
+		return false, res.rows.Err()
 	}
-	err := res.rows.Scan(sgbdrn...)
+	values, err := res.scanner.scan(res.rows)
 	if err != nil {
 		return false, err
 	}
-	i = 0
-	for _, field := range res.fields {
-		//logger.Debug("Field: ", field.GetName(), field.GetType().GetBasicType())
-		switch field.GetType().GetBasicType() {
-		case BasicTypeFloat:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*float64))
-			}
-		case BasicTypeBool:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*bool))
-			}
-		case BasicTypeVarChar:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*string))
-			}
-		case BasicTypeInt64:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*int64))
-			}
-		case BasicTypeInt32:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*int))
-			}
-		case BasicTypeUint64:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*uint64))
-			}
-		case BasicTypeUint32:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*uint))
-			}
-		case BasicTypeBinary:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*[]byte))
-			}
-		case BasicTypeVarByte:
-			{
-				res.cache[field.GetName()] = *(sgbdrn[i].(*[]byte))
-			}
-		case BasicTypeNone:
-			{
-				continue
-			}
-		default:
-			panic("Error! No basic type found for " + field.GetName() + " type query: " + field.GetType().Query())
-		}
-		i++
-	}
-	for _, field := range res.fields {
-		switch field.GetType() {
-		case TypeBigInt:
-			res.cache[field.GetName()] = new(big.Int).SetBytes(res.cache[field.GetName()].([]byte))
-		}
+	res.read++
+	for i, field := range res.fields {
+		res.cache[field.GetName()] = values[i]
 	}
 	return true, nil
 }
+
+// Close closes rows of a select that is not read till the end
+func (res *GradualSelectResult) Close() error {
+	res.done()
+	return res.rows.Close()
+}
+func (res *GradualSelectResult) done() {
+	if res.call != nil {
+		res.call.rows(res.read)
+		res.call = nil
+	}
+}
+func (res *GradualSelectResult) value(name string) (interface{}, error) {
+	value, ok := res.cache[name]
+	if !ok {
+		return nil, notSelected(name)
+	}
+	return value, nil
+}
 func (res *GradualSelectResult) Get(name string) interface{} {
 	return res.cache[name]
 }
+
+// IsNull reports whether column name of the current row is NULL
+func (res *GradualSelectResult) IsNull(name string) bool {
+	value, err := res.value(name)
+	return err == nil && value == nil
+}
+
+// Getters without error return the zero value if the column is NULL, not selected or of another type
 func (res *GradualSelectResult) GetString(name string) string {
-	return res.cache[name].(string)
+	result, _ := resultValue[string](res, name)
+	return result
 }
 func (res *GradualSelectResult) GetInt(name string) int {
-	return res.cache[name].(int)
+	result, _ := resultInt64(res, name)
+	return int(result)
 }
 func (res *GradualSelectResult) GetInt64(name string) int64 {
-	return res.cache[name].(int64)
+	result, _ := resultInt64(res, name)
+	return result
 }
 func (res *GradualSelectResult) GetUint64(name string) uint64 {
-	return res.cache[name].(uint64)
+	result, _ := resultValue[uint64](res, name)
+	return result
 }
 func (res *GradualSelectResult) GetBool(name string) bool {
-	return res.cache[name].(bool)
+	result, _ := resultValue[bool](res, name)
+	return result
 }
 func (res *GradualSelectResult) GetFloat64(name string) float64 {
-	return res.cache[name].(float64)
+	result, _ := resultValue[float64](res, name)
+	return result
+}
+func (res *GradualSelectResult) GetInt32(name string) (int32, error) {
+	return resultValue[int32](res, name)
+}
+func (res *GradualSelectResult) GetUint32(name string) (uint32, error) {
+	return resultValue[uint32](res, name)
+}
+func (res *GradualSelectResult) GetBytes(name string) ([]byte, error) {
+	return resultValue[[]byte](res, name)
+}
+func (res *GradualSelectResult) GetUUID(name string) (uuid.UUID, error) {
+	return resultValue[uuid.UUID](res, name)
+}
+
+// GetBigInt returns nil if the column is NULL
+func (res *GradualSelectResult) GetBigInt(name string) (*big.Int, error) {
+	return resultValue[*big.Int](res, name)
 }
 
-func (res *GradualSelectResult) GetBigInt(name string) *big.Int {
-	return res.cache[name].(*big.Int)
+func (shard *Shard) GradualSelect(where Condition, options ...SelectOptions) (*GradualSelectResult, error) {
+	return shard.GradualSelectContext(context.Background(), where, options...)
 }
 
-func (shard *Shard) GradualSelect(keys Keys) (*GradualSelectResult, error) {
-	query := fmt.Sprintf("SELECT %s FROM {table} %s;", ColumnNamesToQuery(shard.table.getFieldNames()...), keys.Query(shard.table))
-	rows, err := shard.Query(query)
+// GradualSelectContext is GradualSelect, rows are closed by the driver when ctx is done
+func (shard *Shard) GradualSelectContext(ctx context.Context, where Condition, options ...SelectOptions) (*GradualSelectResult, error) {
+	var result *GradualSelectResult
+	err := shard.retry(ctx, true, func() (err error) {
+		return shard.read(ctx, func(ex executor) (err error) {
+			result, err = shard.gradualSelect(ctx, ex, where, mergeSelectOptions(options))
+			return err
+		})
+	})
+	return result, err
+}
+func (shard *Shard) gradualSelect(ctx context.Context, ex executor, where Condition, options SelectOptions) (*GradualSelectResult, error) {
+	fields, err := options.fields(shard.table)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := shard.selectStatement(where, fields, options)
+	if err != nil {
+		return nil, err
+	}
+	rows, call, err := shard.queryCall(withColumns(withOperation(ctx, OpSelect), stmt), ex, stmt.String(), stmt.args...)
 	if err != nil {
 		return nil, err
 	}
 	return &GradualSelectResult{
-		cache:  make(map[string]interface{}),
-		fields: shard.table.fields,
-		rows:   rows,
+		cache:   make(map[string]interface{}),
+		fields:  fields,
+		rows:    rows,
+		scanner: newRowScanner(fields),
+		order:   options.order(shard.table),
+		call:    call,
 	}, nil
 }
 
 type FullSelectResult struct {
-	cache   [][]interface{} // Pointers
+	cache   [][]interface{}
 	pointer int
 	fields  TableFields
 	rows    *sql.Rows
+	// order of the select, used by Cursor
+	order []OrderBy
 }
 
 func (res *FullSelectResult) scan() error {
+	scanner := newRowScanner(res.fields)
 	for res.rows.Next() {
-		var data []any
-		var pointers []any
-		columnIndex := 0
-		for _, field := range res.fields {
-			switch field.GetType().GetBasicType() {
-			case BasicTypeFloat:
-				{
-					data = append(data, float64(0))
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeBool:
-				{
-					data = append(data, false)
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeVarChar:
-				{
-					data = append(data, "")
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeInt64:
-				{
-					data = append(data, int64(0))
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeInt32:
-				{
-					data = append(data, int32(0))
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeUint64:
-				{
-					data = append(data, uint64(0))
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeUint32:
-				{
-					data = append(data, uint32(0))
-					pointers = append(pointers, &data[columnIndex])
-				}
-			case BasicTypeNone:
-				{
-					logger.Debug("typeNone ", field.GetName())
-					continue
-				}
-			default:
-				panic("Error! No basic type found for " + field.GetName() + " type query: " + field.GetType().Query())
-			}
-			columnIndex++
-		}
-		err := res.rows.Scan(pointers...)
+		values, err := scanner.scan(res.rows)
 		if err != nil {
 			return err
 		}
-		res.cache = append(res.cache, data)
+		res.cache = append(res.cache, values)
 	}
-	return nil
+	return res.rows.Err()
 }
 
 func (res *FullSelectResult) Next() bool {
@@ -254,113 +191,186 @@ func (res *FullSelectResult) Next() bool {
 	var result = len(res.cache) > res.pointer
 	return result
 }
-func (res *FullSelectResult) Get(name string) interface{} {
+func (res *FullSelectResult) value(name string) (interface{}, error) {
 	for i := 0; i < len(res.fields); i++ {
 		if res.fields[i].GetName() == name {
-			return res.cache[res.pointer][i]
+			return res.cache[res.pointer][i], nil
 		}
 	}
-	return nil
+	return nil, notSelected(name)
 }
+func (res *FullSelectResult) Get(name string) interface{} {
+	value, _ := res.value(name)
+	return value
+}
+
+// IsNull reports whether column name of the current row is NULL
+func (res *FullSelectResult) IsNull(name string) bool {
+	value, err := res.value(name)
+	return err == nil && value == nil
+}
+
+// Getters without error return the zero value if the column is NULL, not selected or of another type
 func (res *FullSelectResult) GetString(name string) string {
-	return res.Get(name).(string)
+	result, _ := resultValue[string](res, name)
+	return result
 }
-func (res *FullSelectResult) GetUUID(name string) *uuid.UUID {
-	for i := 0; i < len(res.fields); i++ {
-		if res.fields[i].GetName() == name {
-			id := res.cache[res.pointer][i].(uuid.UUID)
-			return &id
-		}
-	}
-	return nil
+func (res *FullSelectResult) GetInt(name string) int {
+	result, _ := resultInt64(res, name)
+	return int(result)
+}
+func (res *FullSelectResult) GetInt64(name string) int64 {
+	result, _ := resultInt64(res, name)
+	return result
+}
+func (res *FullSelectResult) GetUint64(name string) uint64 {
+	result, _ := resultValue[uint64](res, name)
+	return result
+}
+func (res *FullSelectResult) GetBool(name string) bool {
+	result, _ := resultValue[bool](res, name)
+	return result
+}
+func (res *FullSelectResult) GetFloat64(name string) float64 {
+	result, _ := resultValue[float64](res, name)
+	return result
+}
+func (res *FullSelectResult) GetInt32(name string) (int32, error) {
+	return resultValue[int32](res, name)
+}
+func (res *FullSelectResult) GetUint32(name string) (uint32, error) {
+	return resultValue[uint32](res, name)
+}
+func (res *FullSelectResult) GetBytes(name string) ([]byte, error) {
+	return resultValue[[]byte](res, name)
+}
+func (res *FullSelectResult) GetUUID(name string) (uuid.UUID, error) {
+	return resultValue[uuid.UUID](res, name)
 }
 
-func (shard *Shard) FullSelect(keys Keys) (*FullSelectResult, error) {
-	query := fmt.Sprintf("SELECT %s FROM {table} %s;", ColumnNamesToQuery(shard.table.getFieldNames()...), keys.Query(shard.table))
-	rows, err := shard.Query(query)
+// GetBigInt returns nil if the column is NULL
+func (res *FullSelectResult) GetBigInt(name string) (*big.Int, error) {
+	return resultValue[*big.Int](res, name)
+}
+
+func (shard *Shard) FullSelect(where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	return shard.FullSelectContext(context.Background(), where, options...)
+}
+func (shard *Shard) FullSelectContext(ctx context.Context, where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	var result *FullSelectResult
+	err := shard.retry(ctx, true, func() (err error) {
+		return shard.read(ctx, func(ex executor) (err error) {
+			result, err = shard.fullSelect(ctx, ex, where, mergeSelectOptions(options))
+			return err
+		})
+	})
+	return result, err
+}
+func (shard *Shard) fullSelect(ctx context.Context, ex executor, where Condition, options SelectOptions) (*FullSelectResult, error) {
+	fields, err := options.fields(shard.table)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := shard.selectStatement(where, fields, options)
+	if err != nil {
+		return nil, err
+	}
+	rows, call, err := shard.queryCall(withColumns(withOperation(ctx, OpSelect), stmt), ex, stmt.String(), stmt.args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	result := &FullSelectResult{
-		fields:  shard.table.fields,
+		fields:  fields,
 		rows:    rows,
 		pointer: -1,
+		order:   options.order(shard.table),
 	}
-	return result, result.scan()
+	err = result.scan()
+	call.rows(int64(len(result.cache)))
+	return result, err
 }
-func (shard *Shard) AsyncFullSelect(keys Keys) *nonimus.Promise[*FullSelectResult] {
-	return nonimus.AddPromise(pool, func(resolve func(*FullSelectResult), reject func(error)) {
-		query := fmt.Sprintf("SELECT %s FROM {table} %s;", ColumnNamesToQuery(shard.table.getFieldNames()...), keys.Query(shard.table))
-		rows, err := shard.Query(query)
-		if err != nil {
-			reject(err)
-			return
-		}
-		result := &FullSelectResult{
-			fields:  shard.table.fields,
-			rows:    rows,
-			pointer: -1,
-		}
-		err = result.scan()
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+func (shard *Shard) AsyncFullSelect(where Condition, options ...SelectOptions) *nonimus.Promise[*FullSelectResult] {
+	return shard.AsyncFullSelectContext(context.Background(), where, options...)
+}
+func (shard *Shard) AsyncFullSelectContext(ctx context.Context, where Condition, options ...SelectOptions) *nonimus.Promise[*FullSelectResult] {
+	return async(ctx, func() (*FullSelectResult, error) {
+		return shard.FullSelectContext(ctx, where, options...)
 	})
 }
 
 func (shard *Shard) GetString(key Key, column string) (string, bool, error) {
+	return shard.GetStringContext(context.Background(), key, column)
+}
+func (shard *Shard) GetStringContext(ctx context.Context, key Key, column string) (string, bool, error) {
 	var result string
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return "", found, err
 	}
 	return result, found, nil
 }
 func (shard *Shard) GetInt(key Key, column string) (int, bool, error) {
+	return shard.GetIntContext(context.Background(), key, column)
+}
+func (shard *Shard) GetIntContext(ctx context.Context, key Key, column string) (int, bool, error) {
 	var result int
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (shard *Shard) GetInt64(key Key, column string) (int64, bool, error) {
+	return shard.GetInt64Context(context.Background(), key, column)
+}
+func (shard *Shard) GetInt64Context(ctx context.Context, key Key, column string) (int64, bool, error) {
 	var result int64
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (shard *Shard) GetFloat(key Key, column string) (float64, bool, error) {
+	return shard.GetFloatContext(context.Background(), key, column)
+}
+func (shard *Shard) GetFloatContext(ctx context.Context, key Key, column string) (float64, bool, error) {
 	var result float64
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (shard *Shard) GetUint64(key Key, column string) (uint64, bool, error) {
+	return shard.GetUint64Context(context.Background(), key, column)
+}
+func (shard *Shard) GetUint64Context(ctx context.Context, key Key, column string) (uint64, bool, error) {
 	var result uint64
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (shard *Shard) GetUint(key Key, column string) (uint, bool, error) {
+	return shard.GetUintContext(context.Background(), key, column)
+}
+func (shard *Shard) GetUintContext(ctx context.Context, key Key, column string) (uint, bool, error) {
 	var result uint
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (shard *Shard) GetBoolean(key Key, column string) (bool, bool, error) {
+	return shard.GetBooleanContext(context.Background(), key, column)
+}
+func (shard *Shard) GetBooleanContext(ctx context.Context, key Key, column string) (bool, bool, error) {
 	var result bool
-	err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
+	err, found := shard.GetContext(ctx, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return false, found, err
 	}
@@ -373,80 +383,66 @@ type GetResult[T any] struct {
 }
 
 func (shard *Shard) AsyncGetString(key Key, column string) *nonimus.Promise[GetResult[string]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[string]), reject func(error)) {
-		var result string
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[string]{Result: result, Found: found})
+	return shard.AsyncGetStringContext(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetStringContext(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[string]] {
+	return async(ctx, func() (GetResult[string], error) {
+		result, found, err := shard.GetStringContext(ctx, key, column)
+		return GetResult[string]{Result: result, Found: found}, err
 	})
 }
 func (shard *Shard) AsyncGetInt(key Key, column string) *nonimus.Promise[GetResult[int]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[int]), reject func(error)) {
-		var result int
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[int]{Result: result, Found: found})
+	return shard.AsyncGetIntContext(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetIntContext(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[int]] {
+	return async(ctx, func() (GetResult[int], error) {
+		result, found, err := shard.GetIntContext(ctx, key, column)
+		return GetResult[int]{Result: result, Found: found}, err
 	})
 }
 func (shard *Shard) AsyncGetInt64(key Key, column string) *nonimus.Promise[GetResult[int64]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[int64]), reject func(error)) {
-		var result int64
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[int64]{Result: result, Found: found})
+	return shard.AsyncGetInt64Context(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetInt64Context(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[int64]] {
+	return async(ctx, func() (GetResult[int64], error) {
+		result, found, err := shard.GetInt64Context(ctx, key, column)
+		return GetResult[int64]{Result: result, Found: found}, err
 	})
 }
 func (shard *Shard) AsyncGetFloat(key Key, column string) *nonimus.Promise[GetResult[float64]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[float64]), reject func(error)) {
-		var result float64
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[float64]{Result: result, Found: found})
+	return shard.AsyncGetFloatContext(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetFloatContext(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[float64]] {
+	return async(ctx, func() (GetResult[float64], error) {
+		result, found, err := shard.GetFloatContext(ctx, key, column)
+		return GetResult[float64]{Result: result, Found: found}, err
 	})
 }
 func (shard *Shard) AsyncGetUint64(key Key, column string) *nonimus.Promise[GetResult[uint64]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[uint64]), reject func(error)) {
-		var result uint64
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[uint64]{Result: result, Found: found})
+	return shard.AsyncGetUint64Context(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetUint64Context(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[uint64]] {
+	return async(ctx, func() (GetResult[uint64], error) {
+		result, found, err := shard.GetUint64Context(ctx, key, column)
+		return GetResult[uint64]{Result: result, Found: found}, err
 	})
 }
 func (shard *Shard) AsyncGetUint(key Key, column string) *nonimus.Promise[GetResult[uint]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[uint]), reject func(error)) {
-		var result uint
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[uint]{Result: result, Found: found})
+	return shard.AsyncGetUintContext(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetUintContext(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[uint]] {
+	return async(ctx, func() (GetResult[uint], error) {
+		result, found, err := shard.GetUintContext(ctx, key, column)
+		return GetResult[uint]{Result: result, Found: found}, err
 	})
 }
 func (shard *Shard) AsyncGetBoolean(key Key, column string) *nonimus.Promise[GetResult[bool]] {
-	return nonimus.AddPromise(pool, func(resolve func(GetResult[bool]), reject func(error)) {
-		var result bool
-		err, found := shard.Get(Keys{key}, SelectColumns{{column, &result}})
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(GetResult[bool]{Result: result, Found: found})
+	return shard.AsyncGetBooleanContext(context.Background(), key, column)
+}
+func (shard *Shard) AsyncGetBooleanContext(ctx context.Context, key Key, column string) *nonimus.Promise[GetResult[bool]] {
+	return async(ctx, func() (GetResult[bool], error) {
+		result, found, err := shard.GetBooleanContext(ctx, key, column)
+		return GetResult[bool]{Result: result, Found: found}, err
 	})
 }
 
@@ -456,13 +452,121 @@ type PostProcessScanField struct {
 	RealOutput interface{}
 }
 
-func (shard *Shard) Get(keys Keys, columns SelectColumns) (error, bool) {
-	query := fmt.Sprintf("SELECT %s FROM {table} %s;", columns.Query(shard.table), keys.Query(shard.table))
+func (shard *Shard) getStatement(where Condition, columns SelectColumns, lock bool) *statement {
+	stmt := newStatement(shard.table.dialect, "SELECT ", columns.Query(shard.table), " FROM {table} ")
+	writeWhere(shard.table, stmt, where)
+	if lock {
+		stmt.write(shard.table.dialect.ForUpdate())
+	}
+	return stmt.write(";")
+}
+func (shard *Shard) selectStatement(where Condition, fields TableFields, options SelectOptions) (*statement, error) {
+	after, err := options.after(shard.table)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		where = And(where, after)
+	}
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = selectColumn(shard.table.dialect, field)
+	}
+	stmt := newStatement(shard.table.dialect, "SELECT ", strings.Join(columns, ", "), " FROM {table} ")
+	writeWhere(shard.table, stmt, where)
+	options.write(shard.table, stmt)
+	return stmt.write(";"), nil
+}
+func (shard *Shard) putStatement(values Columns) *statement {
+	stmt := newStatement(shard.table.dialect, "INSERT INTO {table} (")
+	for i := 0; i < len(values); i++ {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.ident(values[i].Name)
+	}
+	stmt.write(") values (")
+	for i := 0; i < len(values); i++ {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.bind(shard.table, values[i].Name, values[i].Value)
+	}
+	return stmt.write(")")
+}
+func (shard *Shard) putOrUpdateStatement(values Columns) *statement {
+	return shard.putStatement(values).write(shard.upsertClause(values))
+}
+
+// upsertClause returns the dialect clause updating values of a row with an existing primary key
+func (shard *Shard) upsertClause(values Columns) string {
+	keys := shard.table.primaryKeys()
+	var updates []string
+	for _, value := range values {
+		isKey := false
+		for _, key := range keys {
+			if strings.EqualFold(key, value.Name) {
+				isKey = true
+			}
+		}
+		if !isKey {
+			updates = append(updates, value.Name)
+		}
+	}
+	return shard.table.dialect.Upsert(keys, updates)
+}
+func (shard *Shard) setStatement(where Condition, values Columns) *statement {
+	stmt := newStatement(shard.table.dialect, "UPDATE {table} SET ")
+	for i := 0; i < len(values); i++ {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.ident(values[i].Name).write(" = ").bind(shard.table, values[i].Name, values[i].Value)
+	}
+	stmt.write(" ")
+	writeWhere(shard.table, stmt, where)
+	return stmt.write(";")
+}
+func (shard *Shard) addStatement(where Condition, values Columns) *statement {
+	stmt := newStatement(shard.table.dialect, "UPDATE {table} SET ")
+	for i := 0; i < len(values); i++ {
+		if i != 0 {
+			stmt.write(", ")
+		}
+		stmt.ident(values[i].Name).write(" = ").ident(values[i].Name).write(" + ").columnArg(values[i].Name, values[i].Value)
+	}
+	stmt.write(" ")
+	writeWhere(shard.table, stmt, where)
+	return stmt.write(";")
+}
+func (shard *Shard) removeStatement(where Condition) *statement {
+	stmt := newStatement(shard.table.dialect, "DELETE FROM {table} ")
+	writeWhere(shard.table, stmt, where)
+	return stmt.write(";")
+}
+
+func (shard *Shard) Get(where Condition, columns SelectColumns) (error, bool) {
+	return shard.GetContext(context.Background(), where, columns)
+}
+func (shard *Shard) GetContext(ctx context.Context, where Condition, columns SelectColumns) (error, bool) {
+	var found bool
+	err := shard.retry(ctx, true, func() (err error) {
+		return shard.read(ctx, func(ex executor) (err error) {
+			err, found = shard.get(ctx, ex, where, columns, false)
+			return err
+		})
+	})
+	return err, found
+}
+
+// get selects columns of the first row matching where through ex, lock adds the dialect FOR UPDATE clause
+func (shard *Shard) get(ctx context.Context, ex executor, where Condition, columns SelectColumns, lock bool) (error, bool) {
+	stmt := shard.getStatement(where, columns, lock)
 	var outputs []interface{}
 	var postProcesses []PostProcessScanField
 	for _, column := range columns {
-		switch shard.table.getField(column.Name).GetType() {
-		case TypeBigInt:
+		switch {
+		case isBigIntType(shard.table.getField(column.Name).GetType()):
 			{
 				var bytes []byte
 				outputs = append(outputs, &bytes)
@@ -476,16 +580,17 @@ func (shard *Shard) Get(keys Keys, columns SelectColumns) (error, bool) {
 			}
 		}
 	}
-	rows, err := shard.Query(query)
+	rows, call, err := shard.queryCall(withColumns(withOperation(ctx, OpGet), stmt), ex, stmt.String(), stmt.args...)
 	if err != nil {
 		return err, false
 	}
 	if rows.Next() {
+		call.rows(1)
 		err = rows.Scan(outputs...)
 		if err != nil {
-			err = rows.Close()
-			if err != nil {
-				return err, false
+			closeErr := rows.Close()
+			if closeErr != nil {
+				logger.Error(closeErr.Error())
 			}
 			return err, true
 		}
@@ -508,6 +613,9 @@ func (shard *Shard) Get(keys Keys, columns SelectColumns) (error, bool) {
 							return errors.New("error on postProcess, postProcess.RealOutput is not **big.Int or *big.Int"), true
 						}
 						*intPtr = *new(big.Int).SetBytes(*intBytesPtr)
+					} else if *intBytesPtr == nil {
+						// NULL
+						*intPtr = nil
 					} else {
 						*intPtr = new(big.Int).SetBytes(*intBytesPtr)
 					}
@@ -516,6 +624,7 @@ func (shard *Shard) Get(keys Keys, columns SelectColumns) (error, bool) {
 			}
 		}
 	} else {
+		call.rows(0)
 		err = rows.Close()
 		if err != nil {
 			return err, false
@@ -524,315 +633,222 @@ func (shard *Shard) Get(keys Keys, columns SelectColumns) (error, bool) {
 	}
 	return nil, true
 }
-func (shard *Shard) Put(values Columns) error {
-	// `%s` = ?
-	columnsString := ""
-	valuesString := ""
-	for i := 0; i < len(values); i++ {
-		if i == len(values)-1 {
-			columnsString += fmt.Sprintf("`%s`", values[i].Name)
-		} else {
-			columnsString += fmt.Sprintf("`%s`, ", values[i].Name)
-		}
-	}
-	for i := 0; i < len(values); i++ {
-		if i == len(values)-1 {
-			valuesString += fmt.Sprintf("%s", values[i].GetStringValue(shard.table))
-		} else {
-			valuesString += fmt.Sprintf("%s, ", values[i].GetStringValue(shard.table))
-		}
-	}
-	query := fmt.Sprintf("INSERT INTO {table} (%s) values (%s);", columnsString, valuesString)
-	_, err := shard.Exec(query)
-	if err != nil {
-		return err
+func (shard *Shard) put(ctx context.Context, values Columns) (sql.Result, error) {
+	if err := shard.table.validate(validateInsert, values); err != nil {
+		return nil, err
 	}
-	return nil
+	return shard.execStatement(withOperation(ctx, OpPut), shard.putStatement(values).write(";"), true)
 }
-func (shard *Shard) PutOrUpdate(values Columns) error {
-	columnsString := ""
-	valuesString := ""
-	updateString := ""
-	for i := 0; i < len(values); i++ {
-		if i == len(values)-1 {
-			columnsString += fmt.Sprintf("`%s`", values[i].Name)
-		} else {
-			columnsString += fmt.Sprintf("`%s`, ", values[i].Name)
-		}
-		if i == len(values)-1 {
-			valuesString += fmt.Sprintf("%s", values[i].GetStringValue(shard.table))
-		} else {
-			valuesString += fmt.Sprintf("%s, ", values[i].GetStringValue(shard.table))
-		}
-		if i == len(values)-1 {
-			updateString += fmt.Sprintf("`%s` = %s", values[i].Name, values[i].GetStringValue(shard.table))
-		} else {
-			updateString += fmt.Sprintf("`%s` = %s, ", values[i].Name, values[i].GetStringValue(shard.table))
-		}
-	}
-	query := fmt.Sprintf("INSERT INTO {table} (%s) values (%s) ON DUPLICATE KEY UPDATE %s;", columnsString, valuesString, updateString)
-	_, err := shard.Exec(query)
-	if err != nil {
-		return err
+func (shard *Shard) putOrUpdate(ctx context.Context, values Columns) (sql.Result, error) {
+	if err := shard.table.validate(validateInsert, values); err != nil {
+		return nil, err
 	}
-	return nil
+	return shard.execStatement(withOperation(ctx, OpPut), shard.putOrUpdateStatement(values).write(";"), true)
 }
-func (shard *Shard) Set(keys Keys, values Columns) error {
-	s := ""
-	for i := 0; i < len(values); i++ {
-		if i == len(values)-1 {
-			s += fmt.Sprintf("`%s` = %s", values[i].Name, values[i].GetStringValue(shard.table))
-		} else {
-			s += fmt.Sprintf("`%s` = %s, ", values[i].Name, values[i].GetStringValue(shard.table))
-		}
-	}
-	query := fmt.Sprintf("UPDATE {table} SET %s %s;", s, keys.Query(shard.table))
-	_, err := shard.Exec(query)
-	if err != nil {
-		return err
+func (shard *Shard) set(ctx context.Context, where Condition, values Columns) (sql.Result, error) {
+	if err := shard.table.validate(validateUpdate, values); err != nil {
+		return nil, err
 	}
-	return nil
+	return shard.execStatement(withOperation(ctx, OpSet), shard.setStatement(where, values), true)
 }
-func (shard *Shard) Add(keys Keys, values Columns) error {
-	s := ""
-	for i := 0; i < len(values); i++ {
-		if i == len(values)-1 {
-			s += fmt.Sprintf("`%s` = `%s` + %s", values[i].Name, values[i].Name, value(values[i].Value))
-		} else {
-			s += fmt.Sprintf("`%s` = `%s` + %s, ", values[i].Name, values[i].Name, value(values[i].Value))
-		}
-	}
-	query := fmt.Sprintf("UPDATE {table} SET %s %s;", s, keys.Query(shard.table))
-	_, err := shard.Exec(query)
-	if err != nil {
-		return err
+func (shard *Shard) add(ctx context.Context, where Condition, values Columns) (sql.Result, error) {
+	if err := shard.table.validate(validateAdd, values); err != nil {
+		return nil, err
 	}
-	return nil
+	return shard.execStatement(withOperation(ctx, OpAdd), shard.addStatement(where, values), false)
 }
-func (shard *Shard) Remove(keys Keys) error {
-	query := fmt.Sprintf("DELETE FROM {table} %s;", keys.Query(shard.table))
-	_, err := shard.Exec(query)
-	if err != nil {
-		return err
-	}
-	return nil
+func (shard *Shard) remove(ctx context.Context, where Condition) (sql.Result, error) {
+	return shard.execStatement(withOperation(ctx, OpRemove), shard.removeStatement(where), true)
 }
 
-func (shard *Shard) AsyncGet(keys Keys, columns SelectColumns) *nonimus.Promise[bool] {
-	return nonimus.AddPromise(pool, func(resolve func(bool), reject func(error)) {
-		query := fmt.Sprintf("SELECT %s FROM {table} %s;", columns.Query(shard.table), keys.Query(shard.table))
-		var outputs []interface{}
-		var postProcesses []PostProcessScanField
-		for _, column := range columns {
-			switch shard.table.getField(column.Name).GetType() {
-			case TypeBigInt:
-				{
-					var bytes []byte
-					outputs = append(outputs, &bytes)
-					postProcesses = append(postProcesses, PostProcessScanField{TypeBigInt, &bytes, column.Output})
-					break
-				}
-			default:
-				{
-					outputs = append(outputs, column.Output)
-					break
-				}
-			}
-		}
-		rows, err := shard.Query(query)
-		if err != nil {
-			reject(err)
-			return
-		}
-		if rows.Next() {
-			err = rows.Scan(outputs...)
-			if err != nil {
-				closeErr := rows.Close()
-				if err != nil {
-					logger.Error(closeErr.Error())
-				}
-				reject(err)
-				return
-			}
-			err = rows.Close()
-			if err != nil {
-				reject(err)
-				return
-			}
-			for _, postProcess := range postProcesses {
-				switch postProcess.Type {
-				case TypeBigInt:
-					{
-						intBytesPtr, ok := (postProcess.TempOutput).(*[]byte)
-						if !ok {
-							reject(errors.New("error on postProcess, postProcess.TempOutput is not *[]byte"))
-							return
-						}
-						intPtr, ok := (postProcess.RealOutput).(**big.Int)
-						if !ok {
-							intPtr, ok := (postProcess.RealOutput).(*big.Int)
-							if !ok {
-								reject(errors.New("error on postProcess, postProcess.RealOutput is not **big.Int or *big.Int"))
-								return
-							}
-							*intPtr = *new(big.Int).SetBytes(*intBytesPtr)
-						} else {
-							*intPtr = new(big.Int).SetBytes(*intBytesPtr)
-						}
-						break
-					}
-				}
-			}
-		} else {
-			err = rows.Close()
-			if err != nil {
-				reject(err)
-				return
-			}
-			return
-		}
-		resolve(true)
-		return
+func (shard *Shard) Put(values Columns) error {
+	_, err := shard.put(context.Background(), values)
+	return err
+}
+func (shard *Shard) PutContext(ctx context.Context, values Columns) error {
+	_, err := shard.put(ctx, values)
+	return err
+}
+func (shard *Shard) PutOrUpdate(values Columns) error {
+	_, err := shard.putOrUpdate(context.Background(), values)
+	return err
+}
+func (shard *Shard) PutOrUpdateContext(ctx context.Context, values Columns) error {
+	_, err := shard.putOrUpdate(ctx, values)
+	return err
+}
+func (shard *Shard) Set(where Condition, values Columns) error {
+	_, err := shard.set(context.Background(), where, values)
+	return err
+}
+func (shard *Shard) SetContext(ctx context.Context, where Condition, values Columns) error {
+	_, err := shard.set(ctx, where, values)
+	return err
+}
+func (shard *Shard) Add(where Condition, values Columns) error {
+	_, err := shard.add(context.Background(), where, values)
+	return err
+}
+func (shard *Shard) AddContext(ctx context.Context, where Condition, values Columns) error {
+	_, err := shard.add(ctx, where, values)
+	return err
+}
+func (shard *Shard) Remove(where Condition) error {
+	_, err := shard.remove(context.Background(), where)
+	return err
+}
+func (shard *Shard) RemoveContext(ctx context.Context, where Condition) error {
+	_, err := shard.remove(ctx, where)
+	return err
+}
+
+func (shard *Shard) AsyncGet(where Condition, columns SelectColumns) *nonimus.Promise[bool] {
+	return shard.AsyncGetContext(context.Background(), where, columns)
+}
+func (shard *Shard) AsyncGetContext(ctx context.Context, where Condition, columns SelectColumns) *nonimus.Promise[bool] {
+	return async(ctx, func() (bool, error) {
+		err, found := shard.GetContext(ctx, where, columns)
+		return found, err
 	})
 }
 func (shard *Shard) AsyncPut(values Columns) *nonimus.Promise[sql.Result] {
-	return nonimus.AddPromise(pool, func(resolve func(sql.Result), reject func(error)) {
-		columnsString := ""
-		valuesString := ""
-		for i := 0; i < len(values); i++ {
-			if i == len(values)-1 {
-				columnsString += fmt.Sprintf("`%s`", values[i].Name)
-			} else {
-				columnsString += fmt.Sprintf("`%s`, ", values[i].Name)
-			}
-		}
-		for i := 0; i < len(values); i++ {
-			if i == len(values)-1 {
-				valuesString += fmt.Sprintf("%s", values[i].GetStringValue(shard.table))
-			} else {
-				valuesString += fmt.Sprintf("%s, ", values[i].GetStringValue(shard.table))
-			}
-		}
-		query := fmt.Sprintf("INSERT INTO {table} (%s) values (%s);", columnsString, valuesString)
-		result, err := shard.Exec(query)
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+	return shard.AsyncPutContext(context.Background(), values)
+}
+func (shard *Shard) AsyncPutContext(ctx context.Context, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return shard.put(ctx, values)
 	})
 }
 func (shard *Shard) AsyncPutOrUpdate(values Columns) *nonimus.Promise[sql.Result] {
-	return nonimus.AddPromise(pool, func(resolve func(sql.Result), reject func(error)) {
-		columnsString := ""
-		valuesString := ""
-		updateString := ""
-		for i := 0; i < len(values); i++ {
-			if i == len(values)-1 {
-				columnsString += fmt.Sprintf("`%s`", values[i].Name)
-			} else {
-				columnsString += fmt.Sprintf("`%s`, ", values[i].Name)
-			}
-			if i == len(values)-1 {
-				valuesString += fmt.Sprintf("%s", values[i].GetStringValue(shard.table))
-			} else {
-				valuesString += fmt.Sprintf("%s, ", values[i].GetStringValue(shard.table))
-			}
-			if i == len(values)-1 {
-				updateString += fmt.Sprintf("`%s` = %s", values[i].Name, values[i].GetStringValue(shard.table))
-			} else {
-				updateString += fmt.Sprintf("`%s` = %s, ", values[i].Name, values[i].GetStringValue(shard.table))
-			}
-		}
-		result, err := shard.Exec(fmt.Sprintf("INSERT INTO {table} (%s) values (%s) ON DUPLICATE KEY UPDATE %s;", columnsString, valuesString, updateString))
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+	return shard.AsyncPutOrUpdateContext(context.Background(), values)
+}
+func (shard *Shard) AsyncPutOrUpdateContext(ctx context.Context, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return shard.putOrUpdate(ctx, values)
 	})
 }
-func (shard *Shard) AsyncSet(keys Keys, values Columns) *nonimus.Promise[sql.Result] {
-	return nonimus.AddPromise(pool, func(resolve func(sql.Result), reject func(error)) {
-		s := ""
-		for i := 0; i < len(values); i++ {
-			if i == len(values)-1 {
-				s += fmt.Sprintf("`%s` = %s", values[i].Name, values[i].GetStringValue(shard.table))
-			} else {
-				s += fmt.Sprintf("`%s` = %s, ", values[i].Name, values[i].GetStringValue(shard.table))
-			}
-		}
-		result, err := shard.Exec(fmt.Sprintf("UPDATE {table} SET %s %s;", s, keys.Query(shard.table)))
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+func (shard *Shard) AsyncSet(where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return shard.AsyncSetContext(context.Background(), where, values)
+}
+func (shard *Shard) AsyncSetContext(ctx context.Context, where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return shard.set(ctx, where, values)
 	})
 }
-func (shard *Shard) AsyncAdd(keys Keys, values Columns) *nonimus.Promise[sql.Result] {
-	return nonimus.AddPromise(pool, func(resolve func(sql.Result), reject func(error)) {
-		s := ""
-		for i := 0; i < len(values); i++ {
-			if i == len(values)-1 {
-				s += fmt.Sprintf("`%s` = `%s` + %s", values[i].Name, values[i].Name, value(values[i].Value))
-			} else {
-				s += fmt.Sprintf("`%s` = `%s` + %s, ", values[i].Name, values[i].Name, value(values[i].Value))
-			}
-		}
-		query := fmt.Sprintf("UPDATE {table} SET %s %s;", s, keys.Query(shard.table))
-		result, err := shard.Exec(query)
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+func (shard *Shard) AsyncAdd(where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return shard.AsyncAddContext(context.Background(), where, values)
+}
+func (shard *Shard) AsyncAddContext(ctx context.Context, where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return shard.add(ctx, where, values)
 	})
 }
-func (shard *Shard) AsyncRemove(keys Keys) *nonimus.Promise[sql.Result] {
-	return nonimus.AddPromise(pool, func(resolve func(sql.Result), reject func(error)) {
-		result, err := shard.Exec(fmt.Sprintf("DELETE FROM {table} %s;", keys.Query(shard.table)))
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+func (shard *Shard) AsyncRemove(where Condition) *nonimus.Promise[sql.Result] {
+	return shard.AsyncRemoveContext(context.Background(), where)
+}
+func (shard *Shard) AsyncRemoveContext(ctx context.Context, where Condition) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return shard.remove(ctx, where)
 	})
 }
 
-func (shard *Shard) AsyncExec(query string) *nonimus.Promise[sql.Result] {
-	return nonimus.AddPromise(pool, func(resolve func(sql.Result), reject func(error)) {
-		query = strings.Replace(query, "{table}", fmt.Sprintf("`%s`", shard.table.GetName(shard.num)), 1)
-		//logger.Debug(query)
-		result, err := shard.driver.Exec(query)
-		if err != nil {
-			reject(err)
-			return
-		}
-		resolve(result)
+// execStatement executes stmt with retries, idempotent statements may be applied twice
+func (shard *Shard) execStatement(ctx context.Context, stmt *statement, idempotent bool) (sql.Result, error) {
+	var result sql.Result
+	err := shard.retry(ctx, idempotent, func() (err error) {
+		result, err = shard.execOn(withColumns(ctx, stmt), shard.driver, stmt.String(), stmt.args...)
+		return err
 	})
+	return result, err
 }
-func (shard *Shard) Exec(query string) (sql.Result, error) {
-	query = strings.Replace(query, "{table}", fmt.Sprintf("`%s`", shard.table.GetName(shard.num)), 1)
-	//logger.Debug(query)
-	return shard.driver.Exec(query)
+
+func (shard *Shard) prepareQuery(query string) string {
+	query = strings.Replace(query, "{table}", shard.table.dialect.QuoteIdentifier(shard.name), 1)
+	return shard.table.dialect.Rebind(query)
 }
-func (shard *Shard) AsyncQuery(query string) *nonimus.Promise[*sql.Rows] {
-	return nonimus.AddPromise(pool, func(resolve func(*sql.Rows), reject func(error)) {
-		query = strings.Replace(query, "{table}", fmt.Sprintf("`%s`", shard.table.GetName(shard.num)), 1)
-		//logger.Debug(query)
-		rows, err := shard.driver.Query(query)
-		if err != nil {
-			reject(err)
-			return
+
+// AsyncExec executes query with placeholders bound to args, {table} is replaced with shard table name
+func (shard *Shard) AsyncExec(query string, args ...interface{}) *nonimus.Promise[sql.Result] {
+	return shard.AsyncExecContext(context.Background(), query, args...)
+}
+func (shard *Shard) AsyncExecContext(ctx context.Context, query string, args ...interface{}) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return shard.ExecContext(ctx, query, args...)
+	})
+}
+
+// Exec executes query with placeholders bound to args, {table} is replaced with shard table name
+func (shard *Shard) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return shard.ExecContext(context.Background(), query, args...)
+}
+func (shard *Shard) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := shard.retry(ctx, false, func() (err error) {
+		result, err = shard.execOn(ctx, shard.driver, query, args...)
+		return err
+	})
+	return result, err
+}
+func (shard *Shard) AsyncQuery(query string, args ...interface{}) *nonimus.Promise[*sql.Rows] {
+	return shard.AsyncQueryContext(context.Background(), query, args...)
+}
+func (shard *Shard) AsyncQueryContext(ctx context.Context, query string, args ...interface{}) *nonimus.Promise[*sql.Rows] {
+	return async(ctx, func() (*sql.Rows, error) {
+		return shard.QueryContext(ctx, query, args...)
+	})
+}
+func (shard *Shard) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return shard.QueryContext(context.Background(), query, args...)
+}
+func (shard *Shard) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := shard.retry(ctx, false, func() (err error) {
+		rows, err = shard.queryOn(ctx, shard.driver, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// executor runs queries of a shard, *sql.DB, *sql.Tx and *sql.Conn implement it
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (shard *Shard) execOn(ctx context.Context, ex executor, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	_, err := shard.execute(ctx, ex, QueryExec, query, args, false, func(ctx context.Context, event *QueryEvent) (err error) {
+		result, err = ex.ExecContext(ctx, event.Query, event.Args...)
+		if err == nil {
+			if affected, err := result.RowsAffected(); err == nil {
+				event.RowsAffected = affected
+			}
 		}
-		resolve(rows)
+		return err
 	})
+	return result, err
+}
+func (shard *Shard) queryOn(ctx context.Context, ex executor, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, _, err := shard.query(ctx, ex, false, query, args...)
+	return rows, err
 }
-func (shard *Shard) Query(query string) (*sql.Rows, error) {
-	query = strings.Replace(query, "{table}", fmt.Sprintf("`%s`", shard.table.GetName(shard.num)), 1)
-	//logger.Debug(query)
-	return shard.driver.Query(query)
+
+// queryCall is queryOn for rows read by eplidr, their count is reported by call.rows
+func (shard *Shard) queryCall(ctx context.Context, ex executor, query string, args ...interface{}) (*sql.Rows, *queryCall, error) {
+	return shard.query(ctx, ex, true, query, args...)
+}
+func (shard *Shard) query(ctx context.Context, ex executor, read bool, query string, args ...interface{}) (*sql.Rows, *queryCall, error) {
+	var rows *sql.Rows
+	call, err := shard.execute(ctx, ex, QueryRows, query, args, read, func(ctx context.Context, event *QueryEvent) (err error) {
+		rows, err = ex.QueryContext(ctx, event.Query, event.Args...)
+		return err
+	})
+	return rows, call, err
+}
+
+// Name returns name of the shard table
+func (shard *Shard) Name() string {
+	return shard.name
 }
 
 func (shard *Shard) ReleaseRows(rows *sql.Rows) error {
@@ -847,11 +863,27 @@ func (shard *Shard) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx,
 	return shard.driver.BeginTx(ctx, opts)
 }
 
-func (shard *Shard) SingleSet(keys Keys, column Column) error {
-	return shard.Set(keys, Columns{column})
+// Begin starts a transaction on the shard, ctx is used by all statements of the transaction
+func (shard *Shard) Begin(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	if err := shard.allow(); err != nil {
+		return nil, err
+	}
+	raw, err := shard.driver.BeginTx(ctx, opts)
+	shard.record(err)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{ctx: ctx, ex: raw, shard: shard, raw: raw, invalidations: new([]func()), mirrors: new([]txMirror)}, nil
+}
+
+func (shard *Shard) SingleSet(where Condition, column Column) error {
+	return shard.Set(where, Columns{column})
+}
+func (shard *Shard) SingleSetContext(ctx context.Context, where Condition, column Column) error {
+	return shard.SetContext(ctx, where, Columns{column})
 }
 
 func (shard *Shard) Drop() error {
-	_, err := shard.driver.Exec(fmt.Sprintf("DROP TABLE %s;", shard.table.GetName(shard.num)))
+	_, err := shard.execOn(context.Background(), shard.driver, "DROP TABLE {table};")
 	return err
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"github.com/oppositemc/nonimus"
+	"strings"
 )
 
 type SingleKeyTable struct {
@@ -11,21 +12,22 @@ type SingleKeyTable struct {
 	key   string
 }
 
-func NewSingleKeyTable(name string, key string, shardsCount uint, fields TableFields, drivers Drivers) (*SingleKeyTable, error) {
+func NewSingleKeyTable(name string, key string, shardsCount uint, fields TableFields, drivers Drivers, options ...TableOption) (*SingleKeyTable, error) {
 	// params:
 	// [0] dataSource
 	// [1]
-	table, err := NewTable(name, shardsCount, fields, drivers)
+	table, err := NewTable(name, shardsCount, fields, drivers, options...)
 	if err != nil {
 		return nil, err
 	}
-	return &SingleKeyTable{
-		Table: table,
-		key:   key,
-	}, nil
+	return SingleKeyImplementation(table, key), nil
 }
 
 func SingleKeyImplementation(keyTable *Table, key string) *SingleKeyTable {
+	// rows of a cached table are identified by the key even if it is not declared as primary key
+	if keyTable.cache != nil && len(keyTable.primaryKeys()) == 0 {
+		keyTable.cache.keys = []string{key}
+	}
 	return &SingleKeyTable{
 		Table: keyTable,
 		key:   key,
@@ -35,75 +37,180 @@ func SingleKeyImplementation(keyTable *Table, key string) *SingleKeyTable {
 func (table *SingleKeyTable) GetString(key interface{}, column string) (string, bool, error) {
 	return table.Table.GetString(Key{Name: table.key, Value: key}, column)
 }
+func (table *SingleKeyTable) GetStringContext(ctx context.Context, key interface{}, column string) (string, bool, error) {
+	return table.Table.GetStringContext(ctx, Key{Name: table.key, Value: key}, column)
+}
 func (table *SingleKeyTable) GetInt(key interface{}, column string) (int, bool, error) {
 	return table.Table.GetInt(Key{Name: table.key, Value: key}, column)
 }
+func (table *SingleKeyTable) GetIntContext(ctx context.Context, key interface{}, column string) (int, bool, error) {
+	return table.Table.GetIntContext(ctx, Key{Name: table.key, Value: key}, column)
+}
 func (table *SingleKeyTable) GetInt64(key interface{}, column string) (int64, bool, error) {
 	return table.Table.GetInt64(Key{Name: table.key, Value: key}, column)
 }
+func (table *SingleKeyTable) GetInt64Context(ctx context.Context, key interface{}, column string) (int64, bool, error) {
+	return table.Table.GetInt64Context(ctx, Key{Name: table.key, Value: key}, column)
+}
 func (table *SingleKeyTable) GetFloat(key interface{}, column string) (float64, bool, error) {
 	return table.Table.GetFloat(Key{Name: table.key, Value: key}, column)
 }
+func (table *SingleKeyTable) GetFloatContext(ctx context.Context, key interface{}, column string) (float64, bool, error) {
+	return table.Table.GetFloatContext(ctx, Key{Name: table.key, Value: key}, column)
+}
 func (table *SingleKeyTable) GetUint(key interface{}, column string) (uint64, bool, error) {
 	return table.Table.GetUint(Key{Name: table.key, Value: key}, column)
 }
+func (table *SingleKeyTable) GetUintContext(ctx context.Context, key interface{}, column string) (uint64, bool, error) {
+	return table.Table.GetUintContext(ctx, Key{Name: table.key, Value: key}, column)
+}
 func (table *SingleKeyTable) GetBoolean(key interface{}, column string) (bool, bool, error) {
 	return table.Table.GetBoolean(Key{Name: table.key, Value: key}, column)
 }
+func (table *SingleKeyTable) GetBooleanContext(ctx context.Context, key interface{}, column string) (bool, bool, error) {
+	return table.Table.GetBooleanContext(ctx, Key{Name: table.key, Value: key}, column)
+}
 
 func (table *SingleKeyTable) Get(key interface{}, columns SelectColumns) (error, bool) {
 	return table.Table.Get(key, Keys{{table.key, key}}, columns)
 }
+func (table *SingleKeyTable) GetContext(ctx context.Context, key interface{}, columns SelectColumns) (error, bool) {
+	return table.Table.GetContext(ctx, key, Keys{{table.key, key}}, columns)
+}
 func (table *SingleKeyTable) Set(key interface{}, columns Columns) error {
 	return table.Table.Set(key, Keys{{table.key, key}}, columns)
 }
+func (table *SingleKeyTable) SetContext(ctx context.Context, key interface{}, columns Columns) error {
+	return table.Table.SetContext(ctx, key, Keys{{table.key, key}}, columns)
+}
 func (table *SingleKeyTable) Add(key interface{}, columns Columns) error {
 	return table.Table.Add(key, Keys{{table.key, key}}, columns)
 }
+func (table *SingleKeyTable) AddContext(ctx context.Context, key interface{}, columns Columns) error {
+	return table.Table.AddContext(ctx, key, Keys{{table.key, key}}, columns)
+}
 func (table *SingleKeyTable) SingleSet(key interface{}, column Column) error {
 	return table.Table.Set(key, Keys{{table.key, key}}, Columns{column})
 }
+func (table *SingleKeyTable) SingleSetContext(ctx context.Context, key interface{}, column Column) error {
+	return table.Table.SetContext(ctx, key, Keys{{table.key, key}}, Columns{column})
+}
 func (table *SingleKeyTable) Put(key interface{}, columns Columns) error {
 	return table.Table.Put(key, columns)
 }
+func (table *SingleKeyTable) PutContext(ctx context.Context, key interface{}, columns Columns) error {
+	return table.Table.PutContext(ctx, key, columns)
+}
+func (table *SingleKeyTable) PutOrUpdate(key interface{}, columns Columns) error {
+	return table.Table.PutOrUpdate(key, columns)
+}
+func (table *SingleKeyTable) PutOrUpdateContext(ctx context.Context, key interface{}, columns Columns) error {
+	return table.Table.PutOrUpdateContext(ctx, key, columns)
+}
+
+// PutMany inserts rows routed by their key column, see Table.PutMany
+func (table *SingleKeyTable) PutMany(rows []Columns, options ...BulkOptions) (*BulkResult, error) {
+	return table.Table.PutMany(table.rows(rows), options...)
+}
+func (table *SingleKeyTable) PutManyContext(ctx context.Context, rows []Columns, options ...BulkOptions) (*BulkResult, error) {
+	return table.Table.PutManyContext(ctx, table.rows(rows), options...)
+}
+func (table *SingleKeyTable) PutOrUpdateMany(rows []Columns, options ...BulkOptions) (*BulkResult, error) {
+	return table.Table.PutOrUpdateMany(table.rows(rows), options...)
+}
+func (table *SingleKeyTable) PutOrUpdateManyContext(ctx context.Context, rows []Columns, options ...BulkOptions) (*BulkResult, error) {
+	return table.Table.PutOrUpdateManyContext(ctx, table.rows(rows), options...)
+}
+func (table *SingleKeyTable) rows(rows []Columns) []Row {
+	result := make([]Row, len(rows))
+	for i, values := range rows {
+		result[i].Values = values
+		for _, value := range values {
+			if strings.EqualFold(value.Name, table.key) {
+				result[i].ShardKey = value.Value
+			}
+		}
+	}
+	return result
+}
 func (table *SingleKeyTable) Remove(key interface{}) error {
-	return table.Table.Remove(table.key, Keys{{table.key, key}})
+	return table.Table.Remove(key, Keys{{table.key, key}})
+}
+func (table *SingleKeyTable) RemoveContext(ctx context.Context, key interface{}) error {
+	return table.Table.RemoveContext(ctx, key, Keys{{table.key, key}})
 }
 func (table *SingleKeyTable) AsyncGet(key interface{}, columns SelectColumns) *nonimus.Promise[bool] {
 	return table.Table.AsyncGet(key, Keys{{table.key, key}}, columns)
 }
+func (table *SingleKeyTable) AsyncGetContext(ctx context.Context, key interface{}, columns SelectColumns) *nonimus.Promise[bool] {
+	return table.Table.AsyncGetContext(ctx, key, Keys{{table.key, key}}, columns)
+}
 func (table *SingleKeyTable) AsyncSet(key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
 	return table.Table.AsyncSet(key, Keys{{table.key, key}}, columns)
 }
+func (table *SingleKeyTable) AsyncSetContext(ctx context.Context, key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncSetContext(ctx, key, Keys{{table.key, key}}, columns)
+}
 func (table *SingleKeyTable) AsyncAdd(key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
 	return table.Table.AsyncAdd(key, Keys{{table.key, key}}, columns)
 }
+func (table *SingleKeyTable) AsyncAddContext(ctx context.Context, key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncAddContext(ctx, key, Keys{{table.key, key}}, columns)
+}
 func (table *SingleKeyTable) AsyncSingleSet(key interface{}, column Column) *nonimus.Promise[sql.Result] {
 	return table.Table.AsyncSet(key, Keys{{table.key, key}}, Columns{column})
 }
+func (table *SingleKeyTable) AsyncSingleSetContext(ctx context.Context, key interface{}, column Column) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncSetContext(ctx, key, Keys{{table.key, key}}, Columns{column})
+}
 func (table *SingleKeyTable) AsyncPut(key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
 	return table.Table.AsyncPut(key, columns)
 }
+func (table *SingleKeyTable) AsyncPutContext(ctx context.Context, key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncPutContext(ctx, key, columns)
+}
+func (table *SingleKeyTable) AsyncPutOrUpdate(key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncPutOrUpdate(key, columns)
+}
+func (table *SingleKeyTable) AsyncPutOrUpdateContext(ctx context.Context, key interface{}, columns Columns) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncPutOrUpdateContext(ctx, key, columns)
+}
 func (table *SingleKeyTable) AsyncRemove(key interface{}) *nonimus.Promise[sql.Result] {
-	return table.Table.AsyncRemove(table.key, Keys{{table.key, key}})
+	return table.Table.AsyncRemove(key, Keys{{table.key, key}})
+}
+func (table *SingleKeyTable) AsyncRemoveContext(ctx context.Context, key interface{}) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncRemoveContext(ctx, key, Keys{{table.key, key}})
 }
 
 func (table *SingleKeyTable) ReleaseRows(rows *sql.Rows) error {
 	return rows.Close()
 }
 
-func (table *SingleKeyTable) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
-	return nil, nil
+// BeginTx starts a transaction on the shard of key
+func (table *SingleKeyTable) BeginTx(ctx context.Context, key interface{}, opts *sql.TxOptions) (*Tx, error) {
+	return table.Table.Begin(ctx, key, opts)
+}
+func (table *SingleKeyTable) InTx(ctx context.Context, key interface{}, fn func(tx *Tx) error) error {
+	return table.Table.InTx(ctx, key, fn)
 }
 
-func (table *SingleKeyTable) Exec(query string, key interface{}) (sql.Result, error) {
-	return table.Table.Exec(query, key)
+func (table *SingleKeyTable) Exec(query string, key interface{}, args ...interface{}) (sql.Result, error) {
+	return table.Table.Exec(query, key, args...)
+}
+func (table *SingleKeyTable) ExecContext(ctx context.Context, query string, key interface{}, args ...interface{}) (sql.Result, error) {
+	return table.Table.ExecContext(ctx, query, key, args...)
+}
+func (table *SingleKeyTable) AsyncExec(query string, key interface{}, args ...interface{}) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncExec(query, key, args...)
+}
+func (table *SingleKeyTable) AsyncExecContext(ctx context.Context, query string, key interface{}, args ...interface{}) *nonimus.Promise[sql.Result] {
+	return table.Table.AsyncExecContext(ctx, query, key, args...)
 }
-func (table *SingleKeyTable) AsyncExec(query string, key interface{}) *nonimus.Promise[sql.Result] {
-	return table.Table.AsyncExec(query, key)
+func (table *SingleKeyTable) Query(query string, key interface{}, args ...interface{}) (*sql.Rows, error) {
+	return table.Table.Query(query, key, args...)
 }
-func (table *SingleKeyTable) Query(query string, key interface{}) (*sql.Rows, error) {
-	return table.Table.Query(query, key)
+func (table *SingleKeyTable) QueryContext(ctx context.Context, query string, key interface{}, args ...interface{}) (*sql.Rows, error) {
+	return table.Table.QueryContext(ctx, query, key, args...)
 }
 
 /*
@@ -0,0 +1,249 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// SQLite dialect, UUID is stored as text and binary types as blob.
+// SQLite can not change type, nullability or primary key of an existing column,
+// such migrations are reported with a warning and skipped.
+var SQLite Dialect = SQLiteDialect{}
+
+type SQLiteDialect struct{}
+
+func (d SQLiteDialect) Name() string {
+	return "sqlite"
+}
+
+func (d SQLiteDialect) QuoteIdentifier(name string) string {
+	return quoteWith(`"`, name)
+}
+
+func (d SQLiteDialect) QuoteString(s string) string {
+	return quoteWith("'", s)
+}
+
+// BinaryCollation is true, BINARY is the default collation
+func (d SQLiteDialect) BinaryCollation() bool {
+	return true
+}
+
+func (d SQLiteDialect) QuoteBytes(b []byte) string {
+	return "X'" + hex.EncodeToString(b) + "'"
+}
+
+func (d SQLiteDialect) Rebind(query string) string {
+	return query
+}
+
+func (d SQLiteDialect) ColumnType(t Type) string {
+	if t == TypeUUID {
+		return "TEXT"
+	}
+	switch t.GetBasicType() {
+	case BasicTypeUint64, BasicTypeInt64, BasicTypeInt32, BasicTypeUint32, BasicTypeBool:
+		return "INTEGER"
+	case BasicTypeFloat:
+		return "REAL"
+	case BasicTypeBinary, BasicTypeVarByte:
+		return "BLOB"
+	case BasicTypeVarChar:
+		if sized, ok := sizedType(t); ok {
+			return fmt.Sprintf("VARCHAR(%d)", sized.Size)
+		}
+		return "TEXT"
+	}
+	return ""
+}
+
+func (d SQLiteDialect) SameType(t Type, described string) bool {
+	return strings.EqualFold(d.ColumnType(t), described)
+}
+
+func (d SQLiteDialect) EncodeValue(t Type, v interface{}) (string, interface{}) {
+	if t == TypeUUID {
+		return "?", uuidArg(v)
+	}
+	switch t.GetBasicType() {
+	case BasicTypeVarByte, BasicTypeBinary:
+		return "?", bytesArg(v)
+	}
+	return "?", normalizeArg(v)
+}
+
+func (d SQLiteDialect) DecodeColumn(t Type, column string) string {
+	return column
+}
+
+// UUIDSortKey returns id bytes, UUID is stored as lower case text that sorts like them
+func (d SQLiteDialect) UUIDSortKey(id uuid.UUID) []byte {
+	return id[:]
+}
+
+func (d SQLiteDialect) Upsert(keys []string, columns []string) string {
+	return upsertOnConflict(d, keys, columns)
+}
+
+func (d SQLiteDialect) TableExists(table string) (string, []interface{}) {
+	return "SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?;", []interface{}{table}
+}
+
+func (d SQLiteDialect) DescribeTable(db *sql.DB, table string) (*TableDescription, error) {
+	description := &TableDescription{
+		Columns: make(map[FieldName]ColumnDescription),
+		Indexes: make(map[string][]string),
+	}
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", d.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, err
+	}
+	var primaryKey []indexColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var column ColumnDescription
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &column.Default, &pk)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column.Name = name
+		column.Type = strings.ToLower(columnType)
+		column.Nullable = notNull == 0
+		if pk != 0 {
+			primaryKey = append(primaryKey, indexColumn{seq: pk, name: name})
+		}
+		description.Columns[FieldName(strings.ToLower(name))] = column
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	description.PrimaryKey = sortIndexColumns(primaryKey)
+
+	rows, err = db.Query(fmt.Sprintf("PRAGMA index_list(%s);", d.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, err
+	}
+	var indexes []string
+	for rows.Next() {
+		var seq, unique, partial int
+		var name, origin string
+		err = rows.Scan(&seq, &name, &unique, &origin, &partial)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// Skip indexes created by PRIMARY KEY and UNIQUE constraints
+		if origin == "c" {
+			indexes = append(indexes, name)
+		}
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		rows, err = db.Query(fmt.Sprintf("PRAGMA index_info(%s);", d.QuoteIdentifier(index)))
+		if err != nil {
+			return nil, err
+		}
+		var columns []indexColumn
+		for rows.Next() {
+			var column indexColumn
+			var cid int
+			err = rows.Scan(&column.seq, &cid, &column.name)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			columns = append(columns, column)
+		}
+		err = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		description.Indexes[index] = sortIndexColumns(columns)
+	}
+	return description, nil
+}
+
+// IndexName is prefixed with table, index names are unique per database
+func (d SQLiteDialect) IndexName(table string, column string) string {
+	return table + "_I" + column
+}
+
+func (d SQLiteDialect) DropIndex(table string, index string) string {
+	return fmt.Sprintf("DROP INDEX %s", d.QuoteIdentifier(index))
+}
+
+func (d SQLiteDialect) ModifyColumn(table string, field DefaultTableField) []string {
+	logger.Warn("sqlite: can not modify column ", field.Name, " of ", table, ", skipped")
+	return nil
+}
+
+func (d SQLiteDialect) AlterPrimaryKey(table string, description *TableDescription, name string, keys []string) []string {
+	logger.Warn("sqlite: can not change primary key of ", table, ", skipped")
+	return nil
+}
+
+func (d SQLiteDialect) Limit(limit int, offset int) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0:
+		// OFFSET requires LIMIT, negative LIMIT means no limit
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+	return ""
+}
+
+// ForUpdate is empty, SQLite has no row locks, a writing transaction locks the whole database
+func (d SQLiteDialect) ForUpdate() string {
+	return ""
+}
+
+func (d SQLiteDialect) RenameTables(renames []TableRename) []string {
+	return renameEach(d, renames)
+}
+
+// ReplicaLag is 0, SQLite has no replication
+func (d SQLiteDialect) ReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	return 0, nil
+}
+
+// sqliteErrorCodes are extended result codes of SQLite, primary codes are matched by the lowest byte
+var sqliteErrorCodes = map[int]ErrorCode{
+	1555: CodeDuplicateKey, // SQLITE_CONSTRAINT_PRIMARYKEY
+	2067: CodeDuplicateKey, // SQLITE_CONSTRAINT_UNIQUE
+	5:    CodeLockTimeout,  // SQLITE_BUSY
+	6:    CodeLockTimeout,  // SQLITE_LOCKED
+}
+
+// ErrorCode classifies errors by their result code, modernc.org/sqlite errors provide it. A missing
+// column has no code of its own, it is recognized by the message.
+func (d SQLiteDialect) ErrorCode(err error) ErrorCode {
+	var coded interface{ Code() int }
+	if !errors.As(err, &coded) {
+		return CodeUnknown
+	}
+	if code, ok := sqliteErrorCodes[coded.Code()]; ok {
+		return code
+	}
+	if code, ok := sqliteErrorCodes[coded.Code()&0xff]; ok {
+		return code
+	}
+	if strings.Contains(err.Error(), "no such column") {
+		return CodeUnknownColumn
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,134 @@
+package eplidr
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"strings"
+)
+
+// statement is a SQL text with `?` placeholders and the args bound to them.
+// Values are only ever appended to args, they never reach the SQL text.
+type statement struct {
+	dialect Dialect
+	text    strings.Builder
+	args    []interface{}
+	// columns are the columns of args, empty for an arg that is not a column value
+	columns []string
+}
+
+func newStatement(dialect Dialect, parts ...string) *statement {
+	stmt := &statement{dialect: dialect}
+	return stmt.write(parts...)
+}
+
+func (stmt *statement) write(parts ...string) *statement {
+	for _, part := range parts {
+		stmt.text.WriteString(part)
+	}
+	return stmt
+}
+
+// ident writes a quoted identifier
+func (stmt *statement) ident(name string) *statement {
+	stmt.text.WriteString(stmt.dialect.QuoteIdentifier(name))
+	return stmt
+}
+
+// arg writes a bare placeholder for v
+func (stmt *statement) arg(v interface{}) *statement {
+	return stmt.columnArg("", v)
+}
+
+// columnArg writes a bare placeholder for v that is a value of the column name
+func (stmt *statement) columnArg(name string, v interface{}) *statement {
+	stmt.text.WriteString("?")
+	stmt.args = append(stmt.args, normalizeArg(v))
+	stmt.columns = append(stmt.columns, name)
+	return stmt
+}
+
+// bind writes a placeholder for v encoded according to the type of the column name
+func (stmt *statement) bind(table *Table, name string, v interface{}) *statement {
+	placeholder, arg := encodeValue(table, name, v)
+	stmt.text.WriteString(placeholder)
+	stmt.args = append(stmt.args, arg)
+	stmt.columns = append(stmt.columns, name)
+	return stmt
+}
+
+func (stmt *statement) String() string {
+	return stmt.text.String()
+}
+
+// encodeValue returns the placeholder expression and the arg for a value of the column name
+func encodeValue(table *Table, name string, v interface{}) (string, interface{}) {
+	if v == nil {
+		// NULL is not encoded
+		return "?", nil
+	}
+	field := table.getField(name)
+	if field == nil {
+		logger.Debug("unknown field ", name, " in table ", table.name)
+		return "?", normalizeArg(v)
+	}
+	return table.dialect.EncodeValue(field.GetType(), v)
+}
+
+func normalizeArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}: // Serialize s
+		return v[0]
+	case big.Int:
+		return v.String()
+	case *big.Int:
+		return v.String()
+	case uuid.UUID:
+		return v.String()
+	case *uuid.UUID:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func uuidArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		// stored text of SQLite sorts like the bytes only in the canonical lower case form
+		if id, err := uuid.Parse(v); err == nil {
+			return id.String()
+		}
+		return v
+	case []byte:
+		// binary column value as read from the database
+		if id, err := uuid.FromBytes(v); err == nil {
+			return id.String()
+		}
+		return string(v)
+	case uuid.UUID:
+		return v.String()
+	case *uuid.UUID:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func hexArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return hex.EncodeToString(v)
+	case big.Int:
+		return hex.EncodeToString(v.Bytes())
+	case *big.Int:
+		return hex.EncodeToString(v.Bytes())
+	case uuid.UUID:
+		return hex.EncodeToString(v[:])
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
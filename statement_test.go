@@ -0,0 +1,73 @@
+package eplidr
+
+import (
+	"context"
+	"testing"
+)
+
+// TestQuotedValues writes and matches values that would break or inject into interpolated SQL
+func TestQuotedValues(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields)
+	shard := table.GetShard(0)
+	injection := `x'); DELETE --`
+	values := []string{injection, `it's`, `\'`, `"name"`}
+	for i, value := range values {
+		err := shard.Put(Columns{{"id", int64(i)}, {"name", value}, {"status", int64(0)}, {"data", []byte(value)}})
+		if err != nil {
+			t.Fatalf("put %q: %v", value, err)
+		}
+	}
+	if err := shard.PutOrUpdate(Columns{{"id", int64(0)}, {"name", injection}, {"status", int64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := shard.Set(Keys{{"name", `it's`}}, Columns{{"status", int64(2)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := shard.Add(Keys{{"data", []byte(`\'`)}}, Columns{{"status", int64(3)}}); err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range values {
+		var name string
+		var status int64
+		err, found := shard.Get(Keys{{"name", value}}, SelectColumns{{"name", &name}, {"status", &status}})
+		if err != nil || !found || name != value || status != int64(i+1)%4 {
+			t.Errorf("row %d of %q: %q %d %v %v", i, value, name, status, found, err)
+		}
+	}
+
+	err := table.InTx(context.Background(), int64(0), func(tx *Tx) error {
+		if err := tx.Set(Keys{{"name", injection}}, Columns{{"name", `o'k`}}); err != nil {
+			return err
+		}
+		name, found, err := tx.GetString(Key{Name: "id", Value: int64(0)}, "name")
+		if err != nil || !found || name != `o'k` {
+			t.Errorf("name in transaction %q %v %v", name, found, err)
+		}
+		return tx.Remove(Keys{{"name", `"name"`}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := shard.GradualSelect(Or(Keys{{"name", `o'k`}}, Keys{{"data", []byte(`it's`)}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Close()
+	count := 0
+	for {
+		next, err := result.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !next {
+			break
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("selected %d rows of quoted values, want 2", count)
+	}
+	if err = shard.Remove(Keys{{"name", `it's`}}); err != nil {
+		t.Fatal(err)
+	}
+}
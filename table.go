@@ -1,16 +1,26 @@
 package eplidr
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/oppositemc/nonimus"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Table struct {
 	name string
 
+	// mx guards Shards, shardsCount, router and reshard, they are swapped on resharding cutover
+	mx sync.RWMutex
+	// txMx is held by transactions of the table until they end, exclusively with mx by resharding.
+	// draining is set while it is taken, transactions beginning meanwhile fail with ErrReshardCutover
+	txMx     sync.RWMutex
+	draining atomic.Bool
+
 	shardsCount uint
 	Shards      []*Shard
 
@@ -18,12 +28,26 @@ type Table struct {
 	fields    TableFields
 	fieldsMap map[FieldName]TableField
 
-	hashFunc func(interface{}) uint
+	router  ShardRouter
+	dialect Dialect
+	retry   RetryPolicy
+	hooks   []Hook
+	cache   *rowCache
+	// dropColumns lets migrations drop columns missing from fields
+	dropColumns bool
+
+	health      HealthOptions
+	replication ReplicaOptions
+	// backgroundCtx is done when stopHealth is called
+	backgroundCtx context.Context
+	stopHealth    context.CancelFunc
+
+	reshard *Resharder
 }
 
 type Drivers interface{}
 
-func NewTable(name string, shardsCount uint, fields TableFields, driverParam Drivers) (*Table, error) {
+func NewTable(name string, shardsCount uint, fields TableFields, driverParam Drivers, options ...TableOption) (*Table, error) {
 	var table *Table
 	switch dataSource := driverParam.(type) {
 	case []*sql.DB:
@@ -31,7 +55,8 @@ func NewTable(name string, shardsCount uint, fields TableFields, driverParam Dri
 			name:        name,
 			fields:      fields,
 			shardsCount: shardsCount,
-			hashFunc:    StandardGetShardFunc,
+			router:      ModuloRouter{Hash: StandardGetShardFunc},
+			dialect:     MySQL,
 		}
 		shards := make([]*Shard, len(dataSource))
 		for i := 0; i < len(dataSource); i++ {
@@ -39,6 +64,7 @@ func NewTable(name string, shardsCount uint, fields TableFields, driverParam Dri
 				table:  table,
 				driver: dataSource[i],
 				num:    uint(i),
+				name:   table.GetName(uint(i)),
 			}
 		}
 		table.Shards = shards
@@ -51,7 +77,8 @@ func NewTable(name string, shardsCount uint, fields TableFields, driverParam Dri
 			name:        name,
 			fields:      fields,
 			shardsCount: shardsCount,
-			hashFunc:    StandardGetShardFunc,
+			router:      ModuloRouter{Hash: StandardGetShardFunc},
+			dialect:     MySQL,
 		}
 		shards := make([]*Shard, len(drivers))
 		for i := 0; i < len(drivers); i++ {
@@ -59,9 +86,22 @@ func NewTable(name string, shardsCount uint, fields TableFields, driverParam Dri
 				table:  table,
 				driver: drivers[i],
 				num:    uint(i),
+				name:   table.GetName(uint(i)),
 			}
 		}
 		table.Shards = shards
+	case ShardDrivers:
+		drivers := make([]ShardDrivers, shardsCount)
+		for i := 0; i < int(shardsCount); i++ {
+			drivers[i] = dataSource
+		}
+		table = newReplicatedTable(name, shardsCount, fields, drivers)
+	case []ShardDrivers:
+		table = newReplicatedTable(name, shardsCount, fields, dataSource)
+	}
+	table.replication = DefaultReplicaOptions
+	for _, option := range options {
+		option(table)
 	}
 	table.fields = fields
 	fieldsMap := make(map[FieldName]TableField)
@@ -69,7 +109,42 @@ func NewTable(name string, shardsCount uint, fields TableFields, driverParam Dri
 		fieldsMap[FieldName(strings.ToLower(field.GetName()))] = field
 	}
 	table.fieldsMap = fieldsMap
-	return table, table.Init()
+	err := validateRouter(table.router, table.shardsCount)
+	if err != nil {
+		return nil, err
+	}
+	attachRouter(table.router)
+	err = table.Init()
+	if err != nil {
+		return table, err
+	}
+	table.startHealthCheck()
+	table.startReplicaCheck()
+	return table, nil
+}
+
+func newReplicatedTable(name string, shardsCount uint, fields TableFields, drivers []ShardDrivers) *Table {
+	table := &Table{
+		name:        name,
+		fields:      fields,
+		shardsCount: shardsCount,
+		router:      ModuloRouter{Hash: StandardGetShardFunc},
+		dialect:     MySQL,
+	}
+	shards := make([]*Shard, len(drivers))
+	for i := 0; i < len(drivers); i++ {
+		shards[i] = &Shard{
+			table:  table,
+			driver: drivers[i].Primary,
+			num:    uint(i),
+			name:   table.GetName(uint(i)),
+		}
+		for _, db := range drivers[i].Replicas {
+			shards[i].replicas = append(shards[i].replicas, &replica{db: db})
+		}
+	}
+	table.Shards = shards
+	return table
 }
 
 func (table *Table) GetName(shard uint) string {
@@ -78,6 +153,47 @@ func (table *Table) GetName(shard uint) string {
 func (table *Table) getField(name string) TableField {
 	return table.fieldsMap[FieldName(strings.ToLower(name))]
 }
+
+// isSensitive reports whether values of the column name are sensitive
+func (table *Table) isSensitive(name string) bool {
+	field, ok := table.getField(name).(SensitiveField)
+	return ok && field.IsSensitive()
+}
+func (table *Table) hasSensitiveFields() bool {
+	for _, field := range table.fields {
+		if field, ok := field.(SensitiveField); ok && field.IsSensitive() {
+			return true
+		}
+	}
+	return false
+}
+
+// primaryKeys returns columns of primary key declared in fields
+func (table *Table) primaryKeys() []string {
+	var result []string
+	for _, field := range table.fields {
+		switch field := field.(type) {
+		case DefaultTableField:
+			if field.PrimaryKey {
+				result = append(result, field.Name)
+			}
+		case SConstraintPrimaryKey:
+			result = append(result, field.Keys...)
+		}
+	}
+	return result
+}
+
+// getColumnNames returns names of fields that are columns, constraints are skipped
+func (table *Table) getColumnNames() []string {
+	var result []string
+	for _, field := range table.fields {
+		if field.GetType().GetBasicType() != BasicTypeNone {
+			result = append(result, field.GetName())
+		}
+	}
+	return result
+}
 func (table *Table) getFieldNames() []string {
 	var result []string
 	for _, field := range table.fields {
@@ -86,178 +202,390 @@ func (table *Table) getFieldNames() []string {
 	return result
 }
 func (table *Table) GetShardNum(key interface{}) uint {
-	return table.hashFunc(key) % table.shardsCount
+	table.mx.RLock()
+	defer table.mx.RUnlock()
+	return table.router.Route(key, table.shardsCount)
 }
 func (table *Table) GetShard(num uint) *Shard {
+	table.mx.RLock()
+	defer table.mx.RUnlock()
 	return table.Shards[num]
 }
 
+// shard returns the shard of shardKey
+func (table *Table) shard(shardKey interface{}) *Shard {
+	table.mx.RLock()
+	defer table.mx.RUnlock()
+	return table.Shards[table.router.Route(shardKey, table.shardsCount)]
+}
+
+// write runs exec on the shard of shardKey and mirrors the change to the resharding target by the function
+// mirror returns, it is called before exec. Shards can not be swapped by resharding cutover until it returns.
+func (table *Table) write(shardKey interface{}, exec func(shard *Shard) (sql.Result, error), mirror func(reshard *Resharder, source *Shard) (func() error, error)) (sql.Result, error) {
+	table.mx.RLock()
+	defer table.mx.RUnlock()
+	source := table.Shards[table.router.Route(shardKey, table.shardsCount)]
+	reshard := table.reshard
+	if reshard == nil {
+		return exec(source)
+	}
+	if !reshard.leased() {
+		return nil, ErrReshardFenced
+	}
+	reshard.copyMx.RLock()
+	defer reshard.copyMx.RUnlock()
+	apply, err := mirror(reshard, source)
+	if err != nil {
+		return nil, err
+	}
+	result, err := exec(source)
+	if err != nil {
+		return result, err
+	}
+	err = apply()
+	if err != nil {
+		reshard.mirrorFailed(err)
+	}
+	return result, nil
+}
+
+// txDrainInterval is the interval lockWrites checks whether the open transactions ended
+const txDrainInterval = 10 * time.Millisecond
+
+// lockWrites blocks writes and transactions of the table once the open transactions end and returns the
+// function unblocking them. A waiting lock would block transactions that begin another one, so txMx is
+// polled instead and new transactions fail until the table is unblocked.
+func (table *Table) lockWrites() func() {
+	table.draining.Store(true)
+	for !table.txMx.TryLock() {
+		time.Sleep(txDrainInterval)
+	}
+	table.mx.Lock()
+	return func() {
+		table.mx.Unlock()
+		table.txMx.Unlock()
+		table.draining.Store(false)
+	}
+}
+
+// beginTx holds txMx until release is called and returns the attached Resharder the writes of the
+// transaction are mirrored to
+func (table *Table) beginTx() (reshard *Resharder, release func(), err error) {
+	if table.draining.Load() {
+		return nil, nil, ErrReshardCutover
+	}
+	table.txMx.RLock()
+	table.mx.RLock()
+	reshard = table.reshard
+	table.mx.RUnlock()
+	if reshard != nil && !reshard.leased() {
+		table.txMx.RUnlock()
+		return nil, nil, ErrReshardFenced
+	}
+	var once sync.Once
+	return reshard, func() {
+		once.Do(table.txMx.RUnlock)
+	}, nil
+}
+
+// Init creates missing shard tables and migrates existing ones to the declared TableFields
 func (table *Table) Init() error {
 	for shardId := 0; shardId < len(table.Shards); shardId++ {
-		fieldsString := ""
-		var postSQLs []string
-		for _, field := range table.fields {
-			fieldsString += field.QueryInit(table.GetName(uint(shardId))) + ", "
-			queryAfter := field.QueryAfter(table.GetName(uint(shardId)))
-			if queryAfter != "" {
-				postSQLs = append(postSQLs, field.QueryAfter(table.GetName(uint(shardId)))+";")
-			}
-		}
-		fieldsString = fieldsString[:len(fieldsString)-2]
-		sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", table.GetName(uint(shardId)), fieldsString)
-		rows, err := table.Shards[shardId].Query(fmt.Sprintf("SHOW TABLES LIKE '%s';", table.GetName(uint(shardId)))) // TODO DESCRIBE TABLES AND ALTER TABLE IF NEEDED
+		err := table.Shards[shardId].init()
 		if err != nil {
 			return err
 		}
-		if rows.Next() {
-			err = rows.Close()
-			if err != nil {
-				return err
-			}
-			continue
-		}
-		_, err = table.Shards[shardId].Exec(sql)
-		if err != nil {
-			return err
-		}
-		for _, postSQL := range postSQLs {
-			logger.Info(postSQL)
-			_, err = table.Shards[shardId].Exec(postSQL)
-			if err != nil {
-				return err
-			}
-		}
 	}
 	return nil
 }
 
-func (table *Table) GradualSelect(shardKey interface{}, keys Keys) (*GradualSelectResult, error) {
-	return table.GetShard(table.GetShardNum(shardKey)).GradualSelect(keys)
+func (table *Table) GradualSelect(shardKey interface{}, where Condition, options ...SelectOptions) (*GradualSelectResult, error) {
+	return table.shard(shardKey).GradualSelect(where, options...)
+}
+func (table *Table) GradualSelectContext(ctx context.Context, shardKey interface{}, where Condition, options ...SelectOptions) (*GradualSelectResult, error) {
+	return table.shard(shardKey).GradualSelectContext(ctx, where, options...)
 }
-func (table *Table) FullSelect(shardKey interface{}, keys Keys) (*FullSelectResult, error) {
-	return table.GetShard(table.GetShardNum(shardKey)).FullSelect(keys)
+func (table *Table) FullSelect(shardKey interface{}, where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	return table.shard(shardKey).FullSelect(where, options...)
+}
+func (table *Table) FullSelectContext(ctx context.Context, shardKey interface{}, where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	return table.shard(shardKey).FullSelectContext(ctx, where, options...)
 }
 
 func (table *Table) GetString(key Key, column string) (string, bool, error) {
+	return table.GetStringContext(context.Background(), key, column)
+}
+func (table *Table) GetStringContext(ctx context.Context, key Key, column string) (string, bool, error) {
 	var result string
-	err, found := table.Get(key.Value, Keys{key}, SelectColumns{{column, &result}})
+	err, found := table.GetContext(ctx, key.Value, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return "", found, err
 	}
 	return result, found, nil
 }
 func (table *Table) GetInt(key Key, column string) (int, bool, error) {
+	return table.GetIntContext(context.Background(), key, column)
+}
+func (table *Table) GetIntContext(ctx context.Context, key Key, column string) (int, bool, error) {
 	var result int
-	err, found := table.Get(key.Value, Keys{key}, SelectColumns{{column, &result}})
+	err, found := table.GetContext(ctx, key.Value, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (table *Table) GetInt64(key Key, column string) (int64, bool, error) {
+	return table.GetInt64Context(context.Background(), key, column)
+}
+func (table *Table) GetInt64Context(ctx context.Context, key Key, column string) (int64, bool, error) {
 	var result int64
-	err, found := table.Get(key.Value, Keys{key}, SelectColumns{{column, &result}})
+	err, found := table.GetContext(ctx, key.Value, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (table *Table) GetFloat(key Key, column string) (float64, bool, error) {
+	return table.GetFloatContext(context.Background(), key, column)
+}
+func (table *Table) GetFloatContext(ctx context.Context, key Key, column string) (float64, bool, error) {
 	var result float64
-	err, found := table.Get(key.Value, Keys{key}, SelectColumns{{column, &result}})
+	err, found := table.GetContext(ctx, key.Value, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (table *Table) GetUint(key Key, column string) (uint64, bool, error) {
+	return table.GetUintContext(context.Background(), key, column)
+}
+func (table *Table) GetUintContext(ctx context.Context, key Key, column string) (uint64, bool, error) {
 	var result uint64
-	err, found := table.Get(key.Value, Keys{key}, SelectColumns{{column, &result}})
+	err, found := table.GetContext(ctx, key.Value, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
 func (table *Table) GetBoolean(key Key, column string) (bool, bool, error) {
+	return table.GetBooleanContext(context.Background(), key, column)
+}
+func (table *Table) GetBooleanContext(ctx context.Context, key Key, column string) (bool, bool, error) {
 	var result bool
-	err, found := table.Get(key.Value, Keys{key}, SelectColumns{{column, &result}})
+	err, found := table.GetContext(ctx, key.Value, Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return false, found, err
 	}
 	return result, found, nil
 }
+func (table *Table) put(ctx context.Context, shardKey interface{}, values Columns) (sql.Result, error) {
+	return table.write(shardKey, func(shard *Shard) (sql.Result, error) {
+		defer table.invalidateValues(ctx, values)
+		return shard.put(ctx, values)
+	}, func(reshard *Resharder, source *Shard) (func() error, error) {
+		return func() error {
+			return reshard.mirrorPut(source, values)
+		}, nil
+	})
+}
+func (table *Table) putOrUpdate(ctx context.Context, shardKey interface{}, values Columns) (sql.Result, error) {
+	return table.write(shardKey, func(shard *Shard) (sql.Result, error) {
+		defer table.invalidateValues(ctx, values)
+		return shard.putOrUpdate(ctx, values)
+	}, func(reshard *Resharder, source *Shard) (func() error, error) {
+		return func() error {
+			return reshard.mirrorPut(source, values)
+		}, nil
+	})
+}
+func (table *Table) set(ctx context.Context, shardKey interface{}, where Condition, values Columns) (sql.Result, error) {
+	return table.write(shardKey, func(shard *Shard) (sql.Result, error) {
+		keys, err := table.remoteKeys(ctx, shard, shard.driver, where)
+		if err != nil {
+			return nil, err
+		}
+		defer table.invalidateWhere(ctx, where, keys)
+		return shard.set(ctx, where, values)
+	}, func(reshard *Resharder, source *Shard) (func() error, error) {
+		return reshard.prepareRows(source, where)
+	})
+}
+func (table *Table) add(ctx context.Context, shardKey interface{}, where Condition, values Columns) (sql.Result, error) {
+	return table.write(shardKey, func(shard *Shard) (sql.Result, error) {
+		keys, err := table.remoteKeys(ctx, shard, shard.driver, where)
+		if err != nil {
+			return nil, err
+		}
+		defer table.invalidateWhere(ctx, where, keys)
+		return shard.add(ctx, where, values)
+	}, func(reshard *Resharder, source *Shard) (func() error, error) {
+		return reshard.prepareRows(source, where)
+	})
+}
+func (table *Table) remove(ctx context.Context, shardKey interface{}, where Condition) (sql.Result, error) {
+	return table.write(shardKey, func(shard *Shard) (sql.Result, error) {
+		keys, err := table.remoteKeys(ctx, shard, shard.driver, where)
+		if err != nil {
+			return nil, err
+		}
+		defer table.invalidateWhere(ctx, where, keys)
+		return shard.remove(ctx, where)
+	}, func(reshard *Resharder, source *Shard) (func() error, error) {
+		return reshard.prepareRows(source, where)
+	})
+}
+
 func (table *Table) Put(shardKey interface{}, values Columns) error {
-	return table.Shards[table.GetShardNum(shardKey)].Put(values)
+	_, err := table.put(context.Background(), shardKey, values)
+	return err
+}
+func (table *Table) PutContext(ctx context.Context, shardKey interface{}, values Columns) error {
+	_, err := table.put(ctx, shardKey, values)
+	return err
 }
 func (table *Table) PutOrUpdate(shardKey interface{}, values Columns) error {
-	return table.Shards[table.GetShardNum(shardKey)].PutOrUpdate(values)
+	_, err := table.putOrUpdate(context.Background(), shardKey, values)
+	return err
+}
+func (table *Table) PutOrUpdateContext(ctx context.Context, shardKey interface{}, values Columns) error {
+	_, err := table.putOrUpdate(ctx, shardKey, values)
+	return err
+}
+func (table *Table) Set(shardKey interface{}, where Condition, values Columns) error {
+	_, err := table.set(context.Background(), shardKey, where, values)
+	return err
 }
-func (table *Table) Set(shardKey interface{}, keys Keys, values Columns) error {
-	return table.Shards[table.GetShardNum(shardKey)].Set(keys, values)
+func (table *Table) SetContext(ctx context.Context, shardKey interface{}, where Condition, values Columns) error {
+	_, err := table.set(ctx, shardKey, where, values)
+	return err
 }
-func (table *Table) Add(shardKey interface{}, keys Keys, values Columns) error {
-	return table.Shards[table.GetShardNum(shardKey)].Add(keys, values)
+func (table *Table) Add(shardKey interface{}, where Condition, values Columns) error {
+	_, err := table.add(context.Background(), shardKey, where, values)
+	return err
 }
-func (table *Table) Remove(shardKey interface{}, keys Keys) error {
-	return table.Shards[table.GetShardNum(shardKey)].Remove(keys)
+func (table *Table) AddContext(ctx context.Context, shardKey interface{}, where Condition, values Columns) error {
+	_, err := table.add(ctx, shardKey, where, values)
+	return err
+}
+func (table *Table) Remove(shardKey interface{}, where Condition) error {
+	_, err := table.remove(context.Background(), shardKey, where)
+	return err
+}
+func (table *Table) RemoveContext(ctx context.Context, shardKey interface{}, where Condition) error {
+	_, err := table.remove(ctx, shardKey, where)
+	return err
 }
 
-func (table *Table) Get(shardKey interface{}, keys Keys, columns SelectColumns) (error, bool) { // Promise: found
-	return table.Shards[table.GetShardNum(shardKey)].Get(keys, columns)
+func (table *Table) Get(shardKey interface{}, where Condition, columns SelectColumns) (error, bool) { // Promise: found
+	return table.GetContext(context.Background(), shardKey, where, columns)
+}
+func (table *Table) GetContext(ctx context.Context, shardKey interface{}, where Condition, columns SelectColumns) (error, bool) {
+	if table.cache != nil {
+		if err, found, ok := table.getCached(ctx, shardKey, where, columns); ok {
+			return err, found
+		}
+	}
+	return table.shard(shardKey).GetContext(ctx, where, columns)
+}
+func (table *Table) AsyncGet(shardKey interface{}, where Condition, columns SelectColumns) *nonimus.Promise[bool] { // Promise: found
+	return table.AsyncGetContext(context.Background(), shardKey, where, columns)
 }
-func (table *Table) AsyncGet(shardKey interface{}, keys Keys, columns SelectColumns) *nonimus.Promise[bool] { // Promise: found
-	return table.Shards[table.GetShardNum(shardKey)].AsyncGet(keys, columns)
+func (table *Table) AsyncGetContext(ctx context.Context, shardKey interface{}, where Condition, columns SelectColumns) *nonimus.Promise[bool] {
+	return async(ctx, func() (bool, error) {
+		err, found := table.GetContext(ctx, shardKey, where, columns)
+		return found, err
+	})
 }
 func (table *Table) AsyncPut(shardKey interface{}, values Columns) *nonimus.Promise[sql.Result] {
-	return table.Shards[table.GetShardNum(shardKey)].AsyncPut(values)
+	return table.AsyncPutContext(context.Background(), shardKey, values)
+}
+func (table *Table) AsyncPutContext(ctx context.Context, shardKey interface{}, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return table.put(ctx, shardKey, values)
+	})
 }
 func (table *Table) AsyncPutOrUpdate(shardKey interface{}, values Columns) *nonimus.Promise[sql.Result] {
-	return table.Shards[table.GetShardNum(shardKey)].AsyncPutOrUpdate(values)
+	return table.AsyncPutOrUpdateContext(context.Background(), shardKey, values)
+}
+func (table *Table) AsyncPutOrUpdateContext(ctx context.Context, shardKey interface{}, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return table.putOrUpdate(ctx, shardKey, values)
+	})
+}
+func (table *Table) AsyncSet(shardKey interface{}, where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return table.AsyncSetContext(context.Background(), shardKey, where, values)
+}
+func (table *Table) AsyncSetContext(ctx context.Context, shardKey interface{}, where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return table.set(ctx, shardKey, where, values)
+	})
 }
-func (table *Table) AsyncSet(shardKey interface{}, keys Keys, values Columns) *nonimus.Promise[sql.Result] {
-	return table.Shards[table.GetShardNum(shardKey)].AsyncSet(keys, values)
+func (table *Table) AsyncAdd(shardKey interface{}, where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return table.AsyncAddContext(context.Background(), shardKey, where, values)
 }
-func (table *Table) AsyncAdd(shardKey interface{}, keys Keys, values Columns) *nonimus.Promise[sql.Result] {
-	return table.Shards[table.GetShardNum(shardKey)].AsyncAdd(keys, values)
+func (table *Table) AsyncAddContext(ctx context.Context, shardKey interface{}, where Condition, values Columns) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return table.add(ctx, shardKey, where, values)
+	})
 }
-func (table *Table) AsyncRemove(shardKey interface{}, keys Keys) *nonimus.Promise[sql.Result] {
-	return table.Shards[table.GetShardNum(shardKey)].AsyncRemove(keys)
+func (table *Table) AsyncRemove(shardKey interface{}, where Condition) *nonimus.Promise[sql.Result] {
+	return table.AsyncRemoveContext(context.Background(), shardKey, where)
+}
+func (table *Table) AsyncRemoveContext(ctx context.Context, shardKey interface{}, where Condition) *nonimus.Promise[sql.Result] {
+	return async(ctx, func() (sql.Result, error) {
+		return table.remove(ctx, shardKey, where)
+	})
 }
 
-func (table *Table) AsyncExec(query string, key interface{}) *nonimus.Promise[sql.Result] {
-	shardNum := table.GetShardNum(key)
-	return table.Shards[shardNum].AsyncExec(query)
+func (table *Table) AsyncExec(query string, key interface{}, args ...interface{}) *nonimus.Promise[sql.Result] {
+	return table.shard(key).AsyncExec(query, args...)
+}
+func (table *Table) AsyncExecContext(ctx context.Context, query string, key interface{}, args ...interface{}) *nonimus.Promise[sql.Result] {
+	return table.shard(key).AsyncExecContext(ctx, query, args...)
+}
+func (table *Table) Exec(query string, key interface{}, args ...interface{}) (sql.Result, error) {
+	return table.shard(key).Exec(query, args...)
 }
-func (table *Table) Exec(query string, key interface{}) (sql.Result, error) {
-	shardNum := table.GetShardNum(key)
-	return table.Shards[shardNum].Exec(query)
+func (table *Table) ExecContext(ctx context.Context, query string, key interface{}, args ...interface{}) (sql.Result, error) {
+	return table.shard(key).ExecContext(ctx, query, args...)
 }
 func (table *Table) StartTx(key interface{}) (*sql.Tx, error) {
-	shardNum := table.GetShardNum(key)
-	return table.Shards[shardNum].RawTx()
+	return table.shard(key).RawTx()
 }
-func (table *Table) Query(query string, key interface{}) (*sql.Rows, error) {
-	shardNum := table.GetShardNum(key)
-	return table.Shards[shardNum].Query(query)
+func (table *Table) Query(query string, key interface{}, args ...interface{}) (*sql.Rows, error) {
+	return table.shard(key).Query(query, args...)
+}
+func (table *Table) QueryContext(ctx context.Context, query string, key interface{}, args ...interface{}) (*sql.Rows, error) {
+	return table.shard(key).QueryContext(ctx, query, args...)
 }
 
 func (table *Table) ReleaseRows(rows *sql.Rows) error {
 	return rows.Close()
 }
 
-func (table *Table) SingleSet(shardKey interface{}, keys Keys, column Column) error {
-	return table.Set(shardKey, keys, Columns{column})
+func (table *Table) SingleSet(shardKey interface{}, where Condition, column Column) error {
+	return table.Set(shardKey, where, Columns{column})
+}
+func (table *Table) SingleSetContext(ctx context.Context, shardKey interface{}, where Condition, column Column) error {
+	return table.SetContext(ctx, shardKey, where, Columns{column})
+}
+
+// shards returns the current shard list
+func (table *Table) shards() []*Shard {
+	table.mx.RLock()
+	defer table.mx.RUnlock()
+	return table.Shards
 }
 
 func (table *Table) DropUnsafe() {
-	for i := 0; i < len(table.Shards); i++ {
-		table.Shards[i].Drop()
+	for _, shard := range table.shards() {
+		shard.Drop()
 	}
 }
 
-func (table *Table) GlobalExecUnsafe(query string) error {
-	for i := 0; i < len(table.Shards); i++ {
-		_, err := table.Shards[i].Exec(query)
+func (table *Table) GlobalExecUnsafe(query string, args ...interface{}) error {
+	for _, shard := range table.shards() {
+		_, err := shard.Exec(query, args...)
 		if err != nil {
 			return err
 		}
@@ -268,3 +596,7 @@ func (table *Table) GlobalExecUnsafe(query string) error {
 func (table *Table) GetFields() TableFields {
 	return table.fields
 }
+
+func (table *Table) GetDialect() Dialect {
+	return table.dialect
+}
@@ -0,0 +1,144 @@
+package eplidr
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tracer starts spans of statements like an OpenTelemetry tracer, the parent span is taken from ctx
+// and the returned context carries the started span
+type Tracer interface {
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+var tracer Tracer = NoopTracer{}
+
+// SetTracer sets the tracer of every table. A statement has an eplidr.<operation> span with
+// eplidr.query and eplidr.scan child spans, an Async* call has an eplidr.pool.wait span
+// for the time it waits for a worker.
+func SetTracer(newTracer Tracer) {
+	if newTracer == nil {
+		newTracer = NoopTracer{}
+	}
+	tracer = newTracer
+}
+
+// NoopTracer is the default Tracer, it records nothing
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attributes ...Attribute) {}
+func (noopSpan) RecordError(err error)                 {}
+func (noopSpan) End()                                  {}
+
+// SpanData is a span ended in MemoryTracer, ParentID is 0 for a root span
+type SpanData struct {
+	ID         uint64
+	ParentID   uint64
+	Name       string
+	Attributes []Attribute
+	Err        error
+	Start      time.Time
+	End        time.Time
+}
+
+// Attribute returns value of the attribute key, nil if it is not set
+func (span SpanData) Attribute(key string) interface{} {
+	for i := len(span.Attributes) - 1; i >= 0; i-- {
+		if span.Attributes[i].Key == key {
+			return span.Attributes[i].Value
+		}
+	}
+	return nil
+}
+
+// MemoryTracer keeps ended spans in memory, it is meant for tests
+type MemoryTracer struct {
+	mx     sync.Mutex
+	nextID uint64
+	spans  []SpanData
+}
+
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+type memorySpanKey struct{}
+
+type memorySpan struct {
+	tracer *MemoryTracer
+	mx     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (t *MemoryTracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	t.mx.Lock()
+	t.nextID++
+	span := &memorySpan{tracer: t, data: SpanData{
+		ID:         t.nextID,
+		Name:       name,
+		Attributes: append([]Attribute(nil), attributes...),
+		Start:      time.Now(),
+	}}
+	t.mx.Unlock()
+	if parent, ok := ctx.Value(memorySpanKey{}).(*memorySpan); ok {
+		span.data.ParentID = parent.data.ID
+	}
+	return context.WithValue(ctx, memorySpanKey{}, span), span
+}
+
+// Spans returns the ended spans in order of ending
+func (t *MemoryTracer) Spans() []SpanData {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return append([]SpanData(nil), t.spans...)
+}
+
+func (t *MemoryTracer) Reset() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.spans = nil
+}
+
+func (span *memorySpan) SetAttributes(attributes ...Attribute) {
+	span.mx.Lock()
+	defer span.mx.Unlock()
+	span.data.Attributes = append(span.data.Attributes, attributes...)
+}
+func (span *memorySpan) RecordError(err error) {
+	span.mx.Lock()
+	defer span.mx.Unlock()
+	span.data.Err = err
+}
+func (span *memorySpan) End() {
+	span.mx.Lock()
+	if span.ended {
+		span.mx.Unlock()
+		return
+	}
+	span.ended = true
+	span.data.End = time.Now()
+	data := span.data
+	span.mx.Unlock()
+	span.tracer.mx.Lock()
+	defer span.tracer.mx.Unlock()
+	span.tracer.spans = append(span.tracer.spans, data)
+}
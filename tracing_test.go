@@ -0,0 +1,98 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// spanNamed returns the first span of spans named name
+func spanNamed(t *testing.T, spans []SpanData, name string) SpanData {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span %s in %+v", name, spans)
+	return SpanData{}
+}
+
+func TestTracing(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	memory := NewMemoryTracer()
+	SetTracer(memory)
+	t.Cleanup(func() {
+		SetTracer(nil)
+	})
+
+	ctx, parent := memory.Start(context.Background(), "request")
+	if err := table.PutContext(ctx, int64(1), Columns{{"id", int64(1)}, {"name", "secret"}, {"status", int64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	spans := memory.Spans()
+	put, query, request := spanNamed(t, spans, "eplidr.put"), spanNamed(t, spans, "eplidr.query"), spanNamed(t, spans, "request")
+	if put.ParentID != request.ID || query.ParentID != put.ID {
+		t.Errorf("spans %+v, want request > eplidr.put > eplidr.query", spans)
+	}
+	want := map[string]interface{}{
+		"eplidr.table":     "items",
+		"eplidr.shard":     int64(table.GetShardNum(int64(1))),
+		"eplidr.operation": "put",
+		"eplidr.replica":   false,
+		"db.operation":     "insert",
+		"db.rows_affected": int64(1),
+		// the statement is a fingerprint without values
+		"db.statement": `INSERT INTO "` + table.shard(int64(1)).name + `" ("id", "name", "status") values (?);`,
+	}
+	for key, value := range want {
+		if got := put.Attribute(key); got != value {
+			t.Errorf("attribute %s is %v, want %v", key, got, value)
+		}
+	}
+
+	// rows are counted by the scan span, the operation span ends after it
+	memory.Reset()
+	result, err := table.FullSelect(int64(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectedIDs(t, result)
+	spans = memory.Spans()
+	selectSpan, scan := spanNamed(t, spans, "eplidr.select"), spanNamed(t, spans, "eplidr.scan")
+	if scan.ParentID != selectSpan.ID || scan.Attribute("db.rows_returned") != int64(1) || selectSpan.Attribute("db.rows_returned") != int64(1) {
+		t.Errorf("spans of a select %+v", spans)
+	}
+
+	memory.Reset()
+	err = table.Put(int64(1), Columns{{"id", int64(1)}, {"status", int64(1)}})
+	spans = memory.Spans()
+	if put := spanNamed(t, spans, "eplidr.put"); !errors.Is(put.Err, ErrDuplicateKey) || !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("error of the span %v, of the put %v", put.Err, err)
+	}
+	if query := spanNamed(t, spans, "eplidr.query"); query.Err == nil {
+		t.Error("error is not recorded by the query span")
+	}
+}
+
+func TestTracingPoolWait(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields)
+	putItems(t, table, 1)
+	memory := NewMemoryTracer()
+	SetTracer(memory)
+	t.Cleanup(func() {
+		SetTracer(nil)
+	})
+
+	var status int64
+	found, err := table.AsyncGetContext(context.Background(), int64(0), Keys{{"id", int64(0)}}, SelectColumns{{"status", &status}}).Await()
+	if err != nil || !found {
+		t.Fatalf("AsyncGetContext: %v %v", found, err)
+	}
+	spans := memory.Spans()
+	wait, get := spanNamed(t, spans, "eplidr.pool.wait"), spanNamed(t, spans, "eplidr.get")
+	if wait.ParentID != 0 || get.ParentID != 0 || wait.End.After(get.Start) {
+		t.Errorf("spans of an async get %+v, want the wait before the get", spans)
+	}
+}
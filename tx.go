@@ -1,173 +1,381 @@
 package eplidr
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"strconv"
-	"strings"
 )
 
+// Tx is a transaction on a single shard of a Table, statements are built from the table fields like Shard does
 type Tx struct {
-	driver *sql.Tx
-	shard  uint
+	ctx   context.Context
+	ex    executor
+	shard *Shard
+	// raw is nil for a branch of DistributedTx, it is committed by the DistributedTx
+	raw *sql.Tx
+	// invalidations drop cached rows written by the transaction again after commit, other
+	// Get calls may cache them before it
+	invalidations *[]func()
+	// reshard is the Resharder attached when the transaction began, mirrors apply the writes
+	// to its new shards after commit
+	reshard *Resharder
+	mirrors *[]txMirror
+	// release ends the hold of the table transactions lock, it is nil for Shard.Begin and branches
+	release func()
 }
 
-func (tx *Tx) getTableName(table string) string {
-	return table + strconv.FormatUint(uint64(tx.shard), 10)
+type txMirror struct {
+	reshard *Resharder
+	apply   func() error
 }
 
-func (tx *Tx) GetString(table string, keyName interface{}, key interface{}, column string, lock bool) (string, bool, error) {
+var errTxBranch = errors.New("eplidr: transaction is a branch of DistributedTx, commit or rollback the DistributedTx")
+
+// txRetries is the number of attempts InTx makes when the transaction is chosen as a deadlock victim
+// and the table has no RetryPolicy
+const txRetries = 3
+
+// Begin starts a transaction on the shard of shardKey, ctx is used by all statements of the transaction.
+// Its writes are mirrored to the new shards of an attached Resharder after commit and the cutover waits
+// for it, so the transaction must be committed or rolled back.
+func (table *Table) Begin(ctx context.Context, shardKey interface{}, opts *sql.TxOptions) (*Tx, error) {
+	reshard, release, err := table.beginTx()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := table.shard(shardKey).Begin(ctx, opts)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	tx.reshard = reshard
+	tx.release = release
+	return tx, nil
+}
+
+// InTx runs fn in a transaction on the shard of shardKey. The transaction is committed if fn returns nil
+// and rolled back otherwise. fn is called again if the transaction fails with an error retried by the
+// RetryPolicy of the table, or with a deadlock if the table has none. A connection failure on commit is
+// never retried, the transaction may be committed.
+func (table *Table) InTx(ctx context.Context, shardKey interface{}, fn func(tx *Tx) error) error {
+	policy := table.retry
+	if policy.MaxAttempts <= 1 {
+		policy = RetryPolicy{MaxAttempts: txRetries, Retriable: []ErrorCode{CodeDeadlock}}
+	}
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		if attempt != 0 && !policy.wait(ctx, attempt) {
+			return err
+		}
+		var committing bool
+		committing, err = table.inTx(ctx, shardKey, fn)
+		if err == nil || !policy.retriable(err, !committing) || ctx.Err() != nil {
+			return err
+		}
+		logger.Debug("transaction on ", table.name, " failed, retrying: ", err.Error())
+	}
+	return err
+}
+
+// inTx runs fn in a transaction, committing is set if err is returned by commit
+func (table *Table) inTx(ctx context.Context, shardKey interface{}, fn func(tx *Tx) error) (committing bool, err error) {
+	tx, err := table.Begin(ctx, shardKey, nil)
+	if err != nil {
+		return false, err
+	}
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			logger.Error(rollbackErr.Error())
+		}
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Shard returns the shard of the transaction
+func (tx *Tx) Shard() *Shard {
+	return tx.shard
+}
+
+func (tx *Tx) execStatement(op Operation, stmt *statement) (sql.Result, error) {
+	return tx.shard.execOn(withColumns(withOperation(tx.ctx, op), stmt), tx.ex, stmt.String(), stmt.args...)
+}
+
+func (tx *Tx) GetString(key Key, column string) (string, bool, error) {
 	var result string
-	err, found := tx.Get(table, keyName, key, []string{column}, []interface{}{&result}, lock)
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return "", found, err
 	}
 	return result, found, nil
 }
-func (tx *Tx) GetInt(table string, keyName interface{}, key interface{}, column string, lock bool) (int, bool, error) {
+func (tx *Tx) GetInt(key Key, column string) (int, bool, error) {
 	var result int
-	err, found := tx.Get(table, keyName, key, []string{column}, []interface{}{&result}, lock)
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
-func (tx *Tx) GetInt64(table string, keyName interface{}, key interface{}, column string, lock bool) (int64, bool, error) {
+func (tx *Tx) GetInt64(key Key, column string) (int64, bool, error) {
 	var result int64
-	err, found := tx.Get(table, keyName, key, []string{column}, []interface{}{&result}, lock)
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
-func (tx *Tx) GetFloat(table string, keyName interface{}, key interface{}, column string, lock bool) (float64, bool, error) {
+func (tx *Tx) GetFloat(key Key, column string) (float64, bool, error) {
 	var result float64
-	err, found := tx.Get(table, keyName, key, []string{column}, []interface{}{&result}, lock)
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
-func (tx *Tx) GetUint(table string, keyName interface{}, key interface{}, column string, lock bool) (uint64, bool, error) {
+func (tx *Tx) GetUint64(key Key, column string) (uint64, bool, error) {
 	var result uint64
-	err, found := tx.Get(table, keyName, key, []string{column}, []interface{}{&result}, lock)
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
+	if err != nil {
+		return 0, found, err
+	}
+	return result, found, nil
+}
+func (tx *Tx) GetUint(key Key, column string) (uint, bool, error) {
+	var result uint
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return 0, found, err
 	}
 	return result, found, nil
 }
-func (tx *Tx) GetBoolean(table string, keyName interface{}, key interface{}, column string, lock bool) (bool, bool, error) {
+func (tx *Tx) GetBoolean(key Key, column string) (bool, bool, error) {
 	var result bool
-	err, found := tx.Get(table, keyName, key, []string{column}, []interface{}{&result}, lock)
+	err, found := tx.Get(Keys{key}, SelectColumns{{column, &result}})
 	if err != nil {
 		return false, found, err
 	}
 	return result, found, nil
 }
 
-func (tx *Tx) Get(table string, keyName interface{}, key interface{}, columns []string, data []interface{}, lock bool) (error, bool) {
-	var lockStatement string
-	if lock {
-		lockStatement = " FOR UPDATE;"
-	} else {
-		lockStatement = ""
+func (tx *Tx) get(where Condition, columns SelectColumns, lock bool) (error, bool) {
+	return tx.shard.get(tx.ctx, tx.ex, where, columns, lock)
+}
+func (tx *Tx) Get(where Condition, columns SelectColumns) (error, bool) {
+	return tx.get(where, columns, false)
+}
+
+// GetForUpdate is Get that locks the selected row until the end of transaction
+func (tx *Tx) GetForUpdate(where Condition, columns SelectColumns) (error, bool) {
+	return tx.get(where, columns, true)
+}
+func (tx *Tx) GradualSelect(where Condition, options ...SelectOptions) (*GradualSelectResult, error) {
+	return tx.shard.gradualSelect(tx.ctx, tx.ex, where, mergeSelectOptions(options))
+}
+func (tx *Tx) FullSelect(where Condition, options ...SelectOptions) (*FullSelectResult, error) {
+	return tx.shard.fullSelect(tx.ctx, tx.ex, where, mergeSelectOptions(options))
+}
+func (tx *Tx) Put(values Columns) error {
+	if err := tx.shard.table.validate(validateInsert, values); err != nil {
+		return err
+	}
+	return tx.put(tx.shard.putStatement(values).write(";"), values)
+}
+func (tx *Tx) PutOrUpdate(values Columns) error {
+	if err := tx.shard.table.validate(validateInsert, values); err != nil {
+		return err
 	}
-	query := fmt.Sprintf("SELECT %s FROM `%s` WHERE `%v` = %s%s;", ColumnNamesToQuery(columns...), tx.getTableName(table), keyName, value(key), lockStatement)
-	rows, err := tx.Query(table, query)
+	return tx.put(tx.shard.putOrUpdateStatement(values).write(";"), values)
+}
+func (tx *Tx) put(stmt *statement, values Columns) error {
+	if tx.reshard != nil && !tx.reshard.leased() {
+		return ErrReshardFenced
+	}
+	_, err := tx.execStatement(OpPut, stmt)
+	tx.invalidateValues(values)
 	if err != nil {
-		rows.Close()
-		return err, false
+		return err
 	}
-	if rows.Next() {
-		err := rows.Scan(data...)
-		if err != nil {
-			rows.Close()
-			return err, true
+	if reshard, source := tx.reshard, tx.shard; reshard != nil {
+		tx.mirror(func() error {
+			return reshard.mirrorPut(source, values)
+		})
+	}
+	return nil
+}
+func (tx *Tx) Set(where Condition, values Columns) error {
+	if err := tx.shard.table.validate(validateUpdate, values); err != nil {
+		return err
+	}
+	return tx.update(OpSet, where, tx.shard.setStatement(where, values))
+}
+func (tx *Tx) Add(where Condition, values Columns) error {
+	if err := tx.shard.table.validate(validateAdd, values); err != nil {
+		return err
+	}
+	return tx.update(OpAdd, where, tx.shard.addStatement(where, values))
+}
+func (tx *Tx) Remove(where Condition) error {
+	return tx.update(OpRemove, where, tx.shard.removeStatement(where))
+}
+
+// update executes stmt changing the rows of where, the rows are read for mirroring before it
+func (tx *Tx) update(op Operation, where Condition, stmt *statement) error {
+	var apply func() error
+	if tx.reshard != nil {
+		if !tx.reshard.leased() {
+			return ErrReshardFenced
 		}
-		rows.Close()
-	} else {
-		rows.Close()
-		return nil, false
-	}
-	return nil, true
-}
-func (tx *Tx) Put(table string, columns []string, values []interface{}) error {
-	if len(columns) != len(values) {
-		return errors.New("keyTable.Put : len(columns) != len(data) ")
-	}
-	columnsString := ""
-	valuesString := ""
-	for i := 0; i < len(columns); i++ {
-		if i == len(columns)-1 {
-			columnsString += fmt.Sprintf("`%s`", columns[i])
-		} else {
-			columnsString += fmt.Sprintf("`%s`, ", columns[i])
+		var err error
+		apply, err = tx.reshard.prepareRows(tx.shard, where)
+		if err != nil {
+			return err
 		}
 	}
-	for i := 0; i < len(values); i++ {
-		if i == len(values)-1 {
-			valuesString += fmt.Sprintf("%s", value(values[i]))
-		} else {
-			valuesString += fmt.Sprintf("%s, ", value(values[i]))
-		}
+	keys, err := tx.shard.table.remoteKeys(tx.ctx, tx.shard, tx.ex, where)
+	if err != nil {
+		return err
 	}
-	query := fmt.Sprintf("INSERT INTO `%s` (%s) values (%s);", tx.getTableName(table), columnsString, valuesString)
-	_, err := tx.driver.Exec(query)
+	_, err = tx.execStatement(op, stmt)
+	tx.invalidateWhere(where, keys)
 	if err != nil {
 		return err
 	}
+	if apply != nil {
+		tx.mirror(apply)
+	}
 	return nil
 }
-func (tx *Tx) Set(table string, keyName interface{}, key interface{}, columns []string, values []interface{}) error {
-	if len(columns) != len(values) {
-		return errors.New("keyTable.Set : len(columns) != len(values) ")
+
+// mirror adds apply to the writes mirrored after commit
+func (tx *Tx) mirror(apply func() error) {
+	*tx.mirrors = append(*tx.mirrors, txMirror{reshard: tx.reshard, apply: apply})
+}
+func (tx *Tx) SingleSet(where Condition, column Column) error {
+	return tx.Set(where, Columns{column})
+}
+
+// Exec executes query with placeholders bound to args, {table} is replaced with shard table name
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.shard.execOn(tx.ctx, tx.ex, query, args...)
+}
+
+// Query executes query with placeholders bound to args, {table} is replaced with shard table name
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.shard.queryOn(tx.ctx, tx.ex, query, args...)
+}
+
+func (tx *Tx) Commit() error {
+	if tx.raw == nil {
+		return errTxBranch
 	}
-	s := ""
-	for i := 0; i < len(columns); i++ {
-		if i == len(columns)-1 {
-			s += fmt.Sprintf("`%s` = %s", columns[i], value(values[i]))
-		} else {
-			s += fmt.Sprintf("`%s` = %s, ", columns[i], value(values[i]))
-		}
+	defer tx.end()
+	if err := fencedMirrors(*tx.mirrors); err != nil {
+		tx.raw.Rollback()
+		return err
 	}
-	query := fmt.Sprintf("UPDATE `%s` SET %s WHERE `%s` = %s;", tx.getTableName(table), s, keyName, value(key))
-	_, err := tx.driver.Exec(query)
-	if err != nil {
+	return commitMirrored(*tx.mirrors, func() error {
+		err := tx.raw.Commit()
+		if err == nil {
+			runInvalidations(*tx.invalidations)
+		}
 		return err
+	})
+}
+
+// end releases the table transactions lock
+func (tx *Tx) end() {
+	if tx.release != nil {
+		tx.release()
+	}
+}
+
+// fencedMirrors returns ErrReshardFenced if the lease of a Resharder of mirrors expired,
+// the transaction must not be committed then
+func fencedMirrors(mirrors []txMirror) error {
+	for _, mirror := range mirrors {
+		if !mirror.reshard.leased() {
+			return ErrReshardFenced
+		}
 	}
 	return nil
 }
-func (tx *Tx) Remove(table string, keyName interface{}, key interface{}) error {
-	query := fmt.Sprintf("DELETE FROM `%s` WHERE `%s` = %s;", tx.getTableName(table), keyName, value(key))
-	_, err := tx.driver.Exec(query)
+
+// commitMirrored runs commit and applies mirrors after it succeeds. The copy locks of their Resharders are
+// held meanwhile, so a Copy batch reading rows before the commit does not write them after the mirrors.
+func commitMirrored(mirrors []txMirror, commit func() error) error {
+	var locked []*Resharder
+	for _, mirror := range mirrors {
+		if !containsResharder(locked, mirror.reshard) {
+			mirror.reshard.copyMx.RLock()
+			locked = append(locked, mirror.reshard)
+		}
+	}
+	defer func() {
+		for _, reshard := range locked {
+			reshard.copyMx.RUnlock()
+		}
+	}()
+	err := commit()
 	if err != nil {
 		return err
 	}
+	for _, mirror := range mirrors {
+		if err := mirror.apply(); err != nil {
+			mirror.reshard.mirrorFailed(err)
+		}
+	}
 	return nil
 }
 
-func (tx *Tx) Exec(table string, query string) (sql.Result, error) {
-	query = strings.ReplaceAll(query, "{table}", fmt.Sprintf("`%s`", tx.getTableName(table)))
-	return tx.driver.Exec(query)
+func containsResharder(reshards []*Resharder, reshard *Resharder) bool {
+	for _, r := range reshards {
+		if r == reshard {
+			return true
+		}
+	}
+	return false
 }
 
-func (tx *Tx) Query(table string, query string) (*sql.Rows, error) {
-	query = strings.ReplaceAll(query, "{table}", fmt.Sprintf("`%s`", tx.getTableName(table)))
-	return tx.driver.Query(query)
+// invalidateValues drops the cached row written with values now and after commit
+func (tx *Tx) invalidateValues(values Columns) {
+	table := tx.shard.table
+	if table.cache == nil {
+		return
+	}
+	table.invalidateValues(tx.ctx, values)
+	*tx.invalidations = append(*tx.invalidations, func() {
+		table.invalidateValues(context.Background(), values)
+	})
 }
 
-func (tx *Tx) SingleSet(table string, keyName string, key interface{}, column string, value interface{}) error {
-	return tx.Set(table, keyName, key, []string{column}, []interface{}{value})
+// invalidateWhere drops the cached rows written by where now and after commit, keys are returned by remoteKeys
+func (tx *Tx) invalidateWhere(where Condition, keys []string) {
+	table := tx.shard.table
+	if table.cache == nil {
+		return
+	}
+	table.invalidateWhere(tx.ctx, where, keys)
+	*tx.invalidations = append(*tx.invalidations, func() {
+		table.invalidateWhere(context.Background(), where, keys)
+	})
 }
 
-func (tx *Tx) Commit() error {
-	return tx.driver.Commit()
+func runInvalidations(invalidations []func()) {
+	for _, invalidate := range invalidations {
+		invalidate()
+	}
 }
 
 func (tx *Tx) Rollback() error {
-	return tx.driver.Rollback()
+	if tx.raw == nil {
+		return errTxBranch
+	}
+	defer tx.end()
+	return tx.raw.Rollback()
 }
 func (tx *Tx) Fail() {
-	tx.driver.Rollback()
+	tx.Rollback()
 }
@@ -0,0 +1,67 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	putItems(t, table, 10)
+	ctx := context.Background()
+
+	err := table.InTx(ctx, int64(4), func(tx *Tx) error {
+		status, found, err := tx.GetInt64(Key{Name: "id", Value: int64(4)}, "status")
+		if err != nil || !found {
+			t.Fatalf("GetInt64: %d %v %v", status, found, err)
+		}
+		name, _, err := tx.GetString(Key{Name: "id", Value: int64(4)}, "name")
+		if err != nil || name != "item" {
+			t.Fatalf("GetString: %q %v", name, err)
+		}
+		return tx.SingleSet(Keys{{"id", int64(4)}}, Column{Name: "status", Value: status + 10})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := cachedStatus(t, table, 4); status != 11 {
+		t.Errorf("status after commit %d, want 11", status)
+	}
+
+	failure := errors.New("failure")
+	err = table.InTx(ctx, int64(4), func(tx *Tx) error {
+		if err := tx.SingleSet(Keys{{"id", int64(4)}}, Column{Name: "status", Value: int64(0)}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("InTx: %v, want failure", err)
+	}
+	if status, _ := cachedStatus(t, table, 4); status != 11 {
+		t.Errorf("status after rollback %d, want 11", status)
+	}
+
+	// deadlocks are retried, other errors are not
+	attempts := 0
+	err = table.InTx(ctx, int64(4), func(tx *Tx) error {
+		attempts++
+		if attempts < 3 {
+			return ErrDeadlock
+		}
+		return tx.Add(Keys{{"id", int64(4)}}, Columns{{"status", int64(1)}})
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("InTx after deadlocks: %v, %d attempts, want 3", err, attempts)
+	}
+	if status, _ := cachedStatus(t, table, 4); status != 12 {
+		t.Errorf("status after retried transaction %d, want 12", status)
+	}
+
+	// every transaction releases the table transactions lock
+	if !table.txMx.TryLock() {
+		t.Fatal("transactions lock is held after the transactions ended")
+	}
+	table.txMx.Unlock()
+}
@@ -0,0 +1,524 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// TypedTable maps rows of a Table to structs of type T. Columns are declared with struct tags:
+//
+//	type User struct {
+//		ID      uuid.UUID `eplidr:"id,pk"`
+//		Name    string    `eplidr:"name,size=64,index"`
+//		Balance *big.Int  `eplidr:"balance"`
+//		Note    *string   `eplidr:"note"` // pointers are nullable
+//		Cache   string    `eplidr:"-"`
+//	}
+//
+// Tag options are pk, index, nullable, sensitive, type=<name>, size=<n> and default=<value>. The type is derived
+// from the Go type if it is not set. The first primary key column is the shard key.
+type TypedTable[T any] struct {
+	Table   *Table
+	columns []typedColumn
+	// primaryKey are indexes of primary key columns in columns
+	primaryKey []int
+}
+
+type typedColumn struct {
+	name  string
+	index []int
+	// goType is the field type, pointers are dereferenced
+	goType reflect.Type
+}
+
+var (
+	uuidType   = reflect.TypeOf(uuid.UUID{})
+	bigIntType = reflect.TypeOf(big.Int{})
+	bytesType  = reflect.TypeOf([]byte(nil))
+)
+
+var typedTypes = map[string]Type{
+	"uint64":    TypeUint64,
+	"int64":     TypeInt64,
+	"int32":     TypeInt32,
+	"uint32":    TypeUint32,
+	"float":     TypeFloat,
+	"bool":      TypeBool,
+	"timestamp": TypeTimestamp,
+	"uuid":      TypeUUID,
+	"sha256":    TypeSHA256,
+	"ip":        TypeIP,
+	"email":     TypeEmail,
+	"username":  TypeUsername,
+	"bigint":    TypeBigInt,
+	"url":       TypeURL,
+}
+
+var typedSizedTypes = map[string]BasicType{
+	"varchar": BasicTypeVarChar,
+	"varbyte": BasicTypeVarByte,
+	"binary":  BasicTypeBinary,
+}
+
+func NewTypedTable[T any](name string, shardsCount uint, drivers Drivers, options ...TableOption) (*TypedTable[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("eplidr: TypedTable type %s is not a struct", t)
+	}
+	table := &TypedTable[T]{}
+	var fields []DefaultTableField
+	err := table.parse(t, nil, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(table.primaryKey) == 0 {
+		return nil, fmt.Errorf("eplidr: TypedTable type %s has no pk field", t)
+	}
+	var tableFields TableFields
+	var keys []string
+	for _, field := range fields {
+		if field.PrimaryKey && len(table.primaryKey) > 1 {
+			field.PrimaryKey = false
+			keys = append(keys, field.Name)
+		}
+		tableFields = append(tableFields, field)
+	}
+	if len(keys) != 0 {
+		tableFields = append(tableFields, ConstraintPrimaryKey(keys...))
+	}
+	table.Table, err = NewTable(name, shardsCount, tableFields, drivers, options...)
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+func (table *TypedTable[T]) parse(t reflect.Type, index []int, fields *[]DefaultTableField) error {
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		tag, tagged := structField.Tag.Lookup("eplidr")
+		if tag == "-" || (!structField.IsExported() && !structField.Anonymous) {
+			continue
+		}
+		if structField.Anonymous && !tagged && structField.Type.Kind() == reflect.Struct {
+			// fields of embedded structs are columns of T
+			err := table.parse(structField.Type, fieldIndex, fields)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !structField.IsExported() {
+			continue
+		}
+		column := typedColumn{name: structField.Name, index: fieldIndex, goType: structField.Type}
+		field := DefaultTableField{Name: structField.Name}
+		if column.goType.Kind() == reflect.Pointer {
+			column.goType = column.goType.Elem()
+			field.Nullable = true
+		}
+		options := strings.Split(tag, ",")
+		if options[0] != "" {
+			column.name = options[0]
+			field.Name = options[0]
+		}
+		typeName, size := "", 0
+		for _, option := range options[1:] {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "pk":
+				field.PrimaryKey = true
+			case "index":
+				field.Index = true
+			case "nullable":
+				field.Nullable = true
+			case "sensitive":
+				field.Sensitive = true
+			case "type":
+				typeName = value
+			case "size":
+				var err error
+				size, err = strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("eplidr: field %s: invalid size %s", structField.Name, value)
+				}
+			case "default":
+				field.DefaultValue = DefaultExpression(value)
+			default:
+				return fmt.Errorf("eplidr: field %s: unknown tag option %s", structField.Name, option)
+			}
+		}
+		var err error
+		field.Type, err = typedFieldType(column.goType, typeName, size)
+		if err != nil {
+			return fmt.Errorf("eplidr: field %s: %w", structField.Name, err)
+		}
+		if field.PrimaryKey {
+			field.Nullable = false
+			table.primaryKey = append(table.primaryKey, len(table.columns))
+		}
+		table.columns = append(table.columns, column)
+		*fields = append(*fields, field)
+	}
+	return nil
+}
+
+func typedFieldType(t reflect.Type, name string, size int) (Type, error) {
+	if name != "" {
+		if result, ok := typedTypes[name]; ok {
+			return result, nil
+		}
+		if basicType, ok := typedSizedTypes[name]; ok {
+			if size == 0 {
+				size = 255
+			}
+			return GetSizedType(basicType, size), nil
+		}
+		return nil, errors.New("unknown type " + name)
+	}
+	if size == 0 {
+		size = 255
+	}
+	switch t {
+	case uuidType:
+		return TypeUUID, nil
+	case bigIntType:
+		return TypeBigInt, nil
+	case bytesType:
+		return GetSizedType(BasicTypeVarByte, size), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return GetSizedType(BasicTypeVarChar, size), nil
+	case reflect.Bool:
+		return TypeBool, nil
+	case reflect.Int, reflect.Int64:
+		return TypeInt64, nil
+	case reflect.Int32, reflect.Int16, reflect.Int8:
+		return TypeInt32, nil
+	case reflect.Uint, reflect.Uint64:
+		return TypeUint64, nil
+	case reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return TypeUint32, nil
+	case reflect.Float64, reflect.Float32:
+		return TypeFloat, nil
+	}
+	return nil, errors.New("can not derive column type of " + t.String() + ", set type option")
+}
+
+// keys returns Keys of the primary key, key is the value of the primary key or []interface{} of values of a composite one
+func (table *TypedTable[T]) keys(key interface{}) (Keys, error) {
+	values := []interface{}{key}
+	if len(table.primaryKey) > 1 {
+		var ok bool
+		values, ok = key.([]interface{})
+		if !ok || len(values) != len(table.primaryKey) {
+			return nil, fmt.Errorf("eplidr: key of %s must be []interface{} of %d values", table.Table.name, len(table.primaryKey))
+		}
+	}
+	keys := make(Keys, len(values))
+	for i, value := range values {
+		keys[i] = Key{Name: table.columns[table.primaryKey[i]].name, Value: value}
+	}
+	return keys, nil
+}
+
+// value returns argument of column of v, nil pointers are NULL
+func (table *TypedTable[T]) value(v reflect.Value, column typedColumn) interface{} {
+	field := v.FieldByIndex(column.index)
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		if column.goType != bigIntType {
+			field = field.Elem()
+		}
+	} else if column.goType == bigIntType {
+		field = field.Addr()
+	}
+	return field.Interface()
+}
+
+// columnValues returns Columns of v for the columns accepted by include
+func (table *TypedTable[T]) columnValues(v reflect.Value, include func(i int, column typedColumn) bool) Columns {
+	var result Columns
+	for i, column := range table.columns {
+		if include(i, column) {
+			result = append(result, Column{Name: column.name, Value: table.value(v, column)})
+		}
+	}
+	return result
+}
+
+func (table *TypedTable[T]) isPrimaryKey(i int) bool {
+	for _, index := range table.primaryKey {
+		if index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// addressable returns addressable copy of value
+func addressable[T any](value T) reflect.Value {
+	v := reflect.New(reflect.TypeOf((*T)(nil)).Elem()).Elem()
+	v.Set(reflect.ValueOf(value))
+	return v
+}
+
+func (table *TypedTable[T]) shardKey(v reflect.Value) interface{} {
+	return table.value(v, table.columns[table.primaryKey[0]])
+}
+
+func (table *TypedTable[T]) Put(ctx context.Context, value T) error {
+	v := addressable(value)
+	return table.Table.PutContext(ctx, table.shardKey(v), table.columnValues(v, func(int, typedColumn) bool { return true }))
+}
+
+// Upsert inserts value or updates all columns of the existing row with the same primary key
+func (table *TypedTable[T]) Upsert(ctx context.Context, value T) error {
+	v := addressable(value)
+	return table.Table.PutOrUpdateContext(ctx, table.shardKey(v), table.columnValues(v, func(int, typedColumn) bool { return true }))
+}
+
+// Update sets columns of the row with key to the values of partial.
+// If columns are not set, non-zero fields of partial that are not in the primary key are set.
+func (table *TypedTable[T]) Update(ctx context.Context, key interface{}, partial T, columns ...string) error {
+	keys, err := table.keys(key)
+	if err != nil {
+		return err
+	}
+	v := addressable(partial)
+	values := table.columnValues(v, func(i int, column typedColumn) bool {
+		if len(columns) == 0 {
+			return !table.isPrimaryKey(i) && !v.FieldByIndex(column.index).IsZero()
+		}
+		for _, name := range columns {
+			if strings.EqualFold(name, column.name) {
+				return true
+			}
+		}
+		return false
+	})
+	if len(values) == 0 {
+		return nil
+	}
+	return table.Table.SetContext(ctx, keys[0].Value, keys, values)
+}
+
+func (table *TypedTable[T]) Remove(ctx context.Context, key interface{}) error {
+	keys, err := table.keys(key)
+	if err != nil {
+		return err
+	}
+	return table.Table.RemoveContext(ctx, keys[0].Value, keys)
+}
+
+// Get returns the row with key, key is []interface{} of the primary key values if it is composite.
+// Like Table.Get it reads through the cache, from replicas and retries idempotent reads.
+func (table *TypedTable[T]) Get(ctx context.Context, key interface{}) (T, bool, error) {
+	var result T
+	keys, err := table.keys(key)
+	if err != nil {
+		return result, false, err
+	}
+	columns, convert := table.outputs(reflect.ValueOf(&result).Elem())
+	err, found := table.Table.GetContext(ctx, keys[0].Value, keys, columns)
+	if err != nil || !found {
+		return result, found, err
+	}
+	return result, true, convert()
+}
+
+// outputs returns SelectColumns into fields of v, convert sets UUID and big.Int fields from their stored form
+func (table *TypedTable[T]) outputs(v reflect.Value) (SelectColumns, func() error) {
+	columns := make(SelectColumns, len(table.columns))
+	var converts []func() error
+	for i, column := range table.columns {
+		field := v.FieldByIndex(column.index)
+		column := column
+		columns[i].Name = column.name
+		switch {
+		case column.goType == bigIntType && isBigIntType(table.Table.getField(column.name).GetType()):
+			value := new(*big.Int)
+			columns[i].Output = value
+			converts = append(converts, func() error {
+				if *value == nil {
+					return setTypedValue(field, column, nil)
+				}
+				return setTypedValue(field, column, *value)
+			})
+		case column.goType == uuidType || column.goType == bigIntType:
+			bytes := new([]byte)
+			columns[i].Output = bytes
+			converts = append(converts, func() error {
+				return setTypedBytes(field, column, *bytes)
+			})
+		default:
+			columns[i].Output = field.Addr().Interface()
+		}
+	}
+	return columns, func() error {
+		for _, convert := range converts {
+			err := convert()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// setTypedValue sets field of column to a selected value, NULL UUID and big.Int columns are zero values
+func setTypedValue(field reflect.Value, column typedColumn, value interface{}) error {
+	if column.goType == uuidType || column.goType == bigIntType {
+		switch v := value.(type) {
+		case nil:
+			return setTypedBytes(field, column, nil)
+		case []byte:
+			return setTypedBytes(field, column, v)
+		}
+	}
+	err := assignValue(field.Addr().Interface(), value)
+	if err != nil {
+		return fmt.Errorf("eplidr: column %s: %w", column.name, err)
+	}
+	return nil
+}
+
+func setTypedBytes(field reflect.Value, column typedColumn, bytes []byte) error {
+	if bytes == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	var value reflect.Value
+	switch column.goType {
+	case uuidType:
+		id, err := decodeUUID(bytes)
+		if err != nil {
+			return fmt.Errorf("eplidr: column %s: %w", column.name, err)
+		}
+		value = reflect.ValueOf(id)
+	case bigIntType:
+		value = reflect.ValueOf(new(big.Int).SetBytes(bytes))
+		if field.Kind() != reflect.Pointer {
+			value = value.Elem()
+		}
+		field.Set(value)
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		pointer := reflect.New(column.goType)
+		pointer.Elem().Set(value)
+		value = pointer
+	}
+	field.Set(value)
+	return nil
+}
+
+// Select returns rows matching where. If where requires the first primary key column to be equal to a value
+// only its shard is read, otherwise shards are read one after another. Shards are read like Table.GradualSelect,
+// from replicas and with retries of the query.
+func (table *TypedTable[T]) Select(ctx context.Context, where Condition) (*TypedRows[T], error) {
+	shards := table.Table.shards()
+	if shardKey, ok := equalValue(where, table.columns[table.primaryKey[0]].name); ok {
+		shards = []*Shard{table.Table.shard(shardKey)}
+	}
+	columns := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		columns[i] = column.name
+	}
+	return &TypedRows[T]{
+		ctx:     ctx,
+		table:   table,
+		where:   where,
+		columns: columns,
+		shards:  shards,
+	}, nil
+}
+
+// TypedRows iterates over rows of TypedTable.Select
+//
+//	for rows.Next() {
+//		user := rows.Value()
+//	}
+//	err = rows.Err()
+type TypedRows[T any] struct {
+	ctx     context.Context
+	table   *TypedTable[T]
+	where   Condition
+	columns []string
+	shards  []*Shard
+	res     *GradualSelectResult
+	value   T
+	err     error
+}
+
+func (rows *TypedRows[T]) Next() bool {
+	for rows.err == nil {
+		if rows.res == nil {
+			if len(rows.shards) == 0 {
+				return false
+			}
+			rows.res, rows.err = rows.shards[0].GradualSelectContext(rows.ctx, rows.where, SelectOptions{Columns: rows.columns})
+			rows.shards = rows.shards[1:]
+			continue
+		}
+		var next bool
+		next, rows.err = rows.res.Next()
+		if next {
+			var value T
+			rows.err = rows.table.assign(rows.res, reflect.ValueOf(&value).Elem())
+			rows.value = value
+			return rows.err == nil
+		}
+		closeErr := rows.res.Close()
+		if rows.err == nil {
+			rows.err = closeErr
+		}
+		rows.res = nil
+	}
+	return false
+}
+
+// assign sets fields of v to the current row of res
+func (table *TypedTable[T]) assign(res *GradualSelectResult, v reflect.Value) error {
+	for _, column := range table.columns {
+		value, err := res.value(column.name)
+		if err != nil {
+			return err
+		}
+		err = setTypedValue(v.FieldByIndex(column.index), column, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Value returns the current row
+func (rows *TypedRows[T]) Value() T {
+	return rows.value
+}
+
+func (rows *TypedRows[T]) Err() error {
+	return rows.err
+}
+
+// Close closes the current shard rows, it is needed only if iteration is stopped before Next returns false
+func (rows *TypedRows[T]) Close() error {
+	rows.shards = nil
+	if rows.res == nil {
+		return nil
+	}
+	err := rows.res.Close()
+	rows.res = nil
+	return err
+}
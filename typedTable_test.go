@@ -0,0 +1,80 @@
+package eplidr
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testUser struct {
+	ID      uuid.UUID `eplidr:"id,pk"`
+	Name    *string   `eplidr:"name,size=32"`
+	Balance *big.Int  `eplidr:"balance"`
+	Age     int       `eplidr:"age"`
+	Data    []byte    `eplidr:"data"`
+}
+
+func TestTypedTable(t *testing.T) {
+	for _, cached := range []bool{false, true} {
+		options := []TableOption{WithDialect(SQLite)}
+		if cached {
+			options = append(options, WithCache(CacheOptions{Size: 10, TTL: time.Minute}))
+		}
+		users, err := NewTypedTable[testUser]("users", 2, openSQLite(t), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		name := "bob"
+		bob := testUser{ID: uuid.New(), Name: &name, Balance: big.NewInt(1234567), Age: 7, Data: []byte{1, 2}}
+		anonymous := testUser{ID: uuid.New(), Age: 3, Data: []byte{}}
+		for _, user := range []testUser{bob, anonymous} {
+			err = users.Put(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the second Get of a cached table is a hit
+		for i := 0; i < 2; i++ {
+			got, found, err := users.Get(ctx, bob.ID)
+			if err != nil || !found {
+				t.Fatal(err, found)
+			}
+			if got.ID != bob.ID || got.Name == nil || *got.Name != "bob" || got.Balance.Int64() != 1234567 || got.Age != 7 || string(got.Data) != "\x01\x02" {
+				t.Errorf("got %+v, want %+v", got, bob)
+			}
+			got, found, err = users.Get(ctx, anonymous.ID)
+			if err != nil || !found {
+				t.Fatal(err, found)
+			}
+			if got.Name != nil || got.Balance != nil || got.Age != 3 {
+				t.Errorf("got %+v, want NULL name and balance", got)
+			}
+		}
+		if cached && users.Table.CacheStats().Hits != 2 {
+			t.Errorf("cache stats %+v, want 2 hits", users.Table.CacheStats())
+		}
+		rows, err := users.Select(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := 0
+		for rows.Next() {
+			user := rows.Value()
+			if user.ID == bob.ID && (user.Balance.Int64() != 1234567 || *user.Name != "bob") {
+				t.Errorf("selected %+v, want %+v", user, bob)
+			}
+			selected++
+		}
+		if rows.Err() != nil || selected != 2 {
+			t.Errorf("selected %d users: %v", selected, rows.Err())
+		}
+		_, found, err := users.Get(ctx, uuid.New())
+		if err != nil || found {
+			t.Errorf("missing user: %v %v", err, found)
+		}
+	}
+}
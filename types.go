@@ -56,7 +56,6 @@ func GetType(namedType BasicType) Type {
 	}
 }
 
-// TODO Discuss if verifying types (for example, on PUT check if UUID is valid, or on SELECT check if value is valid UUID) is needed
 const (
 	BasicTypeNone BasicType = iota
 	BasicTypeInt64
@@ -0,0 +1,266 @@
+package eplidr
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColumnError is a value of a column that does not match its field
+type ColumnError struct {
+	Column  string
+	Message string
+}
+
+// ValidationError lists every column of a write that does not match the table fields, nothing is written
+type ValidationError struct {
+	Table   string
+	Op      string
+	Columns []ColumnError
+}
+
+func (err *ValidationError) Error() string {
+	var columns []string
+	for _, column := range err.Columns {
+		columns = append(columns, column.Column+": "+column.Message)
+	}
+	return fmt.Sprintf("eplidr: %s on %s: invalid columns: %s", err.Op, err.Table, strings.Join(columns, "; "))
+}
+
+// Is matches ErrValidation
+func (err *ValidationError) Is(target error) bool {
+	other, ok := target.(Error)
+	return ok && other.Code == CodeValidation
+}
+
+type validationOp int
+
+const (
+	validateInsert validationOp = iota
+	validateUpdate
+	validateAdd
+)
+
+func (op validationOp) String() string {
+	switch op {
+	case validateInsert:
+		return "insert"
+	case validateAdd:
+		return "add"
+	}
+	return "update"
+}
+
+// validate checks values written by op against the fields of table
+func (table *Table) validate(op validationOp, values Columns) error {
+	result := &ValidationError{Table: table.name, Op: op.String()}
+	fail := func(column string, format string, args ...interface{}) {
+		result.Columns = append(result.Columns, ColumnError{Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+	written := make(map[string]bool, len(values))
+	for _, value := range values {
+		written[strings.ToLower(value.Name)] = true
+		field := table.getField(value.Name)
+		if field == nil || field.GetType().GetBasicType() == BasicTypeNone {
+			fail(value.Name, "unknown column")
+			continue
+		}
+		v, err := validationValue(value.Value)
+		if err != nil {
+			fail(value.Name, "%s", err.Error())
+			continue
+		}
+		if v == nil {
+			if op == validateAdd {
+				fail(value.Name, "can not add NULL")
+			} else if !fieldNullable(field) {
+				fail(value.Name, "NULL in NOT NULL column")
+			}
+			continue
+		}
+		if op == validateAdd && !isNumericType(field.GetType()) {
+			fail(value.Name, "can not add to non-numeric column")
+			continue
+		}
+		if message := validateValue(field.GetType(), v); message != "" {
+			fail(value.Name, "%s", message)
+		}
+	}
+	if op == validateInsert {
+		for _, field := range table.fields {
+			field, ok := field.(DefaultTableField)
+			if ok && !field.Nullable && field.DefaultValue == nil && !written[strings.ToLower(field.Name)] {
+				fail(field.Name, "NOT NULL column without default is missing")
+			}
+		}
+	}
+	if len(result.Columns) != 0 {
+		return result
+	}
+	return nil
+}
+
+// validationValue returns value as it is passed to the driver, pointers are dereferenced
+func validationValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		// normalizeArg binds the first element
+		if len(v) == 0 {
+			return nil, fmt.Errorf("empty value")
+		}
+		return validationValue(v[0])
+	case uuid.UUID:
+		return v, nil
+	case *big.Int, *uuid.UUID:
+		if reflect.ValueOf(v).IsNil() {
+			return nil, nil
+		}
+		return v, nil
+	case driver.Valuer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, nil
+		}
+		value, err := v.Value()
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return validationValue(rv.Elem().Interface())
+	}
+	return value, nil
+}
+
+func fieldNullable(field TableField) bool {
+	if field, ok := field.(DefaultTableField); ok {
+		return field.Nullable
+	}
+	// other fields do not declare it, the database checks them
+	return true
+}
+
+func isNumericType(t Type) bool {
+	switch t.GetBasicType() {
+	case BasicTypeInt64, BasicTypeInt32, BasicTypeUint64, BasicTypeUint32, BasicTypeFloat:
+		return true
+	}
+	return false
+}
+
+// validateValue returns why non-nil v can not be stored in a column of type t, empty if it can
+func validateValue(t Type, v interface{}) string {
+	rv := reflect.ValueOf(v)
+	switch t.GetBasicType() {
+	case BasicTypeInt64, BasicTypeInt32, BasicTypeUint64, BasicTypeUint32:
+		var min, max float64
+		switch t.GetBasicType() {
+		case BasicTypeInt64:
+			min, max = math.MinInt64, math.MaxInt64
+		case BasicTypeInt32:
+			min, max = math.MinInt32, math.MaxInt32
+		case BasicTypeUint64:
+			min, max = 0, math.MaxUint64
+		case BasicTypeUint32:
+			min, max = 0, math.MaxUint32
+		}
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n := float64(rv.Int()); n < min || n > max {
+				return fmt.Sprintf("%d is out of range", rv.Int())
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if n := float64(rv.Uint()); n > max {
+				return fmt.Sprintf("%d is out of range", rv.Uint())
+			}
+		default:
+			return fmt.Sprintf("%T is not an integer", v)
+		}
+	case BasicTypeFloat:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return fmt.Sprintf("%T is not a number", v)
+		}
+	case BasicTypeBool:
+		if rv.Kind() != reflect.Bool {
+			return fmt.Sprintf("%T is not a boolean", v)
+		}
+	case BasicTypeVarChar:
+		var length int
+		switch v := v.(type) {
+		case string:
+			length = utf8.RuneCountInString(v)
+		case []byte:
+			length = utf8.RuneCount(v)
+		default:
+			if rv.Kind() != reflect.String {
+				return fmt.Sprintf("%T is not a string", v)
+			}
+			length = utf8.RuneCountInString(rv.String())
+		}
+		if sized, ok := sizedType(t); ok && length > sized.Size {
+			return fmt.Sprintf("%d characters exceed VARCHAR(%d)", length, sized.Size)
+		}
+	case BasicTypeBinary, BasicTypeVarByte:
+		if t == TypeUUID {
+			return validateUUID(v)
+		}
+		if isBigIntType(t) {
+			switch v.(type) {
+			case *big.Int, big.Int, []byte, string:
+			default:
+				return fmt.Sprintf("%T is not a big.Int", v)
+			}
+		}
+		var length int
+		switch v := v.(type) {
+		case []byte:
+			length = len(v)
+		case string:
+			// hex encoded
+			length = len(v) / 2
+		case *big.Int:
+			length = len(v.Bytes())
+		case big.Int:
+			length = len(v.Bytes())
+		case uuid.UUID:
+			length = len(v)
+		default:
+			return fmt.Sprintf("%T is not binary", v)
+		}
+		if sized, ok := sizedType(t); ok && length > sized.Size {
+			return fmt.Sprintf("%d bytes exceed size %d", length, sized.Size)
+		}
+	}
+	return ""
+}
+
+func validateUUID(v interface{}) string {
+	switch v := v.(type) {
+	case uuid.UUID, *uuid.UUID:
+	case string:
+		if _, err := uuid.Parse(v); err != nil {
+			return "invalid UUID " + v
+		}
+	case []byte:
+		if len(v) != 16 {
+			if _, err := uuid.ParseBytes(v); err != nil {
+				return "invalid UUID"
+			}
+		}
+	default:
+		return fmt.Sprintf("%T is not a UUID", v)
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package eplidr
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidate(t *testing.T) {
+	table := renderTable(SQLite, append(TableFields{
+		DefaultTableField{Name: "small", Type: TypeInt32, Nullable: true},
+		DefaultTableField{Name: "flag", Type: TypeBool, Nullable: true},
+		DefaultTableField{Name: "uid", Type: TypeUUID, Nullable: true},
+		DefaultTableField{Name: "amount", Type: TypeFloat, Nullable: true},
+	}, itemFields...))
+	tests := []struct {
+		name   string
+		op     validationOp
+		values Columns
+		want   []string
+	}{
+		{"valid insert", validateInsert, Columns{{"id", 1}, {"status", int64(2)}, {"name", "ok"}, {"uid", uuid.New()}}, nil},
+		{"missing not null", validateInsert, Columns{{"id", 1}}, []string{"status"}},
+		{"unknown column", validateUpdate, Columns{{"nope", 1}}, []string{"nope"}},
+		{"null in not null", validateUpdate, Columns{{"status", nil}}, []string{"status"}},
+		{"nil pointer is null", validateUpdate, Columns{{"small", (*int32)(nil)}}, nil},
+		{"out of range", validateUpdate, Columns{{"small", int64(math.MaxInt32) + 1}}, []string{"small"}},
+		{"not an integer", validateUpdate, Columns{{"status", "1"}}, []string{"status"}},
+		{"not a boolean", validateUpdate, Columns{{"flag", 1}}, []string{"flag"}},
+		{"too long", validateUpdate, Columns{{"name", strings.Repeat("é", 33)}}, []string{"name"}},
+		{"too many bytes", validateUpdate, Columns{{"data", make([]byte, 17)}}, []string{"data"}},
+		{"invalid uuid", validateUpdate, Columns{{"uid", "not a uuid"}}, []string{"uid"}},
+		{"add to string", validateAdd, Columns{{"name", 1}}, []string{"name"}},
+		{"add null", validateAdd, Columns{{"amount", nil}}, []string{"amount"}},
+		{"every column", validateUpdate, Columns{{"small", "a"}, {"flag", "b"}, {"amount", "c"}}, []string{"small", "flag", "amount"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := table.validate(test.op, test.values)
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("valid columns: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, ErrValidation) {
+				t.Fatalf("got %v, want ValidationError", err)
+			}
+			var columns []string
+			for _, column := range validationErr.Columns {
+				columns = append(columns, column.Column)
+			}
+			if !reflect.DeepEqual(columns, test.want) {
+				t.Errorf("invalid columns %v, want %v: %v", columns, test.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateBeforeWrite(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 1, itemFields)
+	err := table.Put(int64(1), Columns{{"id", int64(1)}, {"status", "new"}})
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("got %v, want ErrValidation", err)
+	}
+	result, err := table.SelectAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.cache) != 0 {
+		t.Error("invalid row is written")
+	}
+}
@@ -0,0 +1,451 @@
+package eplidr
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// XA transactions are MySQL only. The coordinator log stores a row per transaction that reached the
+// prepare phase, the row is written before any branch is prepared and is switched to commit before any
+// branch is committed, so in-doubt branches found by XA RECOVER are committed only if the log says so.
+
+const (
+	xaPrefix = "eplidr-"
+
+	xaStatePrepare = "prepare"
+	xaStateCommit  = "commit"
+)
+
+var (
+	// ErrXAInDoubt is returned by DistributedTx.Commit if writing the commit decision to the log failed
+	// with an unknown outcome. The branches are left prepared, XACoordinator.Recover resolves them by the log.
+	ErrXAInDoubt = errors.New("eplidr: distributed transaction is in doubt, it is resolved by Recover")
+	// ErrXACommitPending is returned by DistributedTx.Commit if the commit is logged but a branch failed to
+	// commit, XACoordinator.Recover commits the branch
+	ErrXACommitPending = errors.New("eplidr: distributed transaction is committed, pending recovery")
+)
+
+// XACoordinator starts distributed transactions and recovers the ones interrupted by a crash
+type XACoordinator struct {
+	log *SingleKeyTable
+}
+
+// NewXACoordinator creates coordinator with log table {name}0 on driver
+func NewXACoordinator(name string, driver *sql.DB) (*XACoordinator, error) {
+	log, err := NewSingleKeyTable(name, "xid", 1, TableFields{
+		DefaultTableField{Name: "xid", Type: GetSizedType(BasicTypeVarChar, 64), PrimaryKey: true},
+		DefaultTableField{Name: "state", Type: GetSizedType(BasicTypeVarChar, 16)},
+		DefaultTableField{Name: "created", Type: TypeInt64},
+	}, driver)
+	if err != nil {
+		return nil, err
+	}
+	return &XACoordinator{log: log}, nil
+}
+
+// DistributedTx is a transaction over shards of one or more tables committed with two-phase commit.
+// A branch is started on the first use of a shard driver.
+type DistributedTx struct {
+	ctx         context.Context
+	coordinator *XACoordinator
+	id          string
+	branches    []*xaBranch
+	// logged is set after the transaction is written to the coordinator log
+	logged bool
+	done   bool
+	// invalidations of cached rows written by branches, they run after commit
+	invalidations []func()
+	// mirrors of writes to resharded tables, they are applied after commit
+	mirrors []txMirror
+	// reshards are the Resharders of the tables used by the transaction, it holds their
+	// transactions locks until releases run
+	reshards map[*Table]*Resharder
+	releases []func()
+}
+
+type xaBranch struct {
+	driver *sql.DB
+	conn   *sql.Conn
+	xid    string
+	// ended is set after XA END, finished after XA COMMIT or XA ROLLBACK
+	ended    bool
+	finished bool
+}
+
+// Begin starts a distributed transaction, ctx is used by all statements of the transaction
+func (c *XACoordinator) Begin(ctx context.Context) (*DistributedTx, error) {
+	return &DistributedTx{
+		ctx:         ctx,
+		coordinator: c,
+		id:          xaPrefix + uuid.NewString(),
+	}, nil
+}
+
+// InTx runs fn in a distributed transaction, it is committed if fn returns nil and rolled back otherwise.
+// fn is called again if a branch deadlocked.
+func (c *XACoordinator) InTx(ctx context.Context, fn func(tx *DistributedTx) error) error {
+	var err error
+	for attempt := 0; attempt < txRetries; attempt++ {
+		err = c.inTx(ctx, fn)
+		// a transaction that may be committed is not run again
+		if err == nil || !isDeadlock(err) || ctx.Err() != nil || errors.Is(err, ErrXAInDoubt) || errors.Is(err, ErrXACommitPending) {
+			return err
+		}
+		logger.Debug("distributed transaction deadlocked, retrying: ", err.Error())
+	}
+	return err
+}
+
+func (c *XACoordinator) inTx(ctx context.Context, fn func(tx *DistributedTx) error) error {
+	tx, err := c.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			logger.Error(rollbackErr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// ID returns global transaction id, it is the gtrid of every branch
+func (tx *DistributedTx) ID() string {
+	return tx.id
+}
+
+// Shard returns transaction on the shard of shardKey of table, it shares the branch with
+// the other shards using the same driver. It can not be committed or rolled back itself.
+func (tx *DistributedTx) Shard(table *Table, shardKey interface{}) (*Tx, error) {
+	if tx.done {
+		return nil, sql.ErrTxDone
+	}
+	if table.dialect.Name() != MySQL.Name() {
+		return nil, errors.New("eplidr: distributed transactions are supported by MySQL only, table " + table.name + " uses " + table.dialect.Name())
+	}
+	reshard, ok := tx.reshards[table]
+	if !ok {
+		var release func()
+		var err error
+		reshard, release, err = table.beginTx()
+		if err != nil {
+			return nil, err
+		}
+		if tx.reshards == nil {
+			tx.reshards = make(map[*Table]*Resharder)
+		}
+		tx.reshards[table] = reshard
+		tx.releases = append(tx.releases, release)
+	}
+	shard := table.shard(shardKey)
+	branch, err := tx.branch(shard.driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{ctx: tx.ctx, ex: branch.conn, shard: shard, invalidations: &tx.invalidations, reshard: reshard, mirrors: &tx.mirrors}, nil
+}
+
+func (tx *DistributedTx) branch(driver *sql.DB) (*xaBranch, error) {
+	for _, branch := range tx.branches {
+		if branch.driver == driver {
+			return branch, nil
+		}
+	}
+	conn, err := driver.Conn(tx.ctx)
+	if err != nil {
+		return nil, err
+	}
+	branch := &xaBranch{
+		driver: driver,
+		conn:   conn,
+		xid:    fmt.Sprintf("'%s','%d'", tx.id, len(tx.branches)),
+	}
+	_, err = conn.ExecContext(tx.ctx, "XA START "+branch.xid)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tx.branches = append(tx.branches, branch)
+	return branch, nil
+}
+
+// Commit prepares all branches and commits them. If the commit decision is logged but a branch
+// fails to commit, ErrXACommitPending is returned and the branch is committed by XACoordinator.Recover.
+// If the outcome of logging the decision is unknown, ErrXAInDoubt is returned and the branches are left prepared.
+func (tx *DistributedTx) Commit() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	defer tx.release()
+	if err := fencedMirrors(tx.mirrors); err != nil {
+		return tx.abort(err)
+	}
+	err := commitMirrored(tx.mirrors, tx.commit)
+	if errors.Is(err, ErrXACommitPending) || errors.Is(err, ErrXAInDoubt) {
+		// rows of in doubt transactions may be committed by Recover, they are not mirrored then
+		for _, mirror := range tx.mirrors {
+			mirror.reshard.mirrorFailed(err)
+		}
+	}
+	if err == nil || errors.Is(err, ErrXACommitPending) || errors.Is(err, ErrXAInDoubt) {
+		runInvalidations(tx.invalidations)
+	}
+	return err
+}
+
+func (tx *DistributedTx) commit() error {
+	if len(tx.branches) == 0 {
+		return nil
+	}
+	for _, branch := range tx.branches {
+		err := branch.exec(tx.ctx, "XA END ")
+		if err != nil {
+			return tx.abort(err)
+		}
+		branch.ended = true
+	}
+	if len(tx.branches) == 1 {
+		err := tx.branches[0].exec(tx.ctx, "XA COMMIT ", " ONE PHASE")
+		if err != nil {
+			return tx.abort(err)
+		}
+		tx.branches[0].finished = true
+		return nil
+	}
+	err := tx.coordinator.log.Table.PutContext(tx.ctx, tx.id, Columns{
+		{"xid", tx.id}, {"state", xaStatePrepare}, {"created", time.Now().Unix()},
+	})
+	if err != nil {
+		return tx.abort(err)
+	}
+	tx.logged = true
+	for _, branch := range tx.branches {
+		err = branch.exec(tx.ctx, "XA PREPARE ")
+		if err != nil {
+			return tx.abort(err)
+		}
+	}
+	// The decision is not bound to ctx, once it is logged the branches must be committed. The update may
+	// have been applied even if it failed, so the branches are not rolled back but left for Recover.
+	err = tx.coordinator.log.SingleSet(tx.id, Column{"state", xaStateCommit})
+	if err != nil {
+		logger.Error("xa ", tx.id, ": logging the commit failed, branches are left prepared for recovery: ", err.Error())
+		return fmt.Errorf("%w: %w", ErrXAInDoubt, err)
+	}
+	var commitErr error
+	for _, branch := range tx.branches {
+		err = branch.exec(context.Background(), "XA COMMIT ")
+		if err != nil {
+			logger.Error("xa ", tx.id, ": commit of branch ", branch.xid, " failed, it is left for recovery: ", err.Error())
+			commitErr = err
+			continue
+		}
+		branch.finished = true
+	}
+	if commitErr != nil {
+		return fmt.Errorf("%w: %w", ErrXACommitPending, commitErr)
+	}
+	err = tx.coordinator.log.Remove(tx.id)
+	if err != nil {
+		logger.Error("xa ", tx.id, ": ", err.Error())
+	}
+	return nil
+}
+
+// Rollback rolls back all branches
+func (tx *DistributedTx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	defer tx.release()
+	return tx.rollback()
+}
+
+// abort rolls back the branches after a failed commit and returns err
+func (tx *DistributedTx) abort(err error) error {
+	rollbackErr := tx.rollback()
+	if rollbackErr != nil {
+		logger.Error("xa ", tx.id, ": rollback failed: ", rollbackErr.Error())
+	}
+	return err
+}
+
+func (tx *DistributedTx) rollback() error {
+	ctx := context.Background()
+	var result error
+	for _, branch := range tx.branches {
+		if branch.finished {
+			continue
+		}
+		if !branch.ended {
+			err := branch.exec(ctx, "XA END ")
+			if err != nil {
+				result = err
+				continue
+			}
+			branch.ended = true
+		}
+		err := branch.exec(ctx, "XA ROLLBACK ")
+		if err != nil {
+			result = err
+			continue
+		}
+		branch.finished = true
+	}
+	if result == nil && tx.logged {
+		err := tx.coordinator.log.Remove(tx.id)
+		if err != nil {
+			logger.Error("xa ", tx.id, ": ", err.Error())
+		}
+	}
+	return result
+}
+
+// release returns connections of the branches to the pool, connections left in XA state are discarded
+func (tx *DistributedTx) release() {
+	for _, branch := range tx.branches {
+		if !branch.finished {
+			branch.conn.Raw(func(interface{}) error {
+				return driver.ErrBadConn
+			})
+		}
+		branch.conn.Close()
+	}
+	for _, release := range tx.releases {
+		release()
+	}
+}
+
+func (branch *xaBranch) exec(ctx context.Context, statement string, suffix ...string) error {
+	_, err := branch.conn.ExecContext(ctx, statement+branch.xid+strings.Join(suffix, ""))
+	return err
+}
+
+// Recover resolves branches prepared by this coordinator on the shards of tables: branches of
+// transactions with logged commit are committed, others are rolled back. Transactions started less than
+// olderThan ago are skipped, they may still be committing.
+func (c *XACoordinator) Recover(ctx context.Context, olderThan time.Duration, tables ...*Table) error {
+	drivers := make(map[*sql.DB][]xaID)
+	for _, table := range tables {
+		for _, shard := range table.shards() {
+			drivers[shard.driver] = nil
+		}
+	}
+	for db := range drivers {
+		branches, err := xaRecover(ctx, db)
+		if err != nil {
+			return err
+		}
+		drivers[db] = branches
+	}
+	// The log is read after XA RECOVER, a branch is prepared only after its transaction is logged
+	states, err := c.states(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-olderThan).Unix()
+	pending := make(map[string]bool)
+	for db, branches := range drivers {
+		for _, xid := range branches {
+			state, logged := states[xid.gtrid]
+			if logged && state.created > deadline {
+				pending[xid.gtrid] = true
+				continue
+			}
+			statement := "XA ROLLBACK "
+			if logged && state.state == xaStateCommit {
+				statement = "XA COMMIT "
+			}
+			_, err = db.ExecContext(ctx, statement+xid.String())
+			if err != nil {
+				logger.Error("xa ", xid.gtrid, ": recovery failed: ", err.Error())
+				pending[xid.gtrid] = true
+				continue
+			}
+			logger.Info("xa ", xid.gtrid, ": recovered with ", statement)
+		}
+	}
+	for id, state := range states {
+		if pending[id] || state.created > deadline {
+			continue
+		}
+		err = c.log.RemoveContext(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type xaLogState struct {
+	state   string
+	created int64
+}
+
+func (c *XACoordinator) states(ctx context.Context) (map[string]xaLogState, error) {
+	rows, err := c.log.Table.GetShard(0).QueryContext(ctx, "SELECT `xid`, `state`, `created` FROM {table};")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := make(map[string]xaLogState)
+	for rows.Next() {
+		var id string
+		var state xaLogState
+		err = rows.Scan(&id, &state.state, &state.created)
+		if err != nil {
+			return nil, err
+		}
+		states[id] = state
+	}
+	return states, rows.Err()
+}
+
+type xaID struct {
+	formatID int64
+	gtrid    string
+	bqual    string
+}
+
+func (xid xaID) String() string {
+	return fmt.Sprintf("'%s','%s',%d", xid.gtrid, xid.bqual, xid.formatID)
+}
+
+// xaRecover returns prepared branches of db started by a coordinator
+func xaRecover(ctx context.Context, db *sql.DB) ([]xaID, error) {
+	rows, err := db.QueryContext(ctx, "XA RECOVER;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []xaID
+	for rows.Next() {
+		var xid xaID
+		var gtridLength, bqualLength int
+		var data string
+		err = rows.Scan(&xid.formatID, &gtridLength, &bqualLength, &data)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < gtridLength+bqualLength {
+			continue
+		}
+		xid.gtrid = data[:gtridLength]
+		xid.bqual = data[gtridLength : gtridLength+bqualLength]
+		if strings.HasPrefix(xid.gtrid, xaPrefix) {
+			result = append(result, xid)
+		}
+	}
+	return result, rows.Err()
+}
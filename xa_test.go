@@ -0,0 +1,69 @@
+package eplidr
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDistributedTxDialect(t *testing.T) {
+	table := newSQLiteTable(t, openSQLite(t), "items", 2, itemFields)
+	// the coordinator log is not written by a transaction without branches
+	coordinator := &XACoordinator{}
+	tx, err := coordinator.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Shard(table, int64(1)); err == nil {
+		t.Error("distributed transaction on SQLite is started")
+	}
+	if err = tx.Commit(); err != nil {
+		t.Errorf("commit of an empty distributed transaction: %v", err)
+	}
+	if err = tx.Commit(); err == nil {
+		t.Error("second commit succeeded")
+	}
+	if !table.txMx.TryLock() {
+		t.Fatal("transactions lock is held after the distributed transaction ended")
+	}
+	table.txMx.Unlock()
+}
+
+func TestDistributedTxRetries(t *testing.T) {
+	coordinator := &XACoordinator{}
+	ctx := context.Background()
+	var ids []string
+	err := coordinator.InTx(ctx, func(tx *DistributedTx) error {
+		ids = append(ids, tx.ID())
+		if len(ids) < 3 {
+			return ErrDeadlock
+		}
+		return nil
+	})
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("InTx after deadlocks: %v, %d attempts, want 3", err, len(ids))
+	}
+	if !strings.HasPrefix(ids[0], xaPrefix) || ids[0] == ids[1] {
+		t.Errorf("transaction ids %v, want a new id with prefix %s for every attempt", ids, xaPrefix)
+	}
+
+	// a transaction that may be committed is not run again
+	for _, failure := range []error{ErrXAInDoubt, ErrXACommitPending, errors.New("failure")} {
+		attempts := 0
+		err = coordinator.InTx(ctx, func(tx *DistributedTx) error {
+			attempts++
+			return failure
+		})
+		if !errors.Is(err, failure) || attempts != 1 {
+			t.Errorf("InTx failing with %v: %v after %d attempts, want 1", failure, err, attempts)
+		}
+	}
+}
+
+func TestXAID(t *testing.T) {
+	xid := xaID{formatID: 1, gtrid: xaPrefix + "a", bqual: "1"}
+	if got, want := xid.String(), "'eplidr-a','1',1"; got != want {
+		t.Errorf("xid %s, want %s", got, want)
+	}
+}